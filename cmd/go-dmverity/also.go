@@ -0,0 +1,137 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	verity "github.com/containerd/go-dmverity/pkg/verity"
+)
+
+// alsoFlag collects the trees requested with repeated --also flags.
+type alsoFlag []string
+
+func (a *alsoFlag) String() string {
+	return strings.Join(*a, " ")
+}
+
+func (a *alsoFlag) Set(v string) error {
+	*a = append(*a, v)
+	return nil
+}
+
+// parseFormatAlsoArgs returns the params and hash path of the main tree
+// first, followed by one entry per --also flag.
+func parseFormatAlsoArgs(args []string) ([]*verity.VerityParams, string, []string, error) {
+	fs := flag.NewFlagSet("format", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+
+	flags := defaultFlags(fs)
+	var also alsoFlag
+	fs.Var(&also, "also", "build another tree: path=<hash_path>[,<format option>=<value>...]")
+
+	p, dataPath, hashPath, err := parseFormatFlagSet(fs, flags, args)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	if p.DirectIO {
+		return nil, "", nil, errors.New("--direct-io cannot be combined with --also")
+	}
+
+	params := []*verity.VerityParams{p}
+	hashPaths := []string{hashPath}
+	for _, spec := range also {
+		ap, alsoPath, err := parseAlsoSpec(spec, dataPath)
+		if err != nil {
+			return nil, "", nil, err
+		}
+		params = append(params, ap)
+		hashPaths = append(hashPaths, alsoPath)
+	}
+	return params, dataPath, hashPaths, nil
+}
+
+// parseAlsoSpec parses path=<hash_path>[,<option>=<value>...], where the
+// options are format flags without dashes and boolean flags may omit the
+// value. Options not given take the format defaults, not those of the main
+// tree.
+func parseAlsoSpec(spec, dataPath string) (*verity.VerityParams, string, error) {
+	fs := flag.NewFlagSet("--also", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+
+	flags := prefixedFlags(fs, "")
+	setFormatDefaults(flags)
+
+	var hashPath string
+	var args []string
+	for _, opt := range strings.Split(spec, ",") {
+		key, value, hasValue := strings.Cut(opt, "=")
+		switch {
+		case key == "path":
+			hashPath = value
+		case hasValue:
+			args = append(args, "--"+key+"="+value)
+		default:
+			args = append(args, "--"+key)
+		}
+	}
+	if hashPath == "" {
+		return nil, "", fmt.Errorf("--also %q: missing path=<hash_path>", spec)
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return nil, "", fmt.Errorf("--also %q: %w", spec, err)
+	}
+	p, err := formatParams(flags, dataPath, hashPath)
+	if err != nil {
+		return nil, "", fmt.Errorf("--also %q: %w", spec, err)
+	}
+	return p, hashPath, nil
+}
+
+// runFormatAlso builds every tree in a single pass over the data.
+func runFormatAlso(params []*verity.VerityParams, dataPath string, hashPaths []string) error {
+	for i, p := range params {
+		if err := prepareHashDevice(p, hashPaths[i]); err != nil {
+			return err
+		}
+	}
+
+	roots, err := verity.VerityCreateMulti(params, dataPath, hashPaths)
+	if err != nil {
+		return err
+	}
+
+	results := make([]*formatResult, len(params))
+	for i, p := range params {
+		if results[i], err = newFormatResult(p, hashPaths[i], roots[i]); err != nil {
+			return err
+		}
+	}
+	return emit(results, func() {
+		for i, res := range results {
+			if i > 0 {
+				fmt.Println()
+			}
+			res.printText()
+		}
+	})
+}
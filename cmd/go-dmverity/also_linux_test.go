@@ -0,0 +1,82 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/containerd/go-dmverity/pkg/utils"
+)
+
+func TestParseFormatAlsoArgs(t *testing.T) {
+	data := utils.MakeTempFile(t, 4096*16)
+	defer os.Remove(data)
+
+	params, _, hashPaths, err := parseFormatAlsoArgs([]string{"--salt", "0102",
+		"--also", "path=h1,hash=sha1,format=0,no-superblock,salt=-",
+		"--also", "path=h2,data-block-size=1024", data, "h0"})
+	if err != nil {
+		t.Fatalf("parseFormatAlsoArgs failed: %v", err)
+	}
+	if len(params) != 3 || hashPaths[0] != "h0" || hashPaths[1] != "h1" || hashPaths[2] != "h2" {
+		t.Fatalf("unexpected trees: %v", hashPaths)
+	}
+	if p := params[1]; p.HashName != "sha1" || p.HashType != 0 || !p.NoSuperblock || len(p.Salt) != 0 {
+		t.Errorf("unexpected --also params: %+v", p)
+	}
+	if p := params[2]; p.HashName != "sha256" || p.DataBlockSize != 1024 || p.DataBlocks != 64 || len(p.Salt) != 0 {
+		t.Errorf("--also should start from the format defaults: %+v", p)
+	}
+
+	for _, spec := range []string{"hash=sha1", "path=h1,bogus=1", "path=h1,data-block-size=1000"} {
+		if _, _, _, err := parseFormatAlsoArgs([]string{"--also", spec, data, "h0"}); err == nil {
+			t.Errorf("expected error for --also %q", spec)
+		}
+	}
+}
+
+func TestFormatAlso(t *testing.T) {
+	dir := t.TempDir()
+	data := utils.MakeTempFile(t, 4096*300)
+	defer os.Remove(data)
+	h0 := filepath.Join(dir, "sha256.img")
+	h1 := filepath.Join(dir, "sha1.img")
+
+	bin := utils.RequireTool(t, "go-dmverity")
+	out, err := exec.Command(bin, "format", "--output", "json",
+		"--also", "path="+h1+",hash=sha1,format=0,no-superblock", data, h0).Output()
+	if err != nil {
+		t.Fatalf("format --also failed: %v", err)
+	}
+	var results []struct {
+		Path     string `json:"path"`
+		RootHash string `json:"root_hash"`
+	}
+	if err := json.Unmarshal(out, &results); err != nil {
+		t.Fatalf("invalid JSON output: %v\n%s", err, out)
+	}
+	if len(results) != 2 || results[0].Path != h0 || results[1].Path != h1 {
+		t.Fatalf("unexpected results: %+v", results)
+	}
+
+	utils.RunGoCLI(t, "verify", data, h0, results[0].RootHash)
+	utils.RunGoCLI(t, "verify", "--no-superblock", "--hash", "sha1", "--format", "0", data, h1, results[1].RootHash)
+}
@@ -0,0 +1,102 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/google/uuid"
+
+	"github.com/containerd/go-dmverity/pkg/utils"
+	verity "github.com/containerd/go-dmverity/pkg/verity"
+)
+
+func parseFormatAppendArgs(args []string) (*verity.VerityParams, string, error) {
+	fs := flag.NewFlagSet("format", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+
+	flags := defaultFlags(fs)
+	fs.Bool("append", false, "append the hash tree and a trailer to the data file")
+
+	setFormatDefaults(flags)
+
+	if err := fs.Parse(args); err != nil {
+		return nil, "", err
+	}
+
+	rest := fs.Args()
+	if len(rest) != 1 {
+		return nil, "", errors.New("require <file>")
+	}
+	if *flags.NoSuper || *flags.HashOffset != 0 || *flags.DataBlocks != 0 {
+		return nil, "", errors.New("--append places the superblock after the data and cannot be combined with --no-superblock, --hash-offset or --data-blocks")
+	}
+
+	p := verity.DefaultVerityParams()
+	applyFlags(&p, flags)
+
+	if err := validateAndApplyBlockSizes(&p, flags); err != nil {
+		return nil, "", err
+	}
+
+	salt, saltSize, err := utils.ApplySalt(*flags.SaltHex, int(verity.MaxSaltSize))
+	if err != nil {
+		return nil, "", err
+	}
+	p.Salt = salt
+	p.SaltSize = saltSize
+
+	uuid, err := utils.ApplyUUID(*flags.UUIDStr, true, false, func() (string, error) {
+		return uuid.New().String(), nil
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	p.UUID = uuid
+
+	return &p, rest[0], nil
+}
+
+func runFormatAppend(p *verity.VerityParams, path string) error {
+	rootHash, _, err := verity.VerityCreateAppend(p, path)
+	if err != nil {
+		return err
+	}
+	res, err := newFormatResult(p, path, rootHash)
+	if err != nil {
+		return err
+	}
+	res.appended = true
+	return emit(res, res.printText)
+}
+
+// applyTrailer points p at the superblock recorded in the trailer of a file
+// formatted with format --append.
+func applyTrailer(p *verity.VerityParams, path string) error {
+	if p.NoSuperblock {
+		return errors.New("a single file requires the superblock written by format --append")
+	}
+	t, err := verity.ReadTrailerFile(path)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	p.HashAreaOffset = t.HashOffset
+	return nil
+}
@@ -0,0 +1,78 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/containerd/go-dmverity/pkg/utils"
+)
+
+func TestParseFormatAppendArgs(t *testing.T) {
+	p, path, err := parseFormatAppendArgs([]string{"--append", "--salt", "-", "image.raw"})
+	if err != nil {
+		t.Fatalf("parseFormatAppendArgs failed: %v", err)
+	}
+	if path != "image.raw" || p.NoSuperblock || p.HashName != "sha256" {
+		t.Errorf("unexpected result: %s %+v", path, p)
+	}
+
+	invalid := [][]string{
+		{"--append"},
+		{"--append", "a", "b"},
+		{"--append", "--no-superblock", "image.raw"},
+		{"--append", "--hash-offset", "4096", "image.raw"},
+	}
+	for _, args := range invalid {
+		if _, _, err := parseFormatAppendArgs(args); err == nil {
+			t.Errorf("parseFormatAppendArgs(%v): expected error", args)
+		}
+	}
+}
+
+func TestFormatAppend(t *testing.T) {
+	image := utils.MakeTempFile(t, 4096*16+100)
+	defer os.Remove(image)
+
+	out, _ := utils.RunGoCLI(t, "format", "--append", image)
+	rootHex := utils.ExtractRootHex(t, out)
+	if !strings.Contains(out, "Data blocks:            17") {
+		t.Errorf("unexpected format output:\n%s", out)
+	}
+
+	out, _ = utils.RunGoCLI(t, "verify", image, rootHex)
+	if !strings.Contains(out, "Verification succeeded") {
+		t.Errorf("unexpected verify output:\n%s", out)
+	}
+
+	out, _ = utils.RunGoCLI(t, "dump", image)
+	if !strings.Contains(out, "Data blocks:") || !strings.Contains(out, "17") {
+		t.Errorf("unexpected dump output:\n%s", out)
+	}
+
+	if p, _, _, _, err := parseVerifyArgs([]string{image, rootHex}); err != nil {
+		t.Errorf("parseVerifyArgs failed: %v", err)
+	} else if p.HashAreaOffset != 17*4096 {
+		t.Errorf("HashAreaOffset = %d, want %d", p.HashAreaOffset, 17*4096)
+	}
+
+	if _, _, _, _, err := parseVerifyArgs([]string{"--no-superblock", image, rootHex}); err == nil {
+		t.Error("expected error for a single file without a superblock")
+	}
+}
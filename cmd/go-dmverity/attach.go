@@ -0,0 +1,183 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/containerd/go-dmverity/pkg/utils"
+	verity "github.com/containerd/go-dmverity/pkg/verity"
+	"github.com/containerd/go-dmverity/pkg/veritytab"
+)
+
+type attachSources struct {
+	veritytab   string
+	cmdline     string
+	procCmdline bool
+}
+
+func parseAttachArgs(cmd string, args []string) (*attachSources, error) {
+	fs := flag.NewFlagSet(cmd, flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+
+	src := &attachSources{}
+	fs.StringVar(&src.veritytab, "veritytab", "", "veritytab file (default "+veritytab.DefaultPath+")")
+	fs.StringVar(&src.cmdline, "cmdline", "", "kernel command line to read roothash=/usrhash= parameters from")
+	fs.BoolVar(&src.procCmdline, "proc-cmdline", false, "read roothash=/usrhash= parameters from "+veritytab.ProcCmdline)
+
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if fs.NArg() != 0 {
+		return nil, fmt.Errorf("%s takes no positional arguments", cmd)
+	}
+	if src.cmdline != "" && src.procCmdline {
+		return nil, errors.New("--cmdline and --proc-cmdline are mutually exclusive")
+	}
+	if src.veritytab == "" && src.cmdline == "" && !src.procCmdline {
+		src.veritytab = veritytab.DefaultPath
+	}
+	return src, nil
+}
+
+func loadAttachEntries(src *attachSources) ([]veritytab.Entry, error) {
+	var entries []veritytab.Entry
+
+	if src.veritytab != "" {
+		tab, err := veritytab.ParseFile(src.veritytab)
+		if err != nil {
+			return nil, fmt.Errorf("read %s: %w", src.veritytab, err)
+		}
+		entries = append(entries, tab...)
+	}
+
+	var fromCmdline []veritytab.Entry
+	var err error
+	switch {
+	case src.cmdline != "":
+		fromCmdline, err = veritytab.ParseCmdline(src.cmdline)
+	case src.procCmdline:
+		fromCmdline, err = veritytab.ReadProcCmdline()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("kernel command line: %w", err)
+	}
+	entries = append(entries, fromCmdline...)
+
+	seen := map[string]bool{}
+	for _, e := range entries {
+		if seen[e.Name] {
+			return nil, fmt.Errorf("device %q is listed more than once", e.Name)
+		}
+		seen[e.Name] = true
+	}
+	return entries, nil
+}
+
+func runAttachAll(src *attachSources) error {
+	entries, err := loadAttachEntries(src)
+	if err != nil {
+		return err
+	}
+
+	var opened []string
+	results := []openResult{}
+	for _, e := range entries {
+		if e.NoAuto {
+			continue
+		}
+
+		devPath, err := attachEntry(e)
+		if err != nil {
+			if e.NoFail {
+				log.Printf("attach-all: %s: %v (nofail, skipping)", e.Name, err)
+				continue
+			}
+			if rbErr := closeDevices(opened); rbErr != nil {
+				return fmt.Errorf("%s: %w (rollback: %v)", e.Name, err, rbErr)
+			}
+			return fmt.Errorf("%s: %w", e.Name, err)
+		}
+		opened = append(opened, e.Name)
+		results = append(results, openResult{Name: e.Name, Device: devPath})
+	}
+	return emit(results, func() {
+		for _, r := range results {
+			fmt.Printf("%s\n", r.Device)
+		}
+	})
+}
+
+func attachEntry(e veritytab.Entry) (string, error) {
+	dataDev, err := utils.ResolveDeviceSpec(e.DataDevice)
+	if err != nil {
+		return "", err
+	}
+	hashDev, err := utils.ResolveDeviceSpec(e.HashDevice)
+	if err != nil {
+		return "", err
+	}
+
+	p := e.Params
+	return openDevice(&p, dataDev, e.Name, hashDev, e.RootHash, e.Flags, e.SignatureFile)
+}
+
+// closeDevices removes the named devices in reverse order, skipping those
+// that are not active.
+func closeDevices(names []string) error {
+	var errs []error
+	for i := len(names) - 1; i >= 0; i-- {
+		if err := verity.VerityClose(names[i]); err != nil && !errors.Is(err, unix.ENXIO) {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func runDetachAll(src *attachSources) error {
+	entries, err := loadAttachEntries(src)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	results := []closeResult{}
+	for i := len(entries) - 1; i >= 0; i-- {
+		name := entries[i].Name
+		if err := verity.VerityClose(name); err != nil {
+			if !errors.Is(err, unix.ENXIO) {
+				errs = append(errs, err)
+			}
+			continue
+		}
+		results = append(results, closeResult{Name: name, Device: "/dev/mapper/" + name, Removed: true})
+	}
+	if err := emit(results, func() {
+		for _, r := range results {
+			fmt.Printf("%s removed\n", r.Device)
+		}
+	}); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
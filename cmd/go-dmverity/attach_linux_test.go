@@ -0,0 +1,128 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/containerd/go-dmverity/pkg/utils"
+	"github.com/containerd/go-dmverity/pkg/veritytab"
+)
+
+const attachTestRoot = "4392712ba01368efdf14b05c76f9e4df0d53664630b5d48632ed17a137f39076"
+
+func writeVeritytab(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "veritytab")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("write veritytab: %v", err)
+	}
+	return path
+}
+
+func TestParseAttachArgs(t *testing.T) {
+	src, err := parseAttachArgs("attach-all", nil)
+	if err != nil {
+		t.Fatalf("parseAttachArgs failed: %v", err)
+	}
+	if src.veritytab != veritytab.DefaultPath {
+		t.Errorf("default veritytab = %q, want %q", src.veritytab, veritytab.DefaultPath)
+	}
+
+	src, err = parseAttachArgs("attach-all", []string{"--cmdline", "roothash=00"})
+	if err != nil {
+		t.Fatalf("parseAttachArgs failed: %v", err)
+	}
+	if src.veritytab != "" {
+		t.Errorf("veritytab should not default when a command line is given, got %q", src.veritytab)
+	}
+
+	invalid := [][]string{
+		{"extra"},
+		{"--cmdline", "x", "--proc-cmdline"},
+	}
+	for _, args := range invalid {
+		if _, err := parseAttachArgs("attach-all", args); err == nil {
+			t.Errorf("parseAttachArgs(%v): expected error", args)
+		}
+	}
+}
+
+func TestLoadAttachEntries(t *testing.T) {
+	tab := writeVeritytab(t, "data /dev/vdb /dev/vdc "+attachTestRoot+" ignore-corruption\n")
+	cmdline := "roothash=" + attachTestRoot + " systemd.verity_root_data=/dev/vda2 systemd.verity_root_hash=/dev/vda3"
+
+	entries, err := loadAttachEntries(&attachSources{veritytab: tab, cmdline: cmdline})
+	if err != nil {
+		t.Fatalf("loadAttachEntries failed: %v", err)
+	}
+	if len(entries) != 2 || entries[0].Name != "data" || entries[1].Name != "root" {
+		t.Fatalf("unexpected entries: %+v", entries)
+	}
+
+	dup := writeVeritytab(t, "root /dev/vdb /dev/vdc "+attachTestRoot+"\n")
+	if _, err := loadAttachEntries(&attachSources{veritytab: dup, cmdline: cmdline}); err == nil {
+		t.Error("expected error for a device listed in both sources")
+	}
+}
+
+func TestAttachAll_FailsOnMissingDevice(t *testing.T) {
+	tab := writeVeritytab(t, "missing /nonexistent/data /nonexistent/hash "+attachTestRoot+"\n")
+
+	err := runAttachAll(&attachSources{veritytab: tab})
+	if err == nil {
+		t.Fatal("attach-all should fail for a missing data device")
+	}
+	if !strings.Contains(err.Error(), "missing") {
+		t.Errorf("error should name the failing device, got: %v", err)
+	}
+}
+
+func TestAttachAll_SkipsNoAutoAndNoFail(t *testing.T) {
+	tab := writeVeritytab(t,
+		"skipped /nonexistent/data /nonexistent/hash "+attachTestRoot+" noauto\n"+
+			"optional /nonexistent/data /nonexistent/hash "+attachTestRoot+" nofail\n")
+
+	if err := runAttachAll(&attachSources{veritytab: tab}); err != nil {
+		t.Fatalf("attach-all should skip noauto and nofail entries: %v", err)
+	}
+}
+
+func TestAttachAll_Rollback(t *testing.T) {
+	utils.RequireRoot(t)
+	utils.RequireTool(t, "dmsetup")
+
+	data, hash, rootHex := utils.CreateFormattedFiles(t)
+	defer os.Remove(data)
+	defer os.Remove(hash)
+
+	dmCleanup := utils.NewDMDeviceCleanup(t)
+	defer dmCleanup.Cleanup()
+	dmCleanup.Add("vgo-attach-ok")
+
+	tab := writeVeritytab(t,
+		"vgo-attach-ok "+data+" "+hash+" "+rootHex+" superblock=no\n"+
+			"vgo-attach-bad /nonexistent/data "+hash+" "+rootHex+" superblock=no\n")
+
+	if err := runAttachAll(&attachSources{veritytab: tab}); err == nil {
+		t.Fatal("attach-all should fail when one device cannot be opened")
+	}
+	utils.VerifyDeviceRemoved(t, "vgo-attach-ok")
+}
@@ -0,0 +1,145 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/containerd/go-dmverity/pkg/avb"
+	"github.com/containerd/go-dmverity/pkg/dm"
+	"github.com/containerd/go-dmverity/pkg/utils"
+	verity "github.com/containerd/go-dmverity/pkg/verity"
+)
+
+func parseOpenAVBArgs(args []string) (string, string, string, error) {
+	fs := flag.NewFlagSet("open", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+
+	fs.Bool("avb", false, "read verity parameters from the image's AVB footer")
+	partition := fs.String("partition", "", "partition name of the hashtree descriptor to use")
+
+	if err := fs.Parse(args); err != nil {
+		return "", "", "", err
+	}
+
+	rest := fs.Args()
+	if len(rest) != 2 {
+		return "", "", "", errors.New("require --avb <image> <name>")
+	}
+	image, name := rest[0], rest[1]
+
+	if strings.TrimSpace(name) == "" {
+		return "", "", "", fmt.Errorf("device name is required")
+	}
+	if strings.Contains(name, "/") {
+		return "", "", "", fmt.Errorf("device name must not contain '/' characters")
+	}
+	if len(name) >= dm.DMNameLen {
+		return "", "", "", fmt.Errorf("device name too long (max %d characters)", dm.DMNameLen-1)
+	}
+
+	return image, name, *partition, nil
+}
+
+func parseVerifyAVBArgs(args []string) (string, string, error) {
+	fs := flag.NewFlagSet("verify", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+
+	fs.Bool("avb", false, "read verity parameters from the image's AVB footer")
+	partition := fs.String("partition", "", "partition name of the hashtree descriptor to use")
+
+	if err := fs.Parse(args); err != nil {
+		return "", "", err
+	}
+
+	rest := fs.Args()
+	if len(rest) != 1 {
+		return "", "", errors.New("require --avb <image>")
+	}
+	return rest[0], *partition, nil
+}
+
+// readAVBImage returns the hashtree descriptor from the vbmeta embedded in
+// image. The vbmeta signature is not checked.
+func readAVBImage(image, partition string) (*avb.HashtreeDescriptor, error) {
+	size, err := utils.GetBlockOrFileSize(image)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(image)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	ht, err := avb.ReadImage(f, size, partition)
+	if err != nil {
+		return nil, err
+	}
+	if err := ht.Validate(); err != nil {
+		return nil, err
+	}
+	return ht, nil
+}
+
+func runOpenAVB(image, name, partition string) error {
+	ht, err := readAVBImage(image, partition)
+	if err != nil {
+		return err
+	}
+
+	loop, cleanup, err := utils.SetupLoopDevice(image)
+	if err != nil {
+		return fmt.Errorf("setup loop device: %w", err)
+	}
+	defer func() {
+		if loop != image {
+			cleanup()
+		}
+	}()
+
+	flags := ht.FECArgs(loop)
+	if ht.Flags&avb.FlagCheckAtMostOnce != 0 {
+		flags = append(flags, "check_at_most_once")
+	}
+
+	p := ht.VerityParams()
+	devPath, err := verity.VerityOpen(&p, name, loop, loop, ht.RootDigest, "", flags)
+	if err != nil {
+		return err
+	}
+
+	return printOpenResult(name, devPath)
+}
+
+func runVerifyAVB(image, partition string) error {
+	ht, err := readAVBImage(image, partition)
+	if err != nil {
+		return err
+	}
+
+	p := ht.VerityParams()
+	if err := verity.VerityVerify(&p, image, image, ht.RootDigest); err != nil {
+		return fmt.Errorf("verification failed: %w", err)
+	}
+
+	return printVerifyResult(image, image, ht.RootDigest)
+}
@@ -0,0 +1,69 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package main
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/containerd/go-dmverity/pkg/avb"
+	"github.com/containerd/go-dmverity/pkg/utils"
+)
+
+func TestParseOpenAVBArgs(t *testing.T) {
+	image, name, partition, err := parseOpenAVBArgs([]string{"--avb", "--partition", "system", "system.img", "system"})
+	if err != nil {
+		t.Fatalf("parseOpenAVBArgs failed: %v", err)
+	}
+	if image != "system.img" || name != "system" || partition != "system" {
+		t.Errorf("unexpected result: %s %s %s", image, name, partition)
+	}
+
+	invalid := [][]string{
+		{"--avb", "system.img"},
+		{"--avb", "system.img", "a/b"},
+		{"--avb", "system.img", "system", "extra"},
+	}
+	for _, args := range invalid {
+		if _, _, _, err := parseOpenAVBArgs(args); err == nil {
+			t.Errorf("parseOpenAVBArgs(%v): expected error", args)
+		}
+	}
+}
+
+func TestParseVerifyAVBArgs(t *testing.T) {
+	image, partition, err := parseVerifyAVBArgs([]string{"--avb", "system.img"})
+	if err != nil {
+		t.Fatalf("parseVerifyAVBArgs failed: %v", err)
+	}
+	if image != "system.img" || partition != "" {
+		t.Errorf("unexpected result: %s %s", image, partition)
+	}
+	if _, _, err := parseVerifyAVBArgs([]string{"--avb", "a", "b"}); err == nil {
+		t.Error("expected error for extra arguments")
+	}
+}
+
+func TestVerifyAVB_NoFooter(t *testing.T) {
+	image := utils.MakeTempFile(t, 4096*16)
+	defer os.Remove(image)
+
+	if err := runVerifyAVB(image, ""); !errors.Is(err, avb.ErrNoFooter) {
+		t.Errorf("expected ErrNoFooter, got %v", err)
+	}
+}
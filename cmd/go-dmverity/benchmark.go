@@ -0,0 +1,185 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package main
+
+import (
+	"crypto/rand"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/containerd/go-dmverity/pkg/utils"
+	verity "github.com/containerd/go-dmverity/pkg/verity"
+)
+
+// parseBenchmarkArgs returns one params per combination of the listed hash
+// algorithms, block sizes and salt sizes, the in-memory benchmark size, the
+// data size to project times for and the optional device to read.
+func parseBenchmarkArgs(args []string) ([]*verity.VerityParams, uint64, uint64, string, error) {
+	fs := flag.NewFlagSet("benchmark", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+
+	hashes := fs.String("hash", strings.Join(verity.HashAlgorithms(), ","), "comma-separated hash algorithms")
+	dataBlockSizes := fs.String("data-block-size", "4096", "comma-separated data block sizes in bytes")
+	hashBlockSizes := fs.String("hash-block-size", "4096", "comma-separated hash block sizes in bytes")
+	saltSizes := fs.String("salt-size", "32", "comma-separated salt sizes in bytes")
+	formatType := fs.Uint("format", 1, "Format type (1 - normal, 0 - original Chrome OS)")
+	size := fs.Uint64("size", 64<<20, "bytes of in-memory data to hash per measurement")
+	dataSize := fs.Uint64("data-size", 1<<30, "data size in bytes to project format and verify times for")
+	directIO := fs.Bool("direct-io", false, "bypass the page cache when reading the device")
+
+	if err := fs.Parse(args); err != nil {
+		return nil, 0, 0, "", err
+	}
+
+	var device string
+	switch fs.NArg() {
+	case 0:
+		if *directIO {
+			return nil, 0, 0, "", errors.New("--direct-io requires a <device>")
+		}
+	case 1:
+		device = fs.Arg(0)
+	default:
+		return nil, 0, 0, "", errors.New("require at most one <device>")
+	}
+	if *formatType > 1 {
+		return nil, 0, 0, "", fmt.Errorf("invalid format type: %d", *formatType)
+	}
+	if *size == 0 || *dataSize == 0 {
+		return nil, 0, 0, "", errors.New("--size and --data-size must be positive")
+	}
+
+	dbs, err := parseUintList("data-block-size", *dataBlockSizes, 32)
+	if err != nil {
+		return nil, 0, 0, "", err
+	}
+	hbs, err := parseUintList("hash-block-size", *hashBlockSizes, 32)
+	if err != nil {
+		return nil, 0, 0, "", err
+	}
+	salts, err := parseUintList("salt-size", *saltSizes, 16)
+	if err != nil {
+		return nil, 0, 0, "", err
+	}
+	for _, bs := range append(append([]uint64{}, dbs...), hbs...) {
+		if !utils.IsBlockSizeValid(uint32(bs)) {
+			return nil, 0, 0, "", fmt.Errorf("invalid block size: %d", bs)
+		}
+	}
+
+	var params []*verity.VerityParams
+	for _, name := range strings.Split(*hashes, ",") {
+		name = strings.TrimSpace(name)
+		if _, err := verity.HashSize(name); err != nil {
+			return nil, 0, 0, "", err
+		}
+		for _, d := range dbs {
+			for _, h := range hbs {
+				for _, s := range salts {
+					salt := make([]byte, s)
+					if _, err := rand.Read(salt); err != nil {
+						return nil, 0, 0, "", err
+					}
+					params = append(params, &verity.VerityParams{
+						HashName:      name,
+						DataBlockSize: uint32(d),
+						HashBlockSize: uint32(h),
+						HashType:      uint32(*formatType),
+						Salt:          salt,
+						SaltSize:      uint16(s),
+						DirectIO:      *directIO,
+					})
+				}
+			}
+		}
+	}
+
+	return params, *size, *dataSize, device, nil
+}
+
+func parseUintList(name, list string, bitSize int) ([]uint64, error) {
+	var out []uint64
+	for _, s := range strings.Split(list, ",") {
+		v, err := strconv.ParseUint(strings.TrimSpace(s), 10, bitSize)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --%s %q: %w", name, s, err)
+		}
+		out = append(out, v)
+	}
+	return out, nil
+}
+
+type benchmarkResult struct {
+	*verity.HashBenchmark
+	DataSize      uint64  `json:"data_size"`
+	ProjectedTime float64 `json:"projected_seconds"`
+}
+
+func runBenchmark(params []*verity.VerityParams, size, dataSize uint64, device string) error {
+	var results []benchmarkResult
+	for _, p := range params {
+		b, err := verity.BenchmarkHash(p, size)
+		if err != nil {
+			return fmt.Errorf("%s: %w", p.HashName, err)
+		}
+		if device != "" {
+			if err := b.BenchmarkDevice(p, device, size); err != nil {
+				return fmt.Errorf("%s: %w", p.HashName, err)
+			}
+		}
+		t, err := b.ProjectedTime(dataSize)
+		if err != nil {
+			return fmt.Errorf("%s: %w", p.HashName, err)
+		}
+		results = append(results, benchmarkResult{HashBenchmark: b, DataSize: dataSize, ProjectedTime: t.Seconds()})
+	}
+
+	return emit(results, func() {
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+		header := "Algorithm\tData block\tHash block\tSalt\tData MB/s\tHash MB/s\t"
+		if device != "" {
+			header += "Device MB/s\t"
+		}
+		fmt.Fprintf(w, "%sTime for %s\t\n", header, formatBytes(dataSize))
+		for _, r := range results {
+			line := fmt.Sprintf("%s\t%d\t%d\t%d\t%.1f\t%.1f\t", r.HashName, r.DataBlockSize,
+				r.HashBlockSize, r.SaltSize, r.DataRate/1e6, r.HashRate/1e6)
+			if device != "" {
+				line += fmt.Sprintf("%.1f\t", r.DeviceRate/1e6)
+			}
+			d := time.Duration(r.ProjectedTime * float64(time.Second))
+			fmt.Fprintf(w, "%s%s\t\n", line, d.Round(time.Millisecond))
+		}
+		w.Flush()
+	})
+}
+
+func formatBytes(n uint64) string {
+	units := []string{"B", "KiB", "MiB", "GiB", "TiB", "PiB"}
+	i := 0
+	for n >= 1024 && n%1024 == 0 && i < len(units)-1 {
+		n /= 1024
+		i++
+	}
+	return fmt.Sprintf("%d %s", n, units[i])
+}
@@ -0,0 +1,75 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseBenchmarkArgs(t *testing.T) {
+	params, size, dataSize, device, err := parseBenchmarkArgs([]string{
+		"--hash", "sha256,sha1", "--data-block-size", "512,4096", "--salt-size", "0,32",
+		"--size", "1048576", "--data-size", "4194304",
+	})
+	if err != nil {
+		t.Fatalf("parseBenchmarkArgs failed: %v", err)
+	}
+	if len(params) != 8 {
+		t.Fatalf("expected 8 combinations, got %d", len(params))
+	}
+	if size != 1<<20 || dataSize != 4<<20 || device != "" {
+		t.Errorf("unexpected sizes or device: %d %d %q", size, dataSize, device)
+	}
+	p := params[1]
+	if p.HashName != "sha256" || p.DataBlockSize != 512 || p.HashBlockSize != 4096 || p.SaltSize != 32 || len(p.Salt) != 32 {
+		t.Errorf("unexpected params: %+v", p)
+	}
+
+	invalid := [][]string{
+		{"--hash", "no-such-hash"},
+		{"--data-block-size", "1000"},
+		{"--salt-size", "x"},
+		{"--format", "2"},
+		{"--size", "0"},
+		{"--direct-io"},
+		{"dev1", "dev2"},
+	}
+	for _, args := range invalid {
+		if _, _, _, _, err := parseBenchmarkArgs(args); err == nil {
+			t.Errorf("parseBenchmarkArgs(%v): expected error", args)
+		}
+	}
+}
+
+func TestBenchmark(t *testing.T) {
+	dev := filepath.Join(t.TempDir(), "dev.img")
+	if err := os.WriteFile(dev, make([]byte, 1<<20), 0o644); err != nil {
+		t.Fatalf("write device: %v", err)
+	}
+
+	params, size, dataSize, device, err := parseBenchmarkArgs([]string{
+		"--hash", "sha256", "--hash-block-size", "1024,4096", "--size", "262144", dev,
+	})
+	if err != nil {
+		t.Fatalf("parseBenchmarkArgs failed: %v", err)
+	}
+	if err := runBenchmark(params, size, dataSize, device); err != nil {
+		t.Fatalf("runBenchmark failed: %v", err)
+	}
+}
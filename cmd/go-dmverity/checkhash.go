@@ -0,0 +1,85 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/containerd/go-dmverity/pkg/utils"
+	verity "github.com/containerd/go-dmverity/pkg/verity"
+)
+
+// parseCheckHashArgs returns nil params as hashDeviceParams does.
+func parseCheckHashArgs(args []string) (*verity.VerityParams, string, []byte, error) {
+	fs := flag.NewFlagSet("check-hash", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+
+	flags := defaultFlags(fs)
+
+	if err := fs.Parse(args); err != nil {
+		return nil, "", nil, err
+	}
+
+	if fs.NArg() != 2 {
+		return nil, "", nil, errors.New("require <hash_path> <root_hex>")
+	}
+	hashPath := fs.Arg(0)
+
+	p, err := hashDeviceParams(fs, flags)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	rootBytes, err := utils.ParseRootHash(fs.Arg(1))
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	return p, hashPath, rootBytes, nil
+}
+
+type checkHashResult struct {
+	HashPath string          `json:"hash_path"`
+	RootHash verity.HexBytes `json:"root_hash"`
+	Verified bool            `json:"verified"`
+}
+
+func runCheckHash(p *verity.VerityParams, hashPath string, rootDigest []byte) error {
+	switch {
+	case p == nil:
+		sbOffset, err := superblockOffset(hashPath)
+		if err != nil {
+			return err
+		}
+		p = &verity.VerityParams{HashAreaOffset: sbOffset}
+	case !p.NoSuperblock:
+		// Only the superblock offset was given.
+		p = &verity.VerityParams{HashAreaOffset: p.HashAreaOffset}
+	}
+
+	if err := verity.VerityCheckHash(p, hashPath, rootDigest); err != nil {
+		return fmt.Errorf("hash device check failed: %w", err)
+	}
+
+	res := checkHashResult{HashPath: hashPath, RootHash: rootDigest, Verified: true}
+	return emit(res, func() {
+		fmt.Printf("Hash device check succeeded\n")
+	})
+}
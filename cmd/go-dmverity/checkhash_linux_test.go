@@ -0,0 +1,92 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/containerd/go-dmverity/pkg/utils"
+)
+
+func TestParseCheckHashArgs(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+	}{
+		{"missing root", []string{"hash"}},
+		{"too many args", []string{"hash", "00", "extra"}},
+		{"param flag with superblock", []string{"--salt", "00", "hash", "00"}},
+		{"no superblock without data blocks", []string{"--no-superblock", "hash", "00"}},
+		{"invalid root", []string{"hash", "zz"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, _, err := parseCheckHashArgs(tt.args); err == nil {
+				t.Errorf("expected error for %v", tt.args)
+			}
+		})
+	}
+
+	p, _, _, err := parseCheckHashArgs([]string{"--hash-offset", "8192", "hash", "00"})
+	if err != nil {
+		t.Fatalf("parseCheckHashArgs failed: %v", err)
+	}
+	if p == nil || p.HashAreaOffset != 8192 {
+		t.Errorf("expected superblock offset 8192, got %+v", p)
+	}
+}
+
+func TestCheckHash(t *testing.T) {
+	data := utils.MakeTempFile(t, 4096*300)
+	hash := utils.MakeTempFile(t, 0)
+	defer os.Remove(data)
+	defer os.Remove(hash)
+
+	out, _ := utils.RunGoCLI(t, "format", data, hash)
+	rootHex := utils.ExtractRootHex(t, out)
+
+	out, _ = utils.RunGoCLI(t, "check-hash", hash, rootHex)
+	if !strings.Contains(out, "Hash device check succeeded") {
+		t.Errorf("unexpected check-hash output:\n%s", out)
+	}
+
+	image := utils.MakeTempFile(t, 4096*16)
+	defer os.Remove(image)
+	out, _ = utils.RunGoCLI(t, "format", "--append", image)
+	appendRoot := utils.ExtractRootHex(t, out)
+	utils.RunGoCLI(t, "check-hash", image, appendRoot)
+
+	// Garbage after the last level 0 digest.
+	f, err := os.OpenFile(hash, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteAt([]byte{0xff}, 4096*5-1); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	p, hashPath, root, err := parseCheckHashArgs([]string{hash, rootHex})
+	if err != nil {
+		t.Fatalf("parseCheckHashArgs failed: %v", err)
+	}
+	if err := runCheckHash(p, hashPath, root); err == nil || !strings.Contains(err.Error(), "not zeroed") {
+		t.Errorf("expected a spare area error, got %v", err)
+	}
+}
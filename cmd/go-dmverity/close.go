@@ -43,6 +43,12 @@ func runClose(name string) error {
 		return err
 	}
 
-	fmt.Printf("/dev/mapper/%s removed\n", name)
-	return nil
+	return printCloseResult(name)
+}
+
+func printCloseResult(name string) error {
+	res := closeResult{Name: name, Device: "/dev/mapper/" + name, Removed: true}
+	return emit(res, func() {
+		fmt.Printf("%s removed\n", res.Device)
+	})
 }
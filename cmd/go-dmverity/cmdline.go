@@ -0,0 +1,123 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"github.com/containerd/go-dmverity/pkg/dm"
+	"github.com/containerd/go-dmverity/pkg/gpt"
+	"github.com/containerd/go-dmverity/pkg/utils"
+	verity "github.com/containerd/go-dmverity/pkg/verity"
+)
+
+var devnoPattern = regexp.MustCompile(`^[0-9]+:[0-9]+$`)
+
+func parseOpenCmdlineArgs(args []string) (*verity.KernelTable, string, string, error) {
+	fs := flag.NewFlagSet("open", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+
+	cmdline := fs.String("from-cmdline", "", "kernel command line or dm= table describing the device")
+	sig := fs.String("root-hash-signature", "", "path to root hash signature file")
+
+	if err := fs.Parse(args); err != nil {
+		return nil, "", "", err
+	}
+	if *cmdline == "" {
+		return nil, "", "", errors.New("--from-cmdline requires a dm= table")
+	}
+	if fs.NArg() > 1 {
+		return nil, "", "", errors.New("--from-cmdline takes at most one <name> argument")
+	}
+
+	kt, err := verity.ParseKernelTable(*cmdline)
+	if err != nil {
+		return nil, "", "", err
+	}
+
+	name := kt.Name
+	if fs.NArg() == 1 {
+		name = fs.Arg(0)
+	}
+	if strings.TrimSpace(name) == "" {
+		return nil, "", "", fmt.Errorf("device name is required")
+	}
+	if strings.Contains(name, "/") {
+		return nil, "", "", fmt.Errorf("device name must not contain '/' characters")
+	}
+	if len(name) >= dm.DMNameLen {
+		return nil, "", "", fmt.Errorf("device name too long (max %d characters)", dm.DMNameLen-1)
+	}
+
+	return kt, name, *sig, nil
+}
+
+func runOpenCmdline(kt *verity.KernelTable, name, signatureFile string) error {
+	dataDev, err := resolveKernelDevice(kt.Args.DataDevice)
+	if err != nil {
+		return fmt.Errorf("payload device: %w", err)
+	}
+	hashDev, err := resolveKernelDevice(kt.Args.HashDevice)
+	if err != nil {
+		return fmt.Errorf("hash tree device: %w", err)
+	}
+
+	p := kt.Params
+	devPath, err := openDevice(&p, dataDev, name, hashDev, kt.Args.RootDigest, kt.Args.Flags, signatureFile)
+	if err != nil {
+		return err
+	}
+
+	return printOpenResult(name, devPath)
+}
+
+// resolveKernelDevice maps a device reference as the kernel accepts it on the
+// command line (PARTUUID=<uuid>[/PARTNROFF=<n>], major:minor or a path) to a
+// device path.
+func resolveKernelDevice(ref string) (string, error) {
+	if strings.Contains(ref, "%U") {
+		return "", fmt.Errorf("%q still contains the bootloader placeholder %%U", ref)
+	}
+	if devnoPattern.MatchString(ref) {
+		return utils.DeviceFromNumber(ref)
+	}
+
+	spec, ok := strings.CutPrefix(ref, "PARTUUID=")
+	if !ok {
+		return utils.ResolveDeviceSpec(ref)
+	}
+	partUUID, offset, hasOffset := strings.Cut(spec, "/PARTNROFF=")
+	u, err := uuid.Parse(partUUID)
+	if err != nil {
+		return "", fmt.Errorf("invalid PARTUUID %q: %w", partUUID, err)
+	}
+	n := 0
+	if hasOffset {
+		if n, err = strconv.Atoi(offset); err != nil {
+			return "", fmt.Errorf("invalid PARTNROFF %q", offset)
+		}
+	}
+	return gpt.FindPartition(u, n)
+}
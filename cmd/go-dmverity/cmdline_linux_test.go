@@ -0,0 +1,94 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/containerd/go-dmverity/pkg/utils"
+)
+
+const cmdlineTestTable = `dm="1 vroot none ro 1,0 2048 verity payload=/dev/sda3 hashtree=/dev/sda3 hashstart=2048 alg=sha1 ` +
+	`root_hexdigest=ef00000000000000000000000000000000000000"`
+
+func TestParseOpenCmdlineArgs(t *testing.T) {
+	kt, name, _, err := parseOpenCmdlineArgs([]string{"--from-cmdline", cmdlineTestTable})
+	if err != nil {
+		t.Fatalf("parseOpenCmdlineArgs failed: %v", err)
+	}
+	if name != "vroot" || kt.Args.DataDevice != "/dev/sda3" {
+		t.Errorf("unexpected result: name=%s args=%+v", name, kt.Args)
+	}
+
+	_, name, _, err = parseOpenCmdlineArgs([]string{"--from-cmdline", cmdlineTestTable, "other"})
+	if err != nil {
+		t.Fatalf("parseOpenCmdlineArgs failed: %v", err)
+	}
+	if name != "other" {
+		t.Errorf("name override = %s, want other", name)
+	}
+
+	invalid := [][]string{
+		{"--from-cmdline", ""},
+		{"--from-cmdline", "vroot none ro"},
+		{"--from-cmdline", cmdlineTestTable, "a/b"},
+		{"--from-cmdline", cmdlineTestTable, "a", "b"},
+	}
+	for _, args := range invalid {
+		if _, _, _, err := parseOpenCmdlineArgs(args); err == nil {
+			t.Errorf("parseOpenCmdlineArgs(%v): expected error", args)
+		}
+	}
+}
+
+func TestResolveKernelDevice(t *testing.T) {
+	if _, err := resolveKernelDevice("PARTUUID=%U/PARTNROFF=1"); err == nil {
+		t.Error("expected error for an unsubstituted bootloader placeholder")
+	}
+	if _, err := resolveKernelDevice("PARTUUID=not-a-uuid"); err == nil {
+		t.Error("expected error for invalid PARTUUID")
+	}
+	if got, err := resolveKernelDevice("/dev/sda3"); err != nil || got != "/dev/sda3" {
+		t.Errorf("resolveKernelDevice(/dev/sda3) = %q, %v", got, err)
+	}
+}
+
+func TestResolveKernelDevice_MajorMinor(t *testing.T) {
+	utils.RequireRoot(t)
+
+	file := utils.MakeTempFile(t, 4096*16)
+	defer os.Remove(file)
+	loop, err := utils.AttachLoopDevice(file)
+	if err != nil {
+		t.Fatalf("attach loop: %v", err)
+	}
+	defer utils.DetachLoopDevice(loop)
+
+	devno, err := utils.DeviceNumber(loop)
+	if err != nil {
+		t.Fatalf("DeviceNumber failed: %v", err)
+	}
+	got, err := resolveKernelDevice(devno)
+	if err != nil {
+		t.Fatalf("resolveKernelDevice(%s) failed: %v", devno, err)
+	}
+	if !strings.HasSuffix(got, strings.TrimPrefix(loop, "/dev/")) {
+		t.Errorf("resolveKernelDevice(%s) = %s, want %s", devno, got, loop)
+	}
+}
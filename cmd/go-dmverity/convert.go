@@ -0,0 +1,102 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/google/uuid"
+
+	"github.com/containerd/go-dmverity/pkg/utils"
+	verity "github.com/containerd/go-dmverity/pkg/verity"
+)
+
+func parseConvertArgs(args []string) (*verity.VerityParams, string, []byte, bool, error) {
+	fs := flag.NewFlagSet("convert", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+
+	flags := defaultFlags(fs)
+	to := fs.String("to", "", "target layout: superblock or no-superblock")
+
+	if err := fs.Parse(args); err != nil {
+		return nil, "", nil, false, err
+	}
+
+	var toSuperblock bool
+	switch *to {
+	case "superblock":
+		toSuperblock = true
+	case "no-superblock":
+	default:
+		return nil, "", nil, false, fmt.Errorf("--to must be superblock or no-superblock, got %q", *to)
+	}
+
+	if fs.NArg() != 2 {
+		return nil, "", nil, false, errors.New("require <hash_path> <root_hex>")
+	}
+	hashPath := fs.Arg(0)
+
+	p, err := hashDeviceParams(fs, flags)
+	if err != nil {
+		return nil, "", nil, false, err
+	}
+	if p == nil {
+		p = &verity.VerityParams{}
+	} else if !p.NoSuperblock {
+		return nil, "", nil, false, errors.New("--hash-offset: only separate hash devices can be converted")
+	}
+
+	rootBytes, err := utils.ParseRootHash(fs.Arg(1))
+	if err != nil {
+		return nil, "", nil, false, err
+	}
+
+	return p, hashPath, rootBytes, toSuperblock, nil
+}
+
+func runConvert(p *verity.VerityParams, hashPath string, rootDigest []byte, toSuperblock bool) error {
+	if p.NoSuperblock {
+		if err := verity.ValidateRootHashSize(rootDigest, p.HashName); err != nil {
+			return err
+		}
+	} else if sbOffset, err := superblockOffset(hashPath); err != nil {
+		return err
+	} else if sbOffset != 0 {
+		return errors.New("only separate hash devices can be converted, not single-file images")
+	}
+
+	if toSuperblock && p.UUID == ([16]byte{}) {
+		u := uuid.New()
+		copy(p.UUID[:], u[:])
+	}
+
+	if err := verity.VerityConvert(p, hashPath, rootDigest, toSuperblock); err != nil {
+		return fmt.Errorf("convert failed: %w", err)
+	}
+
+	info, err := verity.ParamsInfo(hashPath, p)
+	if err != nil {
+		return err
+	}
+	info.RootHash = rootDigest
+	return emit(info, func() {
+		fmt.Print(info.String())
+	})
+}
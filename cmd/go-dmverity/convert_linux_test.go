@@ -0,0 +1,78 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/containerd/go-dmverity/pkg/utils"
+)
+
+func TestParseConvertArgs(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+	}{
+		{"missing --to", []string{"hash", "00"}},
+		{"invalid --to", []string{"--to", "both", "hash", "00"}},
+		{"missing root", []string{"--to", "no-superblock", "hash"}},
+		{"superblock offset", []string{"--to", "no-superblock", "--hash-offset", "8192", "hash", "00"}},
+		{"no superblock without data blocks", []string{"--to", "superblock", "--no-superblock", "hash", "00"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, _, _, err := parseConvertArgs(tt.args); err == nil {
+				t.Errorf("expected error for %v", tt.args)
+			}
+		})
+	}
+}
+
+func TestConvert(t *testing.T) {
+	data := utils.MakeTempFile(t, 4096*300)
+	hash := utils.MakeTempFile(t, 0)
+	defer os.Remove(data)
+	defer os.Remove(hash)
+
+	out, _ := utils.RunGoCLI(t, "format", "--salt", "0102", data, hash)
+	rootHex := utils.ExtractRootHex(t, out)
+
+	utils.RunGoCLI(t, "convert", "--to", "no-superblock", hash, rootHex)
+	utils.RunGoCLI(t, "verify", "--no-superblock", "--salt", "0102", data, hash, rootHex)
+
+	const id = "123e4567-e89b-12d3-a456-426614174000"
+	out, _ = utils.RunGoCLI(t, "convert", "--to", "superblock", "--no-superblock", "--salt", "0102",
+		"--data-blocks", "300", "--uuid", id, hash, rootHex)
+	if !strings.Contains(out, id) {
+		t.Errorf("unexpected convert output:\n%s", out)
+	}
+	utils.RunGoCLI(t, "verify", data, hash, rootHex)
+
+	image := utils.MakeTempFile(t, 4096*16)
+	defer os.Remove(image)
+	out, _ = utils.RunGoCLI(t, "format", "--append", image)
+	appendRoot := utils.ExtractRootHex(t, out)
+	p, hashPath, root, to, err := parseConvertArgs([]string{"--to", "no-superblock", image, appendRoot})
+	if err != nil {
+		t.Fatalf("parseConvertArgs failed: %v", err)
+	}
+	if err := runConvert(p, hashPath, root, to); err == nil {
+		t.Error("expected an error converting a single-file image")
+	}
+}
@@ -17,34 +17,139 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
 	"os"
 
+	"github.com/containerd/go-dmverity/pkg/utils"
 	"github.com/containerd/go-dmverity/pkg/verity"
 )
 
-func parseDumpArgs(args []string) (string, error) {
+// parseDumpArgs returns nil params as hashDeviceParams does.
+func parseDumpArgs(args []string) (string, *verity.VerityParams, bool, error) {
 	fs := flag.NewFlagSet("dump", flag.ContinueOnError)
 	fs.SetOutput(os.Stderr)
 
+	flags := defaultFlags(fs)
+	tree := fs.Bool("tree", false, "list the offset and size of every hash tree level")
+
 	if err := fs.Parse(args); err != nil {
-		return "", err
+		return "", nil, false, err
 	}
 
 	if fs.NArg() != 1 {
-		return "", fmt.Errorf("dump requires exactly one argument: <hash_device>")
+		return "", nil, false, fmt.Errorf("dump requires exactly one argument: <hash_device>")
+	}
+	hashPath := fs.Arg(0)
+
+	p, err := hashDeviceParams(fs, flags)
+	if err != nil {
+		return "", nil, false, err
+	}
+	return hashPath, p, *tree, nil
+}
+
+// hashDeviceParams builds the params of the commands that read a hash device
+// without its data device. It returns nil params when the superblock is at
+// the start of the device or at the offset in its trailer; otherwise
+// --hash-offset is the superblock offset.
+func hashDeviceParams(fs *flag.FlagSet, flags *CommonFlags) (*verity.VerityParams, error) {
+	p := verity.DefaultVerityParams()
+	applyFlags(&p, flags)
+
+	if !p.NoSuperblock {
+		// Everything but the superblock offset comes from the superblock.
+		var conflict string
+		fs.Visit(func(f *flag.Flag) {
+			if conflict == "" && paramFlags[f.Name] && f.Name != "hash-offset" {
+				conflict = f.Name
+			}
+		})
+		if conflict != "" {
+			return nil, fmt.Errorf("--%s requires --no-superblock", conflict)
+		}
+		if p.HashAreaOffset == 0 {
+			return nil, nil
+		}
+		return &p, nil
+	}
+
+	if err := validateAndApplyBlockSizes(&p, flags); err != nil {
+		return nil, err
+	}
+	if err := utils.ValidateHashOffset(p.HashAreaOffset, p.HashBlockSize, p.NoSuperblock); err != nil {
+		return nil, err
+	}
+	if *flags.DataBlocks == 0 {
+		return nil, errors.New("--no-superblock requires --data-blocks")
+	}
+	p.DataBlocks = *flags.DataBlocks
+
+	salt, saltSize, err := utils.ApplySalt(*flags.SaltHex, int(verity.MaxSaltSize))
+	if err != nil {
+		return nil, err
 	}
+	p.Salt = salt
+	p.SaltSize = saltSize
 
-	return fs.Arg(0), nil
+	uuid, err := utils.ApplyUUID(*flags.UUIDStr, false, p.NoSuperblock, nil)
+	if err != nil {
+		return nil, err
+	}
+	p.UUID = uuid
+
+	return &p, nil
 }
 
-func runDump(hashPath string) error {
-	output, err := verity.DumpDevice(hashPath)
+// superblockOffset returns the superblock offset recorded in the trailer of
+// hashPath, or 0 when it has none.
+func superblockOffset(hashPath string) (uint64, error) {
+	t, err := verity.ReadTrailerFile(hashPath)
+	switch {
+	case err == nil:
+		return t.HashOffset, nil
+	case errors.Is(err, verity.ErrNoTrailer):
+		return 0, nil
+	default:
+		return 0, err
+	}
+}
+
+// runDump describes hashPath. With p set, the superblock is read at
+// p.HashAreaOffset, or p itself is described when it has no superblock.
+func runDump(hashPath string, p *verity.VerityParams, tree bool) error {
+	var info *verity.VerityInfo
+	var err error
+	switch {
+	case p == nil:
+		sbOffset, serr := superblockOffset(hashPath)
+		if serr != nil {
+			return serr
+		}
+		info, err = verity.DumpDeviceInfoAt(hashPath, sbOffset)
+	case p.NoSuperblock:
+		info, err = verity.ParamsInfo(hashPath, p)
+	default:
+		info, err = verity.DumpDeviceInfoAt(hashPath, p.HashAreaOffset)
+	}
 	if err != nil {
 		return err
 	}
 
-	fmt.Print(output)
-	return nil
+	return printDumpInfo(info, tree)
+}
+
+func printDumpInfo(info *verity.VerityInfo, tree bool) error {
+	if tree {
+		levels, err := verity.HashTreeLevels(&info.Params)
+		if err != nil {
+			return err
+		}
+		info.Levels = levels
+	}
+
+	return emit(info, func() {
+		fmt.Print(info.String())
+	})
 }
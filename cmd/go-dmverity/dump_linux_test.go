@@ -96,7 +96,7 @@ func TestDump_NoSuperblock(t *testing.T) {
 		t.Fatalf("VerityCreate failed: %v", err)
 	}
 
-	err = runDump(hash)
+	err = runDump(hash, nil, false)
 	if err == nil {
 		t.Error("dump should fail for hash device without superblock")
 	}
@@ -106,7 +106,7 @@ func TestDump_NoSuperblock(t *testing.T) {
 }
 
 func TestDump_InvalidDevice(t *testing.T) {
-	err := runDump("/nonexistent/device")
+	err := runDump("/nonexistent/device", nil, false)
 	if err == nil {
 		t.Error("dump should fail for nonexistent device")
 	}
@@ -122,7 +122,7 @@ func TestDump_CorruptedSuperblock(t *testing.T) {
 	}
 	f.Close()
 
-	err := runDump(hash)
+	err := runDump(hash, nil, false)
 	if err == nil {
 		t.Error("dump should fail for corrupted superblock")
 	}
@@ -139,7 +139,7 @@ func TestParseDumpArgs_InvalidArgs(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			_, err := parseDumpArgs(tt.args)
+			_, _, _, err := parseDumpArgs(tt.args)
 			if err == nil {
 				t.Error("parseDumpArgs should fail with invalid args")
 			}
@@ -181,3 +181,64 @@ func extractFieldValue(output, field string) string {
 	}
 	return ""
 }
+
+func TestDump_HashOffsetAndTree(t *testing.T) {
+	image := utils.MakeTempFile(t, 4096*16)
+	defer os.Remove(image)
+
+	params := verity.DefaultVerityParams()
+	params.DataBlocks = 16
+	params.DataBlockSize = 4096
+	params.HashBlockSize = 4096
+	params.HashAreaOffset = 4096 * 16
+	params.UUID = [16]byte{1}
+	if _, err := verity.VerityCreate(&params, image, image); err != nil {
+		t.Fatalf("VerityCreate failed: %v", err)
+	}
+
+	if err := runDump(image, nil, false); err == nil {
+		t.Error("dump without --hash-offset should not find the superblock")
+	}
+
+	path, p, tree, err := parseDumpArgs([]string{"--hash-offset", "65536", "--tree", image})
+	if err != nil {
+		t.Fatalf("parseDumpArgs failed: %v", err)
+	}
+	if path != image || p == nil || p.HashAreaOffset != 65536 || !tree {
+		t.Errorf("unexpected parse result: %s %+v %v", path, p, tree)
+	}
+	if err := runDump(path, p, tree); err != nil {
+		t.Errorf("runDump failed: %v", err)
+	}
+
+	out, _ := utils.RunGoCLI(t, "dump", "--hash-offset", "65536", "--tree", image)
+	if !strings.Contains(out, "Data blocks:     \t16") || !strings.Contains(out, "Level 0:         \toffset 69632, 1 blocks") {
+		t.Errorf("unexpected dump output:\n%s", out)
+	}
+}
+
+func TestDump_NoSuperblockFlags(t *testing.T) {
+	data := utils.MakeTempFile(t, 4096*16)
+	hash := utils.MakeTempFile(t, 0)
+	defer os.Remove(data)
+	defer os.Remove(hash)
+
+	utils.RunGoCLI(t, "format", "--no-superblock", "--salt", "0102", data, hash)
+
+	out, _ := utils.RunGoCLI(t, "dump", "--no-superblock", "--data-blocks", "16", "--salt", "0102", hash)
+	if !strings.Contains(out, "Salt:            \t0102") || !strings.Contains(out, "Hash blocks:     \t1") {
+		t.Errorf("unexpected dump output:\n%s", out)
+	}
+
+	invalid := [][]string{
+		{"--no-superblock", hash},
+		{"--salt", "0102", hash},
+		{"--data-blocks", "16", hash},
+		{"--no-superblock", "--data-blocks", "16", "--hash-offset", "100", hash},
+	}
+	for _, args := range invalid {
+		if _, _, _, err := parseDumpArgs(args); err == nil {
+			t.Errorf("parseDumpArgs(%v): expected error", args)
+		}
+	}
+}
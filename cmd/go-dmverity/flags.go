@@ -39,17 +39,24 @@ type CommonFlags struct {
 }
 
 func defaultFlags(fs *flag.FlagSet) *CommonFlags {
+	flags := prefixedFlags(fs, "")
+	flags.RootHashSig = fs.String("root-hash-signature", "", "Path to root hash signature file")
+	return flags
+}
+
+// prefixedFlags registers the parameter flags under prefix, for commands
+// that take two sets of parameters. RootHashSig is left unset.
+func prefixedFlags(fs *flag.FlagSet, prefix string) *CommonFlags {
 	return &CommonFlags{
-		HashName:      fs.String("hash", "", "hash algorithm"),
-		DataBlockSize: fs.Uint("data-block-size", 0, "data block size in bytes"),
-		HashBlockSize: fs.Uint("hash-block-size", 0, "hash block size in bytes"),
-		SaltHex:       fs.String("salt", "", "salt as hex string or '-' for none"),
-		DataBlocks:    fs.Uint64("data-blocks", 0, "number of data blocks (override file size)"),
-		NoSuper:       fs.Bool("no-superblock", false, "omit/ignore verity superblock"),
-		HashOffset:    fs.Uint64("hash-offset", 0, "hash area offset when no superblock"),
-		UUIDStr:       fs.String("uuid", "", "UUID (RFC4122)"),
-		FormatType:    fs.Uint("format", 1, "Format type (1 - normal, 0 - original Chrome OS)"),
-		RootHashSig:   fs.String("root-hash-signature", "", "Path to root hash signature file"),
+		HashName:      fs.String(prefix+"hash", "", "hash algorithm"),
+		DataBlockSize: fs.Uint(prefix+"data-block-size", 0, "data block size in bytes"),
+		HashBlockSize: fs.Uint(prefix+"hash-block-size", 0, "hash block size in bytes"),
+		SaltHex:       fs.String(prefix+"salt", "", "salt as hex string or '-' for none"),
+		DataBlocks:    fs.Uint64(prefix+"data-blocks", 0, "number of data blocks (override file size)"),
+		NoSuper:       fs.Bool(prefix+"no-superblock", false, "omit/ignore verity superblock"),
+		HashOffset:    fs.Uint64(prefix+"hash-offset", 0, "hash area offset when no superblock"),
+		UUIDStr:       fs.String(prefix+"uuid", "", "UUID (RFC4122)"),
+		FormatType:    fs.Uint(prefix+"format", 1, "Format type (1 - normal, 0 - original Chrome OS)"),
 	}
 }
 
@@ -89,3 +96,21 @@ func applyFlags(p *verity.VerityParams, flags *CommonFlags) {
 		p.HashName = strings.ToLower(*flags.HashName)
 	}
 }
+
+// hasFlag reports whether args contain the named flag before the first
+// positional argument terminator.
+func hasFlag(args []string, name string) bool {
+	for _, arg := range args {
+		if arg == "--" {
+			return false
+		}
+		trimmed := strings.TrimLeft(arg, "-")
+		if trimmed == arg {
+			continue
+		}
+		if trimmed == name || strings.HasPrefix(trimmed, name+"=") {
+			return true
+		}
+	}
+	return false
+}
@@ -31,6 +31,24 @@ import (
 )
 
 func runFormat(p *verity.VerityParams, dataPath, hashPath string) error {
+	rootHash, err := createHashDevice(p, dataPath, hashPath)
+	if err != nil {
+		return err
+	}
+	return printFormatResult(p, hashPath, rootHash)
+}
+
+// createHashDevice creates hashPath if needed and builds the hash tree.
+func createHashDevice(p *verity.VerityParams, dataPath, hashPath string) ([]byte, error) {
+	if err := prepareHashDevice(p, hashPath); err != nil {
+		return nil, err
+	}
+	return verity.VerityCreate(p, dataPath, hashPath)
+}
+
+// prepareHashDevice creates hashPath if needed and places the hash area
+// after the superblock.
+func prepareHashDevice(p *verity.VerityParams, hashPath string) error {
 	if !p.NoSuperblock && p.HashAreaOffset == 0 {
 		p.HashAreaOffset = utils.AlignUp(uint64(verity.VeritySuperblockSize), uint64(p.HashBlockSize))
 	}
@@ -44,46 +62,44 @@ func runFormat(p *verity.VerityParams, dataPath, hashPath string) error {
 	} else if err != nil {
 		return fmt.Errorf("stat hash path %s: %w", hashPath, err)
 	}
+	return nil
+}
 
-	rootHash, err := verity.VerityCreate(p, dataPath, hashPath)
-	if err != nil {
-		return err
-	}
-	hashSize := utils.SelectHashSize(p.HashName)
-	if hashSize <= 0 {
-		return fmt.Errorf("unsupported hash algorithm: %s", p.HashName)
-	}
-	hashPerBlockBits := utils.GetBitsDown(p.HashBlockSize / uint32(hashSize))
-	if hashPerBlockBits == 0 {
-		return fmt.Errorf("hash block size %d is too small for hash size %d", p.HashBlockSize, hashSize)
-	}
-	hashesPerBlock := uint32(1 << hashPerBlockBits)
+// formatResult is printed by every format variant. The optional fields are
+// only set by the variants that produce them.
+type formatResult struct {
+	verity.VerityInfo
+	Manifest            string `json:"manifest,omitempty"`
+	DataPartitionUUID   string `json:"data_partition_uuid,omitempty"`
+	VerityPartitionUUID string `json:"verity_partition_uuid,omitempty"`
 
-	var totalHashBlocks uint64
-	remaining := p.DataBlocks
-	for remaining > 1 {
-		numBlocks := (remaining + uint64(hashesPerBlock) - 1) / uint64(hashesPerBlock)
-		totalHashBlocks += numBlocks
-		remaining = numBlocks
-	}
+	appended bool
+}
 
-	hashDeviceSize := totalHashBlocks * uint64(p.HashBlockSize)
-	if !p.NoSuperblock {
-		hashDeviceSize += utils.AlignUp(uint64(verity.VeritySuperblockSize), uint64(p.HashBlockSize))
+// newFormatResult describes the hash device just written.
+func newFormatResult(p *verity.VerityParams, hashPath string, rootHash []byte) (*formatResult, error) {
+	info, err := verity.ParamsInfo(hashPath, p)
+	if err != nil {
+		return nil, err
 	}
+	info.RootHash = rootHash
+	return &formatResult{VerityInfo: *info}, nil
+}
 
+func (r *formatResult) printText() {
+	p := &r.Params
 	var uuidStr string
 	if p.UUID != ([16]byte{}) {
 		uuidFromBytes, _ := uuid.FromBytes(p.UUID[:])
 		uuidStr = uuidFromBytes.String()
 	}
 
-	fmt.Printf("VERITY header information for %s\n", hashPath)
+	fmt.Printf("VERITY header information for %s\n", r.Path)
 	fmt.Printf("UUID:                   %s\n", uuidStr)
 	fmt.Printf("Format:                 %d\n", p.HashType)
 	fmt.Printf("Data blocks:            %d\n", p.DataBlocks)
 	fmt.Printf("Data block size:        %d\n", p.DataBlockSize)
-	fmt.Printf("Hash blocks:            %d\n", totalHashBlocks)
+	fmt.Printf("Hash blocks:            %d\n", r.HashBlocks)
 	fmt.Printf("Hash block size:        %d\n", p.HashBlockSize)
 	fmt.Printf("Hash algorithm:         %s\n", strings.ToLower(p.HashName))
 	saltStr := "-"
@@ -91,9 +107,26 @@ func runFormat(p *verity.VerityParams, dataPath, hashPath string) error {
 		saltStr = hex.EncodeToString(p.Salt)
 	}
 	fmt.Printf("Salt:                   %s\n", saltStr)
-	fmt.Printf("Root hash:              %s\n", hex.EncodeToString(rootHash))
-	fmt.Printf("Hash device size:       %d [bytes]\n", hashDeviceSize)
-	return nil
+	fmt.Printf("Root hash:              %s\n", hex.EncodeToString(r.RootHash))
+	fmt.Printf("Hash device size:       %d [bytes]\n", r.HashDeviceSize)
+	if r.appended {
+		fmt.Printf("Hash offset:            %d\n", p.HashAreaOffset)
+	}
+	if r.DataPartitionUUID != "" {
+		fmt.Printf("Data partition UUID:    %s\n", r.DataPartitionUUID)
+		fmt.Printf("Verity partition UUID:  %s\n", r.VerityPartitionUUID)
+	}
+	if r.Manifest != "" {
+		fmt.Printf("Manifest:               %s\n", r.Manifest)
+	}
+}
+
+func printFormatResult(p *verity.VerityParams, hashPath string, rootHash []byte) error {
+	res, err := newFormatResult(p, hashPath, rootHash)
+	if err != nil {
+		return err
+	}
+	return emit(res, res.printText)
 }
 
 func parseFormatArgs(args []string) (*verity.VerityParams, string, string, error) {
@@ -101,10 +134,14 @@ func parseFormatArgs(args []string) (*verity.VerityParams, string, string, error
 	fs.SetOutput(os.Stderr)
 
 	flags := defaultFlags(fs)
+	return parseFormatFlagSet(fs, flags, args)
+}
 
-	*flags.HashName = "sha256"
-	*flags.DataBlockSize = 4096
-	*flags.HashBlockSize = 4096
+// parseFormatFlagSet parses the positional arguments and flags shared by the
+// format variants that take a data and a hash path.
+func parseFormatFlagSet(fs *flag.FlagSet, flags *CommonFlags, args []string) (*verity.VerityParams, string, string, error) {
+	setFormatDefaults(flags)
+	directIO := fs.Bool("direct-io", false, "bypass the page cache when reading and writing the devices")
 
 	if err := fs.Parse(args); err != nil {
 		return nil, "", "", err
@@ -117,6 +154,24 @@ func parseFormatArgs(args []string) (*verity.VerityParams, string, string, error
 	dataPath := rest[0]
 	hashPath := rest[1]
 
+	p, err := formatParams(flags, dataPath, hashPath)
+	if err != nil {
+		return nil, "", "", err
+	}
+	p.DirectIO = *directIO
+	return p, dataPath, hashPath, nil
+}
+
+// setFormatDefaults sets the format defaults of flags before parsing.
+func setFormatDefaults(flags *CommonFlags) {
+	*flags.HashName = "sha256"
+	*flags.DataBlockSize = 4096
+	*flags.HashBlockSize = 4096
+}
+
+// formatParams builds the params of a new hash tree of dataPath from the
+// parsed format flags.
+func formatParams(flags *CommonFlags, dataPath, hashPath string) (*verity.VerityParams, error) {
 	p := verity.DefaultVerityParams()
 
 	applyFlags(&p, flags)
@@ -132,16 +187,16 @@ func parseFormatArgs(args []string) (*verity.VerityParams, string, string, error
 	}
 
 	if err := validateAndApplyBlockSizes(&p, flags); err != nil {
-		return nil, "", "", err
+		return nil, err
 	}
 
 	if err := utils.ValidateHashOffset(p.HashAreaOffset, p.HashBlockSize, p.NoSuperblock); err != nil {
-		return nil, "", "", err
+		return nil, err
 	}
 
 	salt, saltSize, err := utils.ApplySalt(*flags.SaltHex, int(verity.MaxSaltSize))
 	if err != nil {
-		return nil, "", "", err
+		return nil, err
 	}
 	p.Salt = salt
 	p.SaltSize = saltSize
@@ -150,19 +205,19 @@ func parseFormatArgs(args []string) (*verity.VerityParams, string, string, error
 		return uuid.New().String(), nil
 	})
 	if err != nil {
-		return nil, "", "", err
+		return nil, err
 	}
 	p.UUID = uuid
 
 	dataBlocks, err := utils.CalculateDataBlocks(dataPath, *flags.DataBlocks, p.DataBlockSize)
 	if err != nil {
-		return nil, "", "", err
+		return nil, err
 	}
 	p.DataBlocks = dataBlocks
 
 	if err := utils.ValidateDataHashOverlap(p.DataBlocks, p.DataBlockSize, p.HashAreaOffset, dataPath, hashPath); err != nil {
-		return nil, "", "", err
+		return nil, err
 	}
 
-	return &p, dataPath, hashPath, nil
+	return &p, nil
 }
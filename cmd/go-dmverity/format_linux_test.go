@@ -17,6 +17,7 @@
 package main
 
 import (
+	"bytes"
 	"os"
 	"os/exec"
 	"strings"
@@ -140,6 +141,71 @@ func TestFormat_WithUUID(t *testing.T) {
 	}
 }
 
+func TestFormat_DirectIO(t *testing.T) {
+	data := utils.MakeTempFile(t, 4096*300)
+	buffered := utils.MakeTempFile(t, 0)
+	direct := utils.MakeTempFile(t, 0)
+	defer os.Remove(data)
+	defer os.Remove(buffered)
+	defer os.Remove(direct)
+
+	p, _, _, err := parseFormatArgs([]string{"--direct-io", data, direct})
+	if err != nil {
+		t.Fatalf("parseFormatArgs failed: %v", err)
+	}
+	if !p.DirectIO {
+		t.Error("expected --direct-io to set DirectIO")
+	}
+	if _, _, _, err := parseFormatAlsoArgs([]string{"--direct-io", "--also", "path=" + buffered, data, direct}); err == nil {
+		t.Error("expected --direct-io to be rejected with --also")
+	}
+
+	testUUID := "12345678-1234-1234-1234-123456789abc"
+	out, _ := utils.RunGoCLI(t, "format", "--uuid", testUUID, data, buffered)
+	rootHex := utils.ExtractRootHex(t, out)
+	out, _ = utils.RunGoCLI(t, "format", "--direct-io", "--uuid", testUUID, data, direct)
+	if got := utils.ExtractRootHex(t, out); got != rootHex {
+		t.Errorf("root hash with --direct-io %s, want %s", got, rootHex)
+	}
+
+	want, err := os.ReadFile(buffered)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(direct)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Error("hash file written with --direct-io differs")
+	}
+
+	utils.RunGoCLI(t, "verify", "--direct-io", data, direct, rootHex)
+}
+
+func TestFormat_HashAlgorithms(t *testing.T) {
+	data := utils.MakeTempFile(t, 4096*64)
+	defer os.Remove(data)
+
+	for _, name := range []string{"sha384", "sha3-256", "blake2b-256"} {
+		hash := utils.MakeTempFile(t, 0)
+		defer os.Remove(hash)
+
+		out, _ := utils.RunGoCLI(t, "format", "--hash", name, data, hash)
+		rootHex := utils.ExtractRootHex(t, out)
+		utils.RunGoCLI(t, "verify", data, hash, rootHex)
+	}
+
+	p, dataPath, hashPath, err := parseFormatArgs([]string{"--hash", "no-such-hash", data, data + ".hash"})
+	if err != nil {
+		t.Fatalf("parseFormatArgs failed: %v", err)
+	}
+	defer os.Remove(hashPath)
+	if err := runFormat(p, dataPath, hashPath); err == nil {
+		t.Error("expected format to reject an unknown hash algorithm")
+	}
+}
+
 func TestParseFormatArgs_InvalidBlockSize(t *testing.T) {
 	tests := []struct {
 		name string
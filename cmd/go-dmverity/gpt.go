@@ -0,0 +1,287 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"github.com/containerd/go-dmverity/pkg/dm"
+	"github.com/containerd/go-dmverity/pkg/gpt"
+	"github.com/containerd/go-dmverity/pkg/utils"
+	verity "github.com/containerd/go-dmverity/pkg/verity"
+)
+
+func readGPT(diskPath string) (*gpt.Table, error) {
+	f, err := os.Open(diskPath)
+	if err != nil {
+		return nil, fmt.Errorf("open disk %s: %w", diskPath, err)
+	}
+	defer f.Close()
+
+	size, err := utils.GetBlockOrFileSize(diskPath)
+	if err != nil {
+		return nil, fmt.Errorf("determine disk size: %w", err)
+	}
+
+	return gpt.Read(f, size)
+}
+
+func checkVerityPairTypes(data, hash gpt.Partition) error {
+	pairs := gpt.NativeVerityPairs()
+	if len(pairs) == 0 {
+		return nil
+	}
+	for _, pair := range pairs {
+		if pair.Data == data.Type && pair.Verity == hash.Type {
+			return nil
+		}
+	}
+	return fmt.Errorf("partition types %s/%s are not a root or usr verity pair for %s", data.Type, hash.Type, runtime.GOARCH)
+}
+
+func parseOpenGPTArgs(args []string) (string, string, []byte, string, error) {
+	fs := flag.NewFlagSet("open", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+
+	fs.Bool("gpt", false, "activate discoverable partitions from a GPT disk")
+	rootHashSig := fs.String("root-hash-signature", "", "Path to root hash signature file")
+
+	if err := fs.Parse(args); err != nil {
+		return "", "", nil, "", err
+	}
+
+	rest := fs.Args()
+	if len(rest) != 3 {
+		return "", "", nil, "", errors.New("require <disk> <name> <root_hash>")
+	}
+	diskPath := rest[0]
+	name := rest[1]
+
+	if strings.TrimSpace(name) == "" {
+		return "", "", nil, "", fmt.Errorf("device name is required")
+	}
+	if strings.Contains(name, "/") {
+		return "", "", nil, "", fmt.Errorf("device name must not contain '/' characters")
+	}
+	if len(name) >= dm.DMNameLen {
+		return "", "", nil, "", fmt.Errorf("device name too long (max %d characters)", dm.DMNameLen-1)
+	}
+
+	rootBytes, err := utils.ParseRootHash(rest[2])
+	if err != nil {
+		return "", "", nil, "", err
+	}
+
+	return diskPath, name, rootBytes, *rootHashSig, nil
+}
+
+func runOpenGPT(diskPath, name string, rootDigest []byte, signatureFile string) error {
+	dataUUID, verityUUID, err := gpt.PartitionUUIDsFromRootHash(rootDigest)
+	if err != nil {
+		return err
+	}
+
+	tbl, err := readGPT(diskPath)
+	if err != nil {
+		return err
+	}
+
+	dataPart, ok := tbl.FindByUUID(dataUUID)
+	if !ok {
+		return fmt.Errorf("no data partition with UUID %s on %s", dataUUID, diskPath)
+	}
+	hashPart, ok := tbl.FindByUUID(verityUUID)
+	if !ok {
+		return fmt.Errorf("no verity partition with UUID %s on %s", verityUUID, diskPath)
+	}
+	if err := checkVerityPairTypes(dataPart, hashPart); err != nil {
+		return err
+	}
+
+	dataLoop, cleanup, err := utils.SetupLoopDeviceRange(diskPath, dataPart.Offset(tbl.SectorSize), dataPart.Size(tbl.SectorSize), true)
+	if err != nil {
+		return fmt.Errorf("setup data loop device: %w", err)
+	}
+	defer cleanup()
+
+	hashLoop, cleanupHash, err := utils.SetupLoopDeviceRange(diskPath, hashPart.Offset(tbl.SectorSize), hashPart.Size(tbl.SectorSize), true)
+	if err != nil {
+		return fmt.Errorf("setup hash loop device: %w", err)
+	}
+	defer cleanupHash()
+
+	p := &verity.VerityParams{}
+	devPath, err := verity.VerityOpen(p, name, dataLoop, hashLoop, rootDigest, signatureFile, nil)
+	if err != nil {
+		return err
+	}
+
+	return printOpenResult(name, devPath)
+}
+
+func parseFormatGPTArgs(args []string) (*verity.VerityParams, string, error) {
+	fs := flag.NewFlagSet("format", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+
+	flags := defaultFlags(fs)
+	fs.Bool("gpt", false, "format discoverable partitions on a GPT disk")
+
+	setFormatDefaults(flags)
+
+	if err := fs.Parse(args); err != nil {
+		return nil, "", err
+	}
+
+	rest := fs.Args()
+	if len(rest) != 1 {
+		return nil, "", errors.New("require <disk>")
+	}
+	if *flags.NoSuper || *flags.HashOffset != 0 {
+		return nil, "", errors.New("--gpt requires a superblock at the start of the verity partition")
+	}
+
+	p := verity.DefaultVerityParams()
+	applyFlags(&p, flags)
+
+	if err := validateAndApplyBlockSizes(&p, flags); err != nil {
+		return nil, "", err
+	}
+
+	salt, saltSize, err := utils.ApplySalt(*flags.SaltHex, int(verity.MaxSaltSize))
+	if err != nil {
+		return nil, "", err
+	}
+	p.Salt = salt
+	p.SaltSize = saltSize
+
+	uuid, err := utils.ApplyUUID(*flags.UUIDStr, true, false, func() (string, error) {
+		return uuid.New().String(), nil
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	p.UUID = uuid
+	p.DataBlocks = *flags.DataBlocks
+
+	return &p, rest[0], nil
+}
+
+func findVerityPartitions(tbl *gpt.Table) (gpt.Partition, gpt.Partition, error) {
+	pairs := gpt.NativeVerityPairs()
+	if len(pairs) == 0 {
+		return gpt.Partition{}, gpt.Partition{}, fmt.Errorf("no discoverable partition types known for %s", runtime.GOARCH)
+	}
+
+	var found [][2]gpt.Partition
+	for _, pair := range pairs {
+		data := tbl.FindByType(pair.Data)
+		hash := tbl.FindByType(pair.Verity)
+		if len(data) == 0 && len(hash) == 0 {
+			continue
+		}
+		if len(data) != 1 || len(hash) != 1 {
+			return gpt.Partition{}, gpt.Partition{}, fmt.Errorf("expected one %s data and one %s verity partition, found %d and %d",
+				pair.Name, pair.Name, len(data), len(hash))
+		}
+		found = append(found, [2]gpt.Partition{data[0], hash[0]})
+	}
+
+	if len(found) != 1 {
+		return gpt.Partition{}, gpt.Partition{}, fmt.Errorf("expected exactly one root or usr verity partition pair, found %d", len(found))
+	}
+	return found[0][0], found[0][1], nil
+}
+
+func runFormatGPT(p *verity.VerityParams, diskPath string) error {
+	tbl, err := readGPT(diskPath)
+	if err != nil {
+		return err
+	}
+
+	dataPart, hashPart, err := findVerityPartitions(tbl)
+	if err != nil {
+		return err
+	}
+
+	dataLoop, cleanup, err := utils.SetupLoopDeviceRange(diskPath, dataPart.Offset(tbl.SectorSize), dataPart.Size(tbl.SectorSize), false)
+	if err != nil {
+		return fmt.Errorf("setup data loop device: %w", err)
+	}
+	defer cleanup()
+
+	hashLoop, cleanupHash, err := utils.SetupLoopDeviceRange(diskPath, hashPart.Offset(tbl.SectorSize), hashPart.Size(tbl.SectorSize), false)
+	if err != nil {
+		return fmt.Errorf("setup hash loop device: %w", err)
+	}
+	defer cleanupHash()
+
+	dataBlocks, err := utils.CalculateDataBlocks(dataLoop, p.DataBlocks, p.DataBlockSize)
+	if err != nil {
+		return err
+	}
+	p.DataBlocks = dataBlocks
+	p.HashAreaOffset = utils.AlignUp(uint64(verity.VeritySuperblockSize), uint64(p.HashBlockSize))
+
+	treeSize, err := verity.GetHashTreeSize(p)
+	if err != nil {
+		return err
+	}
+	if need := p.HashAreaOffset + treeSize; need > hashPart.Size(tbl.SectorSize) {
+		return fmt.Errorf("verity partition %d too small: need %d bytes, have %d", hashPart.Index, need, hashPart.Size(tbl.SectorSize))
+	}
+
+	rootHash, err := verity.VerityCreate(p, dataLoop, hashLoop)
+	if err != nil {
+		return err
+	}
+
+	dataUUID, verityUUID, err := gpt.PartitionUUIDsFromRootHash(rootHash)
+	if err != nil {
+		return err
+	}
+
+	disk, err := os.OpenFile(diskPath, os.O_RDWR, 0)
+	if err != nil {
+		return fmt.Errorf("open disk %s: %w", diskPath, err)
+	}
+	defer disk.Close()
+
+	if err := gpt.SetPartitionUUID(disk, tbl, dataPart.Index, dataUUID); err != nil {
+		return err
+	}
+	if err := gpt.SetPartitionUUID(disk, tbl, hashPart.Index, verityUUID); err != nil {
+		return err
+	}
+	if err := disk.Sync(); err != nil {
+		return fmt.Errorf("sync disk %s: %w", diskPath, err)
+	}
+
+	res, err := newFormatResult(p, fmt.Sprintf("%s partition %d", diskPath, hashPart.Index), rootHash)
+	if err != nil {
+		return err
+	}
+	res.DataPartitionUUID = dataUUID.String()
+	res.VerityPartitionUUID = verityUUID.String()
+	return emit(res, res.printText)
+}
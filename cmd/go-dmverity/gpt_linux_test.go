@@ -0,0 +1,96 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/containerd/go-dmverity/pkg/utils"
+)
+
+func TestHasFlag(t *testing.T) {
+	tests := []struct {
+		args []string
+		want bool
+	}{
+		{[]string{"--gpt", "disk"}, true},
+		{[]string{"-gpt", "disk"}, true},
+		{[]string{"--gpt=true", "disk"}, true},
+		{[]string{"--gpt-extra", "disk"}, false},
+		{[]string{"disk", "gpt"}, false},
+		{[]string{"--", "--gpt"}, false},
+	}
+
+	for _, tt := range tests {
+		if got := hasFlag(tt.args, "gpt"); got != tt.want {
+			t.Errorf("hasFlag(%v) = %v, want %v", tt.args, got, tt.want)
+		}
+	}
+}
+
+func TestParseOpenGPTArgs(t *testing.T) {
+	root := strings.Repeat("ab", 32)
+
+	disk, name, rootBytes, _, err := parseOpenGPTArgs([]string{"--gpt", "disk.img", "root", root})
+	if err != nil {
+		t.Fatalf("parseOpenGPTArgs failed: %v", err)
+	}
+	if disk != "disk.img" || name != "root" || len(rootBytes) != 32 {
+		t.Errorf("unexpected result: %s %s %x", disk, name, rootBytes)
+	}
+
+	invalid := [][]string{
+		{"--gpt", "disk.img", "root"},
+		{"--gpt", "disk.img", "a/b", root},
+		{"--gpt", "disk.img", "root", "zz"},
+	}
+	for _, args := range invalid {
+		if _, _, _, _, err := parseOpenGPTArgs(args); err == nil {
+			t.Errorf("parseOpenGPTArgs(%v): expected error", args)
+		}
+	}
+}
+
+func TestParseFormatGPTArgs_InvalidArgs(t *testing.T) {
+	tests := [][]string{
+		{"--gpt"},
+		{"--gpt", "disk1", "disk2"},
+		{"--gpt", "--no-superblock", "disk"},
+		{"--gpt", "--data-block-size", "1000", "disk"},
+	}
+
+	for _, args := range tests {
+		if _, _, err := parseFormatGPTArgs(args); err == nil {
+			t.Errorf("parseFormatGPTArgs(%v): expected error", args)
+		}
+	}
+}
+
+func TestFormatGPT_NoPartitionTable(t *testing.T) {
+	disk := utils.MakeTempFile(t, 1<<20)
+	defer os.Remove(disk)
+
+	p, diskPath, err := parseFormatGPTArgs([]string{"--gpt", disk})
+	if err != nil {
+		t.Fatalf("parseFormatGPTArgs failed: %v", err)
+	}
+	if err := runFormatGPT(p, diskPath); err == nil {
+		t.Error("format --gpt should fail for a disk without GPT")
+	}
+}
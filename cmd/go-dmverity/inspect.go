@@ -0,0 +1,134 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/containerd/go-dmverity/pkg/utils"
+	verity "github.com/containerd/go-dmverity/pkg/verity"
+)
+
+func parseInspectBlockArgs(args []string) (*verity.VerityParams, string, string, uint64, []byte, error) {
+	fs := flag.NewFlagSet("inspect-block", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+
+	flags := defaultFlags(fs)
+	mf := addManifestFlags(fs)
+
+	if err := fs.Parse(args); err != nil {
+		return nil, "", "", 0, nil, err
+	}
+
+	m, err := mf.load(fs)
+	if err != nil {
+		return nil, "", "", 0, nil, err
+	}
+
+	rest := fs.Args()
+	if len(rest) != 3 && len(rest) != 4 {
+		return nil, "", "", 0, nil, errors.New("require <data_path> <hash_path> <block> [<root_hex>]")
+	}
+	dataPath, hashPath := rest[0], rest[1]
+	block, err := strconv.ParseUint(rest[2], 10, 64)
+	if err != nil {
+		return nil, "", "", 0, nil, fmt.Errorf("invalid block number %q", rest[2])
+	}
+	var rootHex string
+	if len(rest) == 4 {
+		rootHex = rest[3]
+	}
+
+	if m != nil {
+		rootBytes, err := manifestRootHash(m, rootHex)
+		if err != nil {
+			return nil, "", "", 0, nil, err
+		}
+		p := m.Params
+		return &p, dataPath, hashPath, block, rootBytes, nil
+	}
+
+	p, err := verifyParams(flags, dataPath, false)
+	if err != nil {
+		return nil, "", "", 0, nil, err
+	}
+
+	var rootBytes []byte
+	if rootHex != "" {
+		if rootBytes, err = utils.ParseRootHash(rootHex); err != nil {
+			return nil, "", "", 0, nil, err
+		}
+	}
+	return p, dataPath, hashPath, block, rootBytes, nil
+}
+
+type inspectResult struct {
+	*verity.BlockInspection
+	Diagnosis string `json:"diagnosis"`
+}
+
+// runInspectBlock prints the hash path of block and fails when any digest on
+// it does not match.
+func runInspectBlock(p *verity.VerityParams, dataPath, hashPath string, block uint64, rootDigest []byte) error {
+	bi, err := verity.InspectBlock(p, dataPath, hashPath, rootDigest, block)
+	if err != nil {
+		return err
+	}
+
+	res := inspectResult{BlockInspection: bi, Diagnosis: bi.Diagnosis()}
+	if err := emit(res, func() { printInspection(res) }); err != nil {
+		return err
+	}
+
+	intact := len(bi.RootHash) == 0 || bi.RootMatch
+	for _, l := range bi.Levels {
+		intact = intact && l.Match
+	}
+	if !intact {
+		return errors.New(res.Diagnosis)
+	}
+	return nil
+}
+
+func mismatchMark(match bool) string {
+	if match {
+		return ""
+	}
+	return "  MISMATCH"
+}
+
+func printInspection(res inspectResult) {
+	fmt.Printf("Block:                  %d\n", res.Block)
+	fmt.Printf("Data offset:            %d\n", res.DataOffset)
+	for _, l := range res.Levels {
+		fmt.Printf("Level %d digest at %d (hashes block at %d):\n", l.Level, l.Offset, l.ChildOffset)
+		fmt.Printf("  stored:               %s\n", l.Stored)
+		fmt.Printf("  computed:             %s%s\n", l.Computed, mismatchMark(l.Match))
+	}
+	fmt.Printf("Root hash:\n")
+	if len(res.RootHash) > 0 {
+		fmt.Printf("  expected:             %s\n", res.RootHash)
+		fmt.Printf("  computed:             %s%s\n", res.ComputedRoot, mismatchMark(res.RootMatch))
+	} else {
+		fmt.Printf("  computed:             %s\n", res.ComputedRoot)
+	}
+	fmt.Printf("Result:                 %s\n", res.Diagnosis)
+}
@@ -0,0 +1,85 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/containerd/go-dmverity/pkg/utils"
+)
+
+func TestParseInspectBlockArgs(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+	}{
+		{"missing block", []string{"data", "hash"}},
+		{"too many args", []string{"data", "hash", "1", "00", "extra"}},
+		{"invalid block", []string{"data", "hash", "abc"}},
+		{"invalid root", []string{"--no-superblock", "--data-blocks", "4", "data", "hash", "1", "zz"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, _, _, _, err := parseInspectBlockArgs(tt.args); err == nil {
+				t.Errorf("expected error for %v", tt.args)
+			}
+		})
+	}
+
+	_, _, _, block, root, err := parseInspectBlockArgs([]string{"--no-superblock", "--data-blocks", "4", "data", "hash", "3", "0102"})
+	if err != nil {
+		t.Fatalf("parseInspectBlockArgs failed: %v", err)
+	}
+	if block != 3 || len(root) != 2 {
+		t.Errorf("block = %d, root = %x", block, root)
+	}
+}
+
+func TestInspectBlock(t *testing.T) {
+	data := utils.MakeTempFile(t, 4096*16)
+	hash := utils.MakeTempFile(t, 0)
+	defer os.Remove(data)
+	defer os.Remove(hash)
+
+	out, _ := utils.RunGoCLI(t, "format", data, hash)
+	rootHex := utils.ExtractRootHex(t, out)
+
+	out, _ = utils.RunGoCLI(t, "inspect-block", data, hash, "5", rootHex)
+	if !strings.Contains(out, "hash path is intact") || strings.Contains(out, "MISMATCH") {
+		t.Errorf("unexpected inspect-block output:\n%s", out)
+	}
+
+	f, err := os.OpenFile(data, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteAt([]byte("corrupt"), 5*4096); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	p, dataPath, hashPath, block, root, err := parseInspectBlockArgs([]string{data, hash, "5", rootHex})
+	if err != nil {
+		t.Fatalf("parseInspectBlockArgs failed: %v", err)
+	}
+	err = runInspectBlock(p, dataPath, hashPath, block, root)
+	if err == nil || !strings.Contains(err.Error(), "data block 5 is corrupted") {
+		t.Errorf("expected a data block mismatch, got %v", err)
+	}
+}
@@ -31,9 +31,60 @@ func main() {
 		os.Exit(2)
 	}
 	cmd := os.Args[1]
+	args, format, err := splitOutputFlag(os.Args[2:])
+	if err != nil {
+		usage()
+		log.Fatalf("%s: %v", cmd, err)
+	}
+	outputFormat = format
+
 	switch cmd {
 	case "format":
-		p, dataPath, hashPath, err := parseFormatArgs(os.Args[2:])
+		if hasFlag(args, "gpt") {
+			p, diskPath, err := parseFormatGPTArgs(args)
+			if err != nil {
+				usage()
+				log.Fatalf("format: %v", err)
+			}
+			if err := runFormatGPT(p, diskPath); err != nil {
+				log.Fatalf("format: %v", err)
+			}
+			return
+		}
+		if hasFlag(args, "manifest") {
+			p, dataPath, hashPath, manifestPath, signingKey, err := parseFormatManifestArgs(args)
+			if err != nil {
+				usage()
+				log.Fatalf("format: %v", err)
+			}
+			if err := runFormatManifest(p, dataPath, hashPath, manifestPath, signingKey); err != nil {
+				log.Fatalf("format: %v", err)
+			}
+			return
+		}
+		if hasFlag(args, "append") {
+			p, path, err := parseFormatAppendArgs(args)
+			if err != nil {
+				usage()
+				log.Fatalf("format: %v", err)
+			}
+			if err := runFormatAppend(p, path); err != nil {
+				log.Fatalf("format: %v", err)
+			}
+			return
+		}
+		if hasFlag(args, "also") {
+			params, dataPath, hashPaths, err := parseFormatAlsoArgs(args)
+			if err != nil {
+				usage()
+				log.Fatalf("format: %v", err)
+			}
+			if err := runFormatAlso(params, dataPath, hashPaths); err != nil {
+				log.Fatalf("format: %v", err)
+			}
+			return
+		}
+		p, dataPath, hashPath, err := parseFormatArgs(args)
 		if err != nil {
 			usage()
 			log.Fatalf("format: %v", err)
@@ -42,7 +93,29 @@ func main() {
 			log.Fatalf("format: %v", err)
 		}
 	case "verify":
-		p, dataPath, hashPath, rootDigest, err := parseVerifyArgs(os.Args[2:])
+		if hasFlag(args, "avb") {
+			image, partition, err := parseVerifyAVBArgs(args)
+			if err != nil {
+				usage()
+				log.Fatalf("verify: %v", err)
+			}
+			if err := runVerifyAVB(image, partition); err != nil {
+				log.Fatalf("verify: %v", err)
+			}
+			return
+		}
+		if hasFlag(args, "sample") {
+			p, dataPath, hashPath, rootDigest, opts, err := parseVerifySampleArgs(args)
+			if err != nil {
+				usage()
+				log.Fatalf("verify: %v", err)
+			}
+			if err := runVerifySample(p, dataPath, hashPath, rootDigest, opts); err != nil {
+				log.Fatalf("verify: %v", err)
+			}
+			return
+		}
+		p, dataPath, hashPath, rootDigest, err := parseVerifyArgs(args)
 		if err != nil {
 			usage()
 			log.Fatalf("verify: %v", err)
@@ -51,7 +124,40 @@ func main() {
 			log.Fatalf("verify: %v", err)
 		}
 	case "open":
-		p, dataDev, name, hashDev, rootDigest, flags, signatureFile, err := parseOpenArgs(os.Args[2:])
+		if hasFlag(args, "gpt") {
+			diskPath, name, rootDigest, signatureFile, err := parseOpenGPTArgs(args)
+			if err != nil {
+				usage()
+				log.Fatalf("open: %v", err)
+			}
+			if err := runOpenGPT(diskPath, name, rootDigest, signatureFile); err != nil {
+				log.Fatalf("open: %v", err)
+			}
+			return
+		}
+		if hasFlag(args, "avb") {
+			image, name, partition, err := parseOpenAVBArgs(args)
+			if err != nil {
+				usage()
+				log.Fatalf("open: %v", err)
+			}
+			if err := runOpenAVB(image, name, partition); err != nil {
+				log.Fatalf("open: %v", err)
+			}
+			return
+		}
+		if hasFlag(args, "from-cmdline") {
+			kt, name, signatureFile, err := parseOpenCmdlineArgs(args)
+			if err != nil {
+				usage()
+				log.Fatalf("open: %v", err)
+			}
+			if err := runOpenCmdline(kt, name, signatureFile); err != nil {
+				log.Fatalf("open: %v", err)
+			}
+			return
+		}
+		p, dataDev, name, hashDev, rootDigest, flags, signatureFile, err := parseOpenArgs(args)
 		if err != nil {
 			usage()
 			log.Fatalf("open: %v", err)
@@ -64,7 +170,7 @@ func main() {
 			log.Fatalf("open: %v", err)
 		}
 	case "close":
-		name, err := parseCloseArgs(os.Args[2:])
+		name, err := parseCloseArgs(args)
 		if err != nil {
 			usage()
 			log.Fatalf("close: %v", err)
@@ -73,7 +179,7 @@ func main() {
 			log.Fatalf("close: %v", err)
 		}
 	case "status":
-		name, err := parseStatusArgs(os.Args[2:])
+		name, err := parseStatusArgs(args)
 		if err != nil {
 			usage()
 			log.Fatalf("status: %v", err)
@@ -81,15 +187,120 @@ func main() {
 		if err := runStatus(name); err != nil {
 			log.Fatalf("status: %v", err)
 		}
+	case "scrub":
+		name, opts, err := parseScrubArgs(args)
+		if err != nil {
+			usage()
+			log.Fatalf("scrub: %v", err)
+		}
+		if err := runScrub(name, opts); err != nil {
+			log.Fatalf("scrub: %v", err)
+		}
 	case "dump":
-		path, err := parseDumpArgs(os.Args[2:])
+		if hasFlag(args, "manifest") {
+			hashPath, m, tree, err := parseDumpManifestArgs(args)
+			if err != nil {
+				usage()
+				log.Fatalf("dump: %v", err)
+			}
+			if err := runDumpManifest(hashPath, m, tree); err != nil {
+				log.Fatalf("dump: %v", err)
+			}
+			return
+		}
+		path, p, tree, err := parseDumpArgs(args)
 		if err != nil {
 			usage()
 			log.Fatalf("dump: %v", err)
 		}
-		if err := runDump(path); err != nil {
+		if err := runDump(path, p, tree); err != nil {
 			log.Fatalf("dump: %v", err)
 		}
+	case "check-hash":
+		p, hashPath, rootDigest, err := parseCheckHashArgs(args)
+		if err != nil {
+			usage()
+			log.Fatalf("check-hash: %v", err)
+		}
+		if err := runCheckHash(p, hashPath, rootDigest); err != nil {
+			log.Fatalf("check-hash: %v", err)
+		}
+	case "rebuild-hash":
+		p, dataPath, hashPath, rootDigest, err := parseRebuildHashArgs(args)
+		if err != nil {
+			usage()
+			log.Fatalf("rebuild-hash: %v", err)
+		}
+		if err := runRebuildHash(p, dataPath, hashPath, rootDigest); err != nil {
+			log.Fatalf("rebuild-hash: %v", err)
+		}
+	case "update":
+		p, dataPath, hashPath, oldRoot, opts, err := parseUpdateArgs(args)
+		if err != nil {
+			usage()
+			log.Fatalf("update: %v", err)
+		}
+		if err := runUpdate(p, dataPath, hashPath, oldRoot, opts); err != nil {
+			log.Fatalf("update: %v", err)
+		}
+	case "convert":
+		p, hashPath, rootDigest, toSuperblock, err := parseConvertArgs(args)
+		if err != nil {
+			usage()
+			log.Fatalf("convert: %v", err)
+		}
+		if err := runConvert(p, hashPath, rootDigest, toSuperblock); err != nil {
+			log.Fatalf("convert: %v", err)
+		}
+	case "migrate":
+		oldP, newP, dataPath, oldHashPath, newHashPath, oldRoot, err := parseMigrateArgs(args)
+		if err != nil {
+			usage()
+			log.Fatalf("migrate: %v", err)
+		}
+		if err := runMigrate(oldP, newP, dataPath, oldHashPath, newHashPath, oldRoot); err != nil {
+			log.Fatalf("migrate: %v", err)
+		}
+	case "inspect-block":
+		p, dataPath, hashPath, block, rootDigest, err := parseInspectBlockArgs(args)
+		if err != nil {
+			usage()
+			log.Fatalf("inspect-block: %v", err)
+		}
+		if err := runInspectBlock(p, dataPath, hashPath, block, rootDigest); err != nil {
+			log.Fatalf("inspect-block: %v", err)
+		}
+	case "table":
+		p, dataDev, name, hashDev, rootDigest, opts, style, err := parseTableArgs(args)
+		if err != nil {
+			usage()
+			log.Fatalf("table: %v", err)
+		}
+		if err := runTable(p, dataDev, name, hashDev, rootDigest, opts, style); err != nil {
+			log.Fatalf("table: %v", err)
+		}
+	case "attach-all", "detach-all":
+		src, err := parseAttachArgs(cmd, args)
+		if err != nil {
+			usage()
+			log.Fatalf("%s: %v", cmd, err)
+		}
+		run := runAttachAll
+		if cmd == "detach-all" {
+			run = runDetachAll
+		}
+		if err := run(src); err != nil {
+			log.Fatalf("%s: %v", cmd, err)
+		}
+	case "benchmark":
+		params, size, dataSize, device, err := parseBenchmarkArgs(args)
+		if err != nil {
+			usage()
+			log.Fatalf("benchmark: %v", err)
+		}
+		if err := runBenchmark(params, size, dataSize, device); err != nil {
+			log.Fatalf("benchmark: %v", err)
+		}
 	case "-h", "--help", "help":
 		usage()
 	default:
@@ -101,12 +312,43 @@ func usage() {
 	prog := filepath.Base(os.Args[0])
 	fmt.Fprintf(os.Stderr, "Usage:\n")
 	fmt.Fprintf(os.Stderr, "  %s format [options] <data_path> <hash_path>\n", prog)
+	fmt.Fprintf(os.Stderr, "  %s format --gpt [options] <disk>\n", prog)
+	fmt.Fprintf(os.Stderr, "  %s format --append [options] <file>\n", prog)
+	fmt.Fprintf(os.Stderr, "  %s format --manifest <out.json> [options] <data_path> <hash_path>\n", prog)
+	fmt.Fprintf(os.Stderr, "  %s format [options] --also path=<hash_path>[,<option>=<value>...] <data_path> <hash_path>\n", prog)
 	fmt.Fprintf(os.Stderr, "  %s verify [options] <data_path> <hash_path> <root_hex>\n", prog)
+	fmt.Fprintf(os.Stderr, "  %s verify [options] <file> <root_hex>\n", prog)
+	fmt.Fprintf(os.Stderr, "  %s verify --manifest <in.json> <data_path> <hash_path> [<root_hex>]\n", prog)
+	fmt.Fprintf(os.Stderr, "  %s verify --sample <count|percent%%> [--seed <n>] [options] <data_path> <hash_path> <root_hex>\n", prog)
+	fmt.Fprintf(os.Stderr, "  %s verify --avb [--partition <name>] <image>\n", prog)
 	fmt.Fprintf(os.Stderr, "  %s open   [options] <data_dev> <name> <hash_dev> <root_hex>\n", prog)
+	fmt.Fprintf(os.Stderr, "  %s open   [options] <file> <name> <root_hex>\n", prog)
+	fmt.Fprintf(os.Stderr, "  %s open   --manifest <in.json> <data_dev> <name> <hash_dev> [<root_hex>]\n", prog)
+	fmt.Fprintf(os.Stderr, "  %s open   --gpt <disk> <name> <root_hex>\n", prog)
+	fmt.Fprintf(os.Stderr, "  %s open   --avb [--partition <name>] <image> <name>\n", prog)
+	fmt.Fprintf(os.Stderr, "  %s open   --from-cmdline <dm_table> [<name>]\n", prog)
 	fmt.Fprintf(os.Stderr, "  %s close  <name>\n", prog)
 	fmt.Fprintf(os.Stderr, "  %s status <name>\n", prog)
+	fmt.Fprintf(os.Stderr, "  %s scrub  [options] <name>\n", prog)
+	fmt.Fprintf(os.Stderr, "  %s dump   [options] [--tree] <hash_path>\n", prog)
+	fmt.Fprintf(os.Stderr, "  %s dump   --manifest <in.json> [--tree] <hash_path>\n", prog)
+	fmt.Fprintf(os.Stderr, "  %s check-hash [options] <hash_path> <root_hex>\n", prog)
+	fmt.Fprintf(os.Stderr, "  %s rebuild-hash [verify options] <data_path> <hash_path> <root_hex>\n", prog)
+	fmt.Fprintf(os.Stderr, "  %s rebuild-hash [verify options] <file> <root_hex>\n", prog)
+	fmt.Fprintf(os.Stderr, "  %s rebuild-hash --manifest <in.json> <data_path> <hash_path> [<root_hex>]\n", prog)
+	fmt.Fprintf(os.Stderr, "  %s update (--blocks <list>|--old-data <path>) [verify options] <data_path> <hash_path> <old_root_hex>\n", prog)
+	fmt.Fprintf(os.Stderr, "  %s update (--blocks <list>|--old-data <path>) [verify options] <file> <old_root_hex>\n", prog)
+	fmt.Fprintf(os.Stderr, "  %s convert --to <superblock|no-superblock> [options] <hash_path> <root_hex>\n", prog)
+	fmt.Fprintf(os.Stderr, "  %s migrate [verify options] [--new-<format option>...] <data_path> <old_hash_path> <old_root_hex> <new_hash_path>\n", prog)
+	fmt.Fprintf(os.Stderr, "  %s inspect-block [verify options] <data_path> <hash_path> <block> [<root_hex>]\n", prog)
+	fmt.Fprintf(os.Stderr, "  %s table  [options] <data_dev> <name> <hash_dev> <root_hex>\n", prog)
+	fmt.Fprintf(os.Stderr, "  %s attach-all [--veritytab <file>] [--cmdline <string>|--proc-cmdline]\n", prog)
+	fmt.Fprintf(os.Stderr, "  %s detach-all [--veritytab <file>] [--cmdline <string>|--proc-cmdline]\n", prog)
+	fmt.Fprintf(os.Stderr, "  %s benchmark [options] [<device>]\n", prog)
+	fmt.Fprintf(os.Stderr, "\nCommon options:\n")
+	fmt.Fprintf(os.Stderr, "  --output <text|json>               Output format (default text)\n")
 	fmt.Fprintf(os.Stderr, "\nFormat options:\n")
-	fmt.Fprintf(os.Stderr, "  --hash <sha1|sha256|sha512>        Hash algorithm (default sha256)\n")
+	fmt.Fprintf(os.Stderr, "  --hash <algorithm>                 Hash algorithm (default sha256; also sha3-*, blake2b-* or any kernel hash)\n")
 	fmt.Fprintf(os.Stderr, "  --data-block-size <bytes>          Data block size (default 4096)\n")
 	fmt.Fprintf(os.Stderr, "  --hash-block-size <bytes>          Hash block size (default 4096)\n")
 	fmt.Fprintf(os.Stderr, "  --format <0|1>                     Format type (1 - normal, 0 - original Chrome OS)\n")
@@ -115,8 +357,14 @@ func usage() {
 	fmt.Fprintf(os.Stderr, "  --data-blocks <n>                  Data blocks (override file size)\n")
 	fmt.Fprintf(os.Stderr, "  --no-superblock                    Do not write superblock\n")
 	fmt.Fprintf(os.Stderr, "  --hash-offset <bytes>              Hash area offset (when --no-superblock)\n")
+	fmt.Fprintf(os.Stderr, "  --gpt                              Format the root/usr verity partition pair of a GPT disk\n")
+	fmt.Fprintf(os.Stderr, "  --append                           Append the hash tree and a trailer to the data file\n")
+	fmt.Fprintf(os.Stderr, "  --manifest <file>                  Write parameters and root hash to a JSON manifest\n")
+	fmt.Fprintf(os.Stderr, "  --manifest-signing-key <file>      Sign the manifest with a PEM ed25519 private key\n")
+	fmt.Fprintf(os.Stderr, "  --also <spec>                      Also build the tree described by path=<hash_path>,<option>=<value>,... (repeatable)\n")
+	fmt.Fprintf(os.Stderr, "  --direct-io                        Bypass the page cache (falls back to buffered I/O if rejected)\n")
 	fmt.Fprintf(os.Stderr, "\nVerify options:\n")
-	fmt.Fprintf(os.Stderr, "  --hash <sha1|sha256|sha512>        Hash algorithm (default sha256)\n")
+	fmt.Fprintf(os.Stderr, "  --hash <algorithm>                 Hash algorithm (default sha256; also sha3-*, blake2b-* or any kernel hash)\n")
 	fmt.Fprintf(os.Stderr, "  --data-block-size <bytes>          Data block size (default 4096)\n")
 	fmt.Fprintf(os.Stderr, "  --hash-block-size <bytes>          Hash block size (default 4096)\n")
 	fmt.Fprintf(os.Stderr, "  --salt <hex|->                     Salt as hex or '-' (overrides superblock)\n")
@@ -124,8 +372,19 @@ func usage() {
 	fmt.Fprintf(os.Stderr, "  --no-superblock                    Hash file has no superblock\n")
 	fmt.Fprintf(os.Stderr, "  --hash-offset <bytes>              Hash area offset (when --no-superblock)\n")
 	fmt.Fprintf(os.Stderr, "  --uuid <uuid>                      UUID (ignored unless --no-superblock)\n")
+	fmt.Fprintf(os.Stderr, "  --manifest <file>                  Read parameters and root hash from a JSON manifest\n")
+	fmt.Fprintf(os.Stderr, "  --manifest-public-key <file>       Require a manifest signature by this PEM ed25519 public key\n")
+	fmt.Fprintf(os.Stderr, "  --direct-io                        Bypass the page cache (falls back to buffered I/O if rejected)\n")
+	fmt.Fprintf(os.Stderr, "  --max-bandwidth <bytes>            Read at most this many bytes per second\n")
+	fmt.Fprintf(os.Stderr, "  --max-iops <n>                     Issue at most this many reads per second\n")
+	fmt.Fprintf(os.Stderr, "  --resume <file>                    Save progress to a state file and resume from it after a restart\n")
+	fmt.Fprintf(os.Stderr, "  --checkpoint-interval <duration>   How often to save progress with --resume (default 10s)\n")
+	fmt.Fprintf(os.Stderr, "  --sample <count|percent%%>          Check only this many random data blocks against the root hash\n")
+	fmt.Fprintf(os.Stderr, "  --seed <n>                         Seed of the --sample block selection (default random)\n")
+	fmt.Fprintf(os.Stderr, "  --avb                              Use the image's AVB hashtree descriptor (signature not checked)\n")
+	fmt.Fprintf(os.Stderr, "  --partition <name>                 Hashtree descriptor to use with --avb\n")
 	fmt.Fprintf(os.Stderr, "\nOpen options (Linux only):\n")
-	fmt.Fprintf(os.Stderr, "  --hash <sha1|sha256|sha512>        Hash algorithm (default sha256)\n")
+	fmt.Fprintf(os.Stderr, "  --hash <algorithm>                 Hash algorithm (default sha256; also sha3-*, blake2b-* or any kernel hash)\n")
 	fmt.Fprintf(os.Stderr, "  --data-block-size <bytes>          Data block size (default 4096)\n")
 	fmt.Fprintf(os.Stderr, "  --hash-block-size <bytes>          Hash block size (default 4096)\n")
 	fmt.Fprintf(os.Stderr, "  --salt <hex|->                     Salt as hex or '-'\n")
@@ -133,4 +392,48 @@ func usage() {
 	fmt.Fprintf(os.Stderr, "  --no-superblock                    Hash device has no superblock\n")
 	fmt.Fprintf(os.Stderr, "  --hash-offset <bytes>              Hash area offset (when --no-superblock)\n")
 	fmt.Fprintf(os.Stderr, "  --root-hash-signature <file>       Path to root hash signature file\n")
+	fmt.Fprintf(os.Stderr, "  --gpt                              Find data and verity partitions on a GPT disk by root hash\n")
+	fmt.Fprintf(os.Stderr, "  --manifest <file>                  Read parameters and root hash from a JSON manifest\n")
+	fmt.Fprintf(os.Stderr, "  --manifest-public-key <file>       Require a manifest signature by this PEM ed25519 public key\n")
+	fmt.Fprintf(os.Stderr, "  --avb                              Use the image's AVB hashtree descriptor (signature not checked)\n")
+	fmt.Fprintf(os.Stderr, "  --partition <name>                 Hashtree descriptor to use with --avb\n")
+	fmt.Fprintf(os.Stderr, "  --from-cmdline <string>            Open the device described by a Chrome OS/Android dm= table\n")
+	fmt.Fprintf(os.Stderr, "\nScrub options (Linux only):\n")
+	fmt.Fprintf(os.Stderr, "  --offset <bytes>                   Start reading at this offset (default 0)\n")
+	fmt.Fprintf(os.Stderr, "  --length <bytes>                   Bytes to read (default to the end of the device)\n")
+	fmt.Fprintf(os.Stderr, "  --workers <n>                      Parallel readers (default one per CPU)\n")
+	fmt.Fprintf(os.Stderr, "  --direct-io=false                  Read through the page cache (cached blocks are not re-checked)\n")
+	fmt.Fprintf(os.Stderr, "\nDump and check-hash options:\n")
+	fmt.Fprintf(os.Stderr, "  --hash-offset <bytes>              Superblock offset (hash area offset with --no-superblock)\n")
+	fmt.Fprintf(os.Stderr, "  --no-superblock                    Describe the tree from --hash, --data-blocks and the other format options\n")
+	fmt.Fprintf(os.Stderr, "  --tree                             List the offset, block count and byte range of each tree level (dump only)\n")
+	fmt.Fprintf(os.Stderr, "  --manifest <file>                  Read parameters from a JSON manifest (dump only)\n")
+	fmt.Fprintf(os.Stderr, "\nConvert options (dump options, plus):\n")
+	fmt.Fprintf(os.Stderr, "  --to <superblock|no-superblock>    Layout to convert the hash file to (regular files only)\n")
+	fmt.Fprintf(os.Stderr, "  --uuid <uuid>                      UUID of the added superblock (default random)\n")
+	fmt.Fprintf(os.Stderr, "\nRebuild options (verify options, plus):\n")
+	fmt.Fprintf(os.Stderr, "  --tmpdir <dir>                     Scratch directory for the tree (default: next to a hash file, else $TMPDIR)\n")
+	fmt.Fprintf(os.Stderr, "\nUpdate options (verify options, plus):\n")
+	fmt.Fprintf(os.Stderr, "  --blocks <list>                    Changed data blocks, e.g. 1,5,10-20\n")
+	fmt.Fprintf(os.Stderr, "  --old-data <path>                  Find the changed blocks by comparing with the old data\n")
+	fmt.Fprintf(os.Stderr, "\nMigrate options (verify options for the old tree, plus):\n")
+	fmt.Fprintf(os.Stderr, "  --new-<format option>              Format option for the new tree, e.g. --new-hash sha256 --new-format 1\n")
+	fmt.Fprintf(os.Stderr, "\nTable options (open options, plus):\n")
+	fmt.Fprintf(os.Stderr, "  --device-format <fmt>              Device references: major-minor (default), partuuid or path\n")
+	fmt.Fprintf(os.Stderr, "  --dm-uuid <uuid>                   Device-mapper UUID for dm-mod.create= and dm=\n")
+	fmt.Fprintf(os.Stderr, "  --minor <n>                        Device-mapper minor number for dm-mod.create=\n")
+	fmt.Fprintf(os.Stderr, "  --style <all|dmsetup|dm-mod|chromeos> Output style (default all)\n")
+	fmt.Fprintf(os.Stderr, "\nBenchmark options:\n")
+	fmt.Fprintf(os.Stderr, "  --hash <a,b,...>                   Hash algorithms (default all registered)\n")
+	fmt.Fprintf(os.Stderr, "  --data-block-size <n,m,...>        Data block sizes (default 4096)\n")
+	fmt.Fprintf(os.Stderr, "  --hash-block-size <n,m,...>        Hash block sizes (default 4096)\n")
+	fmt.Fprintf(os.Stderr, "  --salt-size <n,m,...>              Salt sizes in bytes (default 32)\n")
+	fmt.Fprintf(os.Stderr, "  --format <0|1>                     Format type (default 1)\n")
+	fmt.Fprintf(os.Stderr, "  --size <bytes>                     In-memory data hashed per measurement (default 64 MiB)\n")
+	fmt.Fprintf(os.Stderr, "  --data-size <bytes>                Data size to project format/verify time for (default 1 GiB)\n")
+	fmt.Fprintf(os.Stderr, "  --direct-io                        Bypass the page cache when reading <device>\n")
+	fmt.Fprintf(os.Stderr, "\nAttach-all/detach-all options (Linux only):\n")
+	fmt.Fprintf(os.Stderr, "  --veritytab <file>                 veritytab file (default /etc/veritytab)\n")
+	fmt.Fprintf(os.Stderr, "  --cmdline <string>                 Kernel command line with roothash=/usrhash= parameters\n")
+	fmt.Fprintf(os.Stderr, "  --proc-cmdline                     Read roothash=/usrhash= parameters from /proc/cmdline\n")
 }
@@ -0,0 +1,234 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/containerd/go-dmverity/pkg/utils"
+	verity "github.com/containerd/go-dmverity/pkg/verity"
+)
+
+// paramFlags are the flags a manifest supplies; they cannot be combined with
+// --manifest.
+var paramFlags = map[string]bool{
+	"hash":            true,
+	"data-block-size": true,
+	"hash-block-size": true,
+	"salt":            true,
+	"data-blocks":     true,
+	"no-superblock":   true,
+	"hash-offset":     true,
+	"uuid":            true,
+	"format":          true,
+}
+
+type manifestFlags struct {
+	Path      *string
+	PublicKey *string
+}
+
+func addManifestFlags(fs *flag.FlagSet) *manifestFlags {
+	return &manifestFlags{
+		Path:      fs.String("manifest", "", "read verity parameters and root hash from a manifest"),
+		PublicKey: fs.String("manifest-public-key", "", "PEM ed25519 public key the manifest must be signed with"),
+	}
+}
+
+// load reads the manifest named by --manifest after fs has been parsed. It
+// returns nil when --manifest is not set.
+func (mf *manifestFlags) load(fs *flag.FlagSet) (*verity.Manifest, error) {
+	if *mf.Path == "" {
+		if *mf.PublicKey != "" {
+			return nil, errors.New("--manifest-public-key requires --manifest")
+		}
+		return nil, nil
+	}
+
+	var conflict string
+	fs.Visit(func(f *flag.Flag) {
+		if conflict == "" && paramFlags[f.Name] {
+			conflict = f.Name
+		}
+	})
+	if conflict != "" {
+		return nil, fmt.Errorf("--%s cannot be combined with --manifest", conflict)
+	}
+
+	m, err := verity.ReadManifestFile(*mf.Path)
+	if err != nil {
+		return nil, fmt.Errorf("read manifest %s: %w", *mf.Path, err)
+	}
+	if *mf.PublicKey != "" {
+		key, err := readPublicKey(*mf.PublicKey)
+		if err != nil {
+			return nil, err
+		}
+		if err := m.Verify(key); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// manifestRootHash returns the root hash of m, checking it against rootHex
+// when one was given on the command line.
+func manifestRootHash(m *verity.Manifest, rootHex string) ([]byte, error) {
+	if rootHex == "" {
+		return m.RootHash, nil
+	}
+	root, err := utils.ParseRootHash(rootHex)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(root, m.RootHash) {
+		return nil, fmt.Errorf("root hash %s does not match manifest root hash %s", rootHex, hex.EncodeToString(m.RootHash))
+	}
+	return root, nil
+}
+
+func readPEM(path string) ([]byte, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return nil, fmt.Errorf("%s: no PEM data found", path)
+	}
+	return block.Bytes, nil
+}
+
+func readSigningKey(path string) (ed25519.PrivateKey, error) {
+	der, err := readPEM(path)
+	if err != nil {
+		return nil, err
+	}
+	key, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	priv, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%s: not an ed25519 private key", path)
+	}
+	return priv, nil
+}
+
+func readPublicKey(path string) (ed25519.PublicKey, error) {
+	der, err := readPEM(path)
+	if err != nil {
+		return nil, err
+	}
+	key, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	pub, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("%s: not an ed25519 public key", path)
+	}
+	return pub, nil
+}
+
+func parseFormatManifestArgs(args []string) (*verity.VerityParams, string, string, string, string, error) {
+	fs := flag.NewFlagSet("format", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+
+	flags := defaultFlags(fs)
+	manifest := fs.String("manifest", "", "write the verity parameters and root hash to a manifest")
+	signingKey := fs.String("manifest-signing-key", "", "PEM PKCS#8 ed25519 private key to sign the manifest with")
+
+	p, dataPath, hashPath, err := parseFormatFlagSet(fs, flags, args)
+	if err != nil {
+		return nil, "", "", "", "", err
+	}
+	if *manifest == "" {
+		return nil, "", "", "", "", errors.New("--manifest requires an output path")
+	}
+	return p, dataPath, hashPath, *manifest, *signingKey, nil
+}
+
+func runFormatManifest(p *verity.VerityParams, dataPath, hashPath, manifestPath, signingKey string) error {
+	var key ed25519.PrivateKey
+	if signingKey != "" {
+		var err error
+		if key, err = readSigningKey(signingKey); err != nil {
+			return err
+		}
+	}
+
+	rootHash, err := createHashDevice(p, dataPath, hashPath)
+	if err != nil {
+		return err
+	}
+	res, err := newFormatResult(p, hashPath, rootHash)
+	if err != nil {
+		return err
+	}
+
+	m := verity.NewManifest(p, rootHash)
+	if key != nil {
+		if err := m.Sign(key); err != nil {
+			return err
+		}
+	}
+	if err := m.WriteFile(manifestPath); err != nil {
+		return fmt.Errorf("write manifest: %w", err)
+	}
+	res.Manifest = manifestPath
+	return emit(res, res.printText)
+}
+
+func parseDumpManifestArgs(args []string) (string, *verity.Manifest, bool, error) {
+	fs := flag.NewFlagSet("dump", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+
+	mf := addManifestFlags(fs)
+	tree := fs.Bool("tree", false, "list the offset and size of every hash tree level")
+	if err := fs.Parse(args); err != nil {
+		return "", nil, false, err
+	}
+	if fs.NArg() != 1 {
+		return "", nil, false, errors.New("dump requires exactly one argument: <hash_device>")
+	}
+	m, err := mf.load(fs)
+	if err != nil {
+		return "", nil, false, err
+	}
+	if m == nil {
+		return "", nil, false, errors.New("--manifest requires an input path")
+	}
+	return fs.Arg(0), m, *tree, nil
+}
+
+func runDumpManifest(hashPath string, m *verity.Manifest, tree bool) error {
+	info, err := verity.ParamsInfo(hashPath, &m.Params)
+	if err != nil {
+		return err
+	}
+	info.RootHash = m.RootHash
+	return printDumpInfo(info, tree)
+}
@@ -0,0 +1,124 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/containerd/go-dmverity/pkg/utils"
+	"github.com/containerd/go-dmverity/pkg/verity"
+)
+
+func writeTestKeys(t *testing.T, dir string) (string, string) {
+	t.Helper()
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	privDER, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pubDER, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	privPath := filepath.Join(dir, "key.pem")
+	pubPath := filepath.Join(dir, "pub.pem")
+	if err := os.WriteFile(privPath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(pubPath, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDER}), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return privPath, pubPath
+}
+
+func TestFormatManifest(t *testing.T) {
+	dir := t.TempDir()
+	data := utils.MakeTempFile(t, 4096*16)
+	defer os.Remove(data)
+	hash := filepath.Join(dir, "hash.img")
+	manifest := filepath.Join(dir, "verity.json")
+	privPath, pubPath := writeTestKeys(t, dir)
+
+	out, _ := utils.RunGoCLI(t, "format", "--no-superblock", "--salt", "0102", "--hash-offset", "4096",
+		"--manifest", manifest, "--manifest-signing-key", privPath, data, hash)
+	rootHex := utils.ExtractRootHex(t, out)
+
+	out, _ = utils.RunGoCLI(t, "verify", "--manifest", manifest, "--manifest-public-key", pubPath, data, hash)
+	if !strings.Contains(out, "Verification succeeded") {
+		t.Errorf("unexpected verify output:\n%s", out)
+	}
+
+	out, _ = utils.RunGoCLI(t, "dump", "--manifest", manifest, hash)
+	if !strings.Contains(out, "Salt:            \t0102") || !strings.Contains(out, rootHex) {
+		t.Errorf("unexpected dump output:\n%s", out)
+	}
+
+	p, _, _, root, err := parseVerifyArgs([]string{"--manifest", manifest, data, hash, rootHex})
+	if err != nil {
+		t.Fatalf("parseVerifyArgs failed: %v", err)
+	}
+	if !p.NoSuperblock || p.HashAreaOffset != 4096 || p.DataBlocks != 16 || len(root) != 32 {
+		t.Errorf("unexpected params from manifest: %+v", p)
+	}
+
+	p, _, name, _, _, _, _, err := parseOpenArgs([]string{"--manifest", manifest, data, "vdata", hash})
+	if err != nil {
+		t.Fatalf("parseOpenArgs failed: %v", err)
+	}
+	if name != "vdata" || p.HashAreaOffset != 4096 {
+		t.Errorf("unexpected open params from manifest: %s %+v", name, p)
+	}
+}
+
+func TestManifestArgErrors(t *testing.T) {
+	dir := t.TempDir()
+	_, pubPath := writeTestKeys(t, dir)
+	manifest := filepath.Join(dir, "verity.json")
+	params := verity.DefaultVerityParams()
+	params.DataBlockSize = 4096
+	params.HashBlockSize = 4096
+	params.DataBlocks = 1
+	params.NoSuperblock = true
+	if err := verity.NewManifest(&params, make([]byte, 32)).WriteFile(manifest); err != nil {
+		t.Fatal(err)
+	}
+
+	invalid := [][]string{
+		{"--manifest", manifest, "--salt", "-", "data", "hash"},
+		{"--manifest", manifest, "data"},
+		{"--manifest", manifest, "data", "hash", "ff"},
+		{"--manifest", manifest, "--manifest-public-key", pubPath, "data", "hash"},
+		{"--manifest-public-key", pubPath, "data", "hash", "ff"},
+	}
+	for _, args := range invalid {
+		if _, _, _, _, err := parseVerifyArgs(args); err == nil {
+			t.Errorf("parseVerifyArgs(%v): expected error", args)
+		}
+	}
+	if _, _, _, _, _, err := parseFormatManifestArgs([]string{"--manifest", "", "data", "hash"}); err == nil {
+		t.Error("parseFormatManifestArgs: expected error for empty manifest path")
+	}
+}
@@ -0,0 +1,165 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/containerd/go-dmverity/pkg/utils"
+	verity "github.com/containerd/go-dmverity/pkg/verity"
+)
+
+// parseMigrateArgs returns the complete params of the existing tree, read
+// from its superblock, a manifest or the verify flags, and the params of the
+// new tree from the --new-* format flags. Unless --new-data-blocks is given
+// the new tree covers the same bytes as the old one.
+func parseMigrateArgs(args []string) (*verity.VerityParams, *verity.VerityParams, string, string, string, []byte, error) {
+	fs := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+
+	flags := defaultFlags(fs)
+	newFlags := prefixedFlags(fs, "new-")
+	mf := addManifestFlags(fs)
+	setFormatDefaults(newFlags)
+
+	if err := fs.Parse(args); err != nil {
+		return nil, nil, "", "", "", nil, err
+	}
+
+	m, err := mf.load(fs)
+	if err != nil {
+		return nil, nil, "", "", "", nil, err
+	}
+
+	var oldP, newP *verity.VerityParams
+	var dataPath, oldHashPath, newHashPath string
+	var oldRoot []byte
+
+	rest := fs.Args()
+	switch {
+	case len(rest) == 4:
+		dataPath, oldHashPath, newHashPath = rest[0], rest[1], rest[3]
+	case len(rest) == 3 && m != nil:
+		dataPath, oldHashPath, newHashPath = rest[0], rest[1], rest[2]
+	default:
+		return nil, nil, "", "", "", nil, errors.New("require <data_path> <old_hash_path> <old_root_hex> <new_hash_path>")
+	}
+	if newHashPath == dataPath || newHashPath == oldHashPath {
+		return nil, nil, "", "", "", nil, errors.New("the new hash device must differ from the data and old hash devices")
+	}
+
+	if m != nil {
+		var rootHex string
+		if len(rest) == 4 {
+			rootHex = rest[2]
+		}
+		if oldRoot, err = manifestRootHash(m, rootHex); err != nil {
+			return nil, nil, "", "", "", nil, err
+		}
+		p := m.Params
+		oldP = &p
+	} else {
+		if oldRoot, err = utils.ParseRootHash(rest[2]); err != nil {
+			return nil, nil, "", "", "", nil, err
+		}
+		if oldP, err = verifyParams(flags, dataPath, false); err != nil {
+			return nil, nil, "", "", "", nil, err
+		}
+		if err := verity.InitParams(oldP, dataPath, oldHashPath); err != nil {
+			return nil, nil, "", "", "", nil, err
+		}
+	}
+
+	if *newFlags.DataBlocks == 0 && *newFlags.DataBlockSize != 0 {
+		oldSize := oldP.DataBlocks * uint64(oldP.DataBlockSize)
+		if oldSize%uint64(*newFlags.DataBlockSize) != 0 {
+			return nil, nil, "", "", "", nil, fmt.Errorf("old data size %d is not a multiple of the new data block size %d",
+				oldSize, *newFlags.DataBlockSize)
+		}
+		*newFlags.DataBlocks = oldSize / uint64(*newFlags.DataBlockSize)
+	}
+
+	if newP, err = formatParams(newFlags, dataPath, newHashPath); err != nil {
+		return nil, nil, "", "", "", nil, err
+	}
+
+	return oldP, newP, dataPath, oldHashPath, newHashPath, oldRoot, nil
+}
+
+type migrateResult struct {
+	DataPath string             `json:"data_path"`
+	Old      *verity.VerityInfo `json:"old"`
+	New      *verity.VerityInfo `json:"new"`
+}
+
+// runMigrate builds the new tree in the same read of the data that checks
+// the old one, so tampered data is never given a new root hash. A new hash
+// file created here is removed again when the old tree does not verify.
+func runMigrate(oldP, newP *verity.VerityParams, dataPath, oldHashPath, newHashPath string, oldRoot []byte) error {
+	if err := verity.ValidateRootHashSize(oldRoot, oldP.HashName); err != nil {
+		return err
+	}
+
+	_, statErr := os.Stat(newHashPath)
+	created := errors.Is(statErr, os.ErrNotExist)
+	if err := prepareHashDevice(newP, newHashPath); err != nil {
+		return err
+	}
+	newRoot, err := verity.VerityMigrate(oldP, newP, dataPath, oldHashPath, newHashPath, oldRoot)
+	if err != nil {
+		if created {
+			os.Remove(newHashPath)
+		}
+		return fmt.Errorf("new hash tree discarded: %w", err)
+	}
+	newInfo, err := newFormatResult(newP, newHashPath, newRoot)
+	if err != nil {
+		return err
+	}
+
+	oldInfo, err := verity.ParamsInfo(oldHashPath, oldP)
+	if err != nil {
+		return err
+	}
+	oldInfo.RootHash = oldRoot
+
+	res := migrateResult{DataPath: dataPath, Old: oldInfo, New: &newInfo.VerityInfo}
+	return emit(res, func() {
+		fmt.Printf("Data verified against the old root hash\n")
+		printMigrateSide("Old", res.Old)
+		printMigrateSide("New", res.New)
+	})
+}
+
+func printMigrateSide(side string, info *verity.VerityInfo) {
+	p := &info.Params
+	salt := "-"
+	if len(p.Salt) > 0 {
+		salt = verity.HexBytes(p.Salt).String()
+	}
+	fmt.Printf("%s hash device:        %s\n", side, info.Path)
+	fmt.Printf("  Format:               %d\n", p.HashType)
+	fmt.Printf("  Hash algorithm:       %s\n", p.HashName)
+	fmt.Printf("  Data blocks:          %d\n", p.DataBlocks)
+	fmt.Printf("  Data block size:      %d\n", p.DataBlockSize)
+	fmt.Printf("  Hash block size:      %d\n", p.HashBlockSize)
+	fmt.Printf("  Salt:                 %s\n", salt)
+	fmt.Printf("  Root hash:            %s\n", info.RootHash)
+}
@@ -0,0 +1,110 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/containerd/go-dmverity/pkg/utils"
+)
+
+func TestParseMigrateArgs(t *testing.T) {
+	dir := t.TempDir()
+	data := utils.MakeTempFile(t, 512*24)
+	defer os.Remove(data)
+	oldHash := filepath.Join(dir, "old.img")
+	newHash := filepath.Join(dir, "new.img")
+
+	out, _ := utils.RunGoCLI(t, "format", "--data-block-size", "512", "--hash-block-size", "512", data, oldHash)
+	rootHex := utils.ExtractRootHex(t, out)
+
+	oldP, newP, _, _, _, _, err := parseMigrateArgs([]string{"--new-hash", "sha512", data, oldHash, rootHex, newHash})
+	if err != nil {
+		t.Fatalf("parseMigrateArgs failed: %v", err)
+	}
+	if oldP.DataBlockSize != 512 || oldP.DataBlocks != 24 || oldP.HashName != "sha256" {
+		t.Errorf("unexpected old params: %+v", oldP)
+	}
+	if newP.DataBlockSize != 4096 || newP.DataBlocks != 3 || newP.HashName != "sha512" {
+		t.Errorf("unexpected new params: %+v", newP)
+	}
+
+	tests := []struct {
+		name string
+		args []string
+	}{
+		{"missing new hash", []string{data, oldHash, rootHex}},
+		{"new hash is old hash", []string{data, oldHash, rootHex, oldHash}},
+		{"new hash is data", []string{data, oldHash, rootHex, data}},
+		{"invalid root", []string{data, oldHash, "zz", newHash}},
+		{"uneven new block size", []string{"--new-data-block-size", "8192", data, oldHash, rootHex, newHash}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, _, _, _, _, err := parseMigrateArgs(tt.args); err == nil {
+				t.Errorf("expected error for %v", tt.args)
+			}
+		})
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	dir := t.TempDir()
+	data := utils.MakeTempFile(t, 4096*64)
+	defer os.Remove(data)
+	oldHash := filepath.Join(dir, "old.img")
+	newHash := filepath.Join(dir, "new.img")
+
+	out, _ := utils.RunGoCLI(t, "format", "--hash", "sha1", "--format", "0", "--no-superblock", "--salt", "0102", data, oldHash)
+	oldRoot := utils.ExtractRootHex(t, out)
+
+	out, _ = utils.RunGoCLI(t, "migrate", "--hash", "sha1", "--format", "0", "--no-superblock", "--salt", "0102",
+		"--new-salt", "aabb", data, oldHash, oldRoot, newHash)
+	if !strings.Contains(out, oldRoot) || !strings.Contains(out, "Hash algorithm:       sha256") {
+		t.Errorf("unexpected migrate output:\n%s", out)
+	}
+	newRoot := utils.ExtractRootHex(t, out[strings.Index(out, "New hash device"):])
+	utils.RunGoCLI(t, "verify", data, newHash, newRoot)
+
+	// Tampered data must not get a new root hash.
+	if err := os.Remove(newHash); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.OpenFile(data, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteAt([]byte("tampered"), 4096*10); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	oldP, newP, dataPath, oldHashPath, newHashPath, root, err := parseMigrateArgs([]string{
+		"--hash", "sha1", "--format", "0", "--no-superblock", "--salt", "0102", data, oldHash, oldRoot, newHash})
+	if err != nil {
+		t.Fatalf("parseMigrateArgs failed: %v", err)
+	}
+	if err := runMigrate(oldP, newP, dataPath, oldHashPath, newHashPath, root); err == nil {
+		t.Error("expected migrate to fail for tampered data")
+	}
+	if _, err := os.Stat(newHash); !os.IsNotExist(err) {
+		t.Errorf("new hash device written for tampered data: %v", err)
+	}
+}
@@ -33,19 +33,41 @@ func parseOpenArgs(args []string) (*verity.VerityParams, string, string, string,
 	fs.SetOutput(os.Stderr)
 
 	flags := defaultFlags(fs)
+	return parseOpenFlagSet(fs, flags, args)
+}
 
+// parseOpenFlagSet parses the positional arguments and flags shared by the
+// commands that take the same inputs as open.
+func parseOpenFlagSet(fs *flag.FlagSet, flags *CommonFlags, args []string) (*verity.VerityParams, string, string, string, []byte, []string, string, error) {
+	mf := addManifestFlags(fs)
 	if err := fs.Parse(args); err != nil {
 		return nil, "", "", "", nil, nil, "", err
 	}
 
+	m, err := mf.load(fs)
+	if err != nil {
+		return nil, "", "", "", nil, nil, "", err
+	}
+
 	rest := fs.Args()
-	if len(rest) < 4 {
-		return nil, "", "", "", nil, nil, "", errors.New("require <data_device> <name> <hash_device> <root_hash>")
+	var dataDev, name, hashDev, rootHex string
+	singleFile := m == nil && len(rest) == 3
+	switch {
+	case m != nil && (len(rest) == 3 || len(rest) == 4):
+		dataDev, name, hashDev = rest[0], rest[1], rest[2]
+		if len(rest) == 4 {
+			rootHex = rest[3]
+		}
+	case m != nil:
+		return nil, "", "", "", nil, nil, "", errors.New("require <data_device> <name> <hash_device> [<root_hash>] with --manifest")
+	case singleFile:
+		dataDev, name, rootHex = rest[0], rest[1], rest[2]
+		hashDev = dataDev
+	case len(rest) >= 4:
+		dataDev, name, hashDev, rootHex = rest[0], rest[1], rest[2], rest[3]
+	default:
+		return nil, "", "", "", nil, nil, "", errors.New("require <data_device> <name> <hash_device> <root_hash> or <file> <name> <root_hash>")
 	}
-	dataDev := rest[0]
-	name := rest[1]
-	hashDev := rest[2]
-	rootHex := rest[3]
 
 	if strings.TrimSpace(name) == "" {
 		return nil, "", "", "", nil, nil, "", fmt.Errorf("device name is required")
@@ -57,6 +79,15 @@ func parseOpenArgs(args []string) (*verity.VerityParams, string, string, string,
 		return nil, "", "", "", nil, nil, "", fmt.Errorf("device name too long (max %d characters)", dm.DMNameLen-1)
 	}
 
+	if m != nil {
+		rootBytes, err := manifestRootHash(m, rootHex)
+		if err != nil {
+			return nil, "", "", "", nil, nil, "", err
+		}
+		p := m.Params
+		return &p, dataDev, name, hashDev, rootBytes, nil, *flags.RootHashSig, nil
+	}
+
 	p := verity.DefaultVerityParams()
 
 	applyFlags(&p, flags)
@@ -82,6 +113,12 @@ func parseOpenArgs(args []string) (*verity.VerityParams, string, string, string,
 	p.Salt = salt
 	p.SaltSize = saltSize
 
+	if singleFile {
+		if err := applyTrailer(&p, dataDev); err != nil {
+			return nil, "", "", "", nil, nil, "", err
+		}
+	}
+
 	if *flags.NoSuper {
 		dataBlocks, err := utils.CalculateDataBlocks(dataDev, *flags.DataBlocks, p.DataBlockSize)
 		if err != nil {
@@ -111,9 +148,20 @@ func runOpen(p *verity.VerityParams, dataDev, name, hashDev string, rootDigest [
 		return fmt.Errorf("device name must not contain '/' characters")
 	}
 
+	devPath, err := openDevice(p, dataDev, name, hashDev, rootDigest, flags, signatureFile)
+	if err != nil {
+		return err
+	}
+
+	return printOpenResult(name, devPath)
+}
+
+// openDevice attaches loop devices for regular files and activates the verity
+// target. The loop devices are released once the mapping holds them.
+func openDevice(p *verity.VerityParams, dataDev, name, hashDev string, rootDigest []byte, flags []string, signatureFile string) (string, error) {
 	dataLoop, cleanup, err := utils.SetupLoopDevice(dataDev)
 	if err != nil {
-		return fmt.Errorf("setup data loop device: %w", err)
+		return "", fmt.Errorf("setup data loop device: %w", err)
 	}
 	defer func() {
 		if dataLoop != dataDev {
@@ -121,21 +169,21 @@ func runOpen(p *verity.VerityParams, dataDev, name, hashDev string, rootDigest [
 		}
 	}()
 
-	hashLoop, cleanupHash, err := utils.SetupLoopDevice(hashDev)
-	if err != nil {
-		return fmt.Errorf("setup hash loop device: %w", err)
-	}
-	defer func() {
-		if hashLoop != hashDev {
-			cleanupHash()
+	// Data and hash tree in one file share a loop device, so InitParams
+	// finds the superblock at the hash offset.
+	hashLoop := dataLoop
+	if hashDev != dataDev {
+		var cleanupHash func()
+		hashLoop, cleanupHash, err = utils.SetupLoopDevice(hashDev)
+		if err != nil {
+			return "", fmt.Errorf("setup hash loop device: %w", err)
 		}
-	}()
-
-	devPath, err := verity.VerityOpen(p, name, dataLoop, hashLoop, rootDigest, signatureFile, flags)
-	if err != nil {
-		return err
+		defer func() {
+			if hashLoop != hashDev {
+				cleanupHash()
+			}
+		}()
 	}
 
-	fmt.Printf("%s\n", devPath)
-	return nil
+	return verity.VerityOpen(p, name, dataLoop, hashLoop, rootDigest, signatureFile, flags)
 }
@@ -0,0 +1,94 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+const (
+	outputText = "text"
+	outputJSON = "json"
+)
+
+// outputFormat is set from the --output flag, which every subcommand
+// accepts and main strips before the subcommand parses its arguments.
+var outputFormat = outputText
+
+// splitOutputFlag removes --output <text|json> from args.
+func splitOutputFlag(args []string) ([]string, string, error) {
+	format := outputText
+	var rest []string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			rest = append(rest, args[i:]...)
+			break
+		}
+		name, value, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		if name != "output" || arg == name {
+			rest = append(rest, arg)
+			continue
+		}
+		if !hasValue {
+			if i+1 >= len(args) {
+				return nil, "", fmt.Errorf("flag needs an argument: %s", arg)
+			}
+			i++
+			value = args[i]
+		}
+		switch value {
+		case outputText, outputJSON:
+			format = value
+		default:
+			return nil, "", fmt.Errorf("unknown output format %q (expected text or json)", value)
+		}
+	}
+	return rest, format, nil
+}
+
+// emit writes v as indented JSON with --output json and calls text
+// otherwise.
+func emit(v any, text func()) error {
+	if outputFormat != outputJSON {
+		text()
+		return nil
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+type openResult struct {
+	Name   string `json:"name"`
+	Device string `json:"device"`
+}
+
+type closeResult struct {
+	Name    string `json:"name"`
+	Device  string `json:"device"`
+	Removed bool   `json:"removed"`
+}
+
+func printOpenResult(name, devPath string) error {
+	return emit(openResult{Name: name, Device: devPath}, func() {
+		fmt.Printf("%s\n", devPath)
+	})
+}
@@ -0,0 +1,136 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/containerd/go-dmverity/pkg/utils"
+)
+
+func TestSplitOutputFlag(t *testing.T) {
+	tests := []struct {
+		args   []string
+		rest   []string
+		format string
+	}{
+		{[]string{"data", "hash"}, []string{"data", "hash"}, outputText},
+		{[]string{"--output", "json", "data", "hash"}, []string{"data", "hash"}, outputJSON},
+		{[]string{"data", "-output=json", "hash"}, []string{"data", "hash"}, outputJSON},
+		{[]string{"--salt", "-", "--output=text", "data"}, []string{"--salt", "-", "data"}, outputText},
+		{[]string{"--", "--output", "json"}, []string{"--", "--output", "json"}, outputText},
+	}
+	for _, tt := range tests {
+		rest, format, err := splitOutputFlag(tt.args)
+		if err != nil {
+			t.Errorf("splitOutputFlag(%v) failed: %v", tt.args, err)
+			continue
+		}
+		if !reflect.DeepEqual(rest, tt.rest) || format != tt.format {
+			t.Errorf("splitOutputFlag(%v) = %v, %s, want %v, %s", tt.args, rest, format, tt.rest, tt.format)
+		}
+	}
+
+	for _, args := range [][]string{{"--output", "xml"}, {"--output"}} {
+		if _, _, err := splitOutputFlag(args); err == nil {
+			t.Errorf("splitOutputFlag(%v): expected error", args)
+		}
+	}
+}
+
+func TestJSONOutput(t *testing.T) {
+	data := utils.MakeTempFile(t, 4096*16)
+	hash := utils.MakeTempFile(t, 0)
+	defer os.Remove(data)
+	defer os.Remove(hash)
+
+	out, _ := utils.RunGoCLI(t, "format", "--output", "json", "--salt", "0102", data, hash)
+	var formatted struct {
+		Path   string `json:"path"`
+		Params struct {
+			DataBlocks uint64 `json:"data_blocks"`
+			Salt       string `json:"salt"`
+		} `json:"params"`
+		RootHash   string `json:"root_hash"`
+		HashBlocks uint64 `json:"hash_blocks"`
+	}
+	if err := json.Unmarshal([]byte(out), &formatted); err != nil {
+		t.Fatalf("format output is not JSON: %v\n%s", err, out)
+	}
+	if formatted.Path != hash || formatted.Params.DataBlocks != 16 || formatted.Params.Salt != "0102" ||
+		len(formatted.RootHash) != 64 || formatted.HashBlocks != 1 {
+		t.Errorf("unexpected format result: %+v", formatted)
+	}
+
+	out, _ = utils.RunGoCLI(t, "verify", "--output=json", data, hash, formatted.RootHash)
+	var verified verifyResult
+	if err := json.Unmarshal([]byte(out), &verified); err != nil {
+		t.Fatalf("verify output is not JSON: %v\n%s", err, out)
+	}
+	if !verified.Verified || verified.RootHash.String() != formatted.RootHash {
+		t.Errorf("unexpected verify result: %+v", verified)
+	}
+
+	out, _ = utils.RunGoCLI(t, "dump", "--output", "json", hash)
+	var dumped map[string]any
+	if err := json.Unmarshal([]byte(out), &dumped); err != nil {
+		t.Fatalf("dump output is not JSON: %v\n%s", err, out)
+	}
+	if _, ok := dumped["root_hash"]; ok {
+		t.Errorf("dump should not report a root hash: %s", out)
+	}
+	if dumped["hash_device_size"] != float64(8192) {
+		t.Errorf("unexpected dump result: %s", out)
+	}
+}
+
+func TestFormatDumpSizesAgree(t *testing.T) {
+	data := utils.MakeTempFile(t, 4096*300)
+	hash := utils.MakeTempFile(t, 0)
+	defer os.Remove(data)
+	defer os.Remove(hash)
+
+	type sizes struct {
+		HashBlocks     uint64 `json:"hash_blocks"`
+		HashDeviceSize uint64 `json:"hash_device_size"`
+	}
+	var formatted, dumped sizes
+	out, _ := utils.RunGoCLI(t, "format", "--output", "json", data, hash)
+	if err := json.Unmarshal([]byte(out), &formatted); err != nil {
+		t.Fatalf("format output is not JSON: %v\n%s", err, out)
+	}
+	out, _ = utils.RunGoCLI(t, "dump", "--output", "json", hash)
+	if err := json.Unmarshal([]byte(out), &dumped); err != nil {
+		t.Fatalf("dump output is not JSON: %v\n%s", err, out)
+	}
+
+	// Two levels of 3 and 1 blocks after the superblock block.
+	want := sizes{HashBlocks: 4, HashDeviceSize: 5 * 4096}
+	if formatted != want || dumped != want {
+		t.Errorf("format reported %+v, dump %+v, want %+v", formatted, dumped, want)
+	}
+	st, err := os.Stat(hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if uint64(st.Size()) != want.HashDeviceSize {
+		t.Errorf("hash device is %d bytes, want %d", st.Size(), want.HashDeviceSize)
+	}
+}
@@ -0,0 +1,125 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/containerd/go-dmverity/pkg/utils"
+	verity "github.com/containerd/go-dmverity/pkg/verity"
+)
+
+// parseRebuildHashArgs returns complete params: without --manifest or
+// --no-superblock they are read from the existing superblock.
+func parseRebuildHashArgs(args []string) (*verity.VerityParams, string, string, []byte, error) {
+	fs := flag.NewFlagSet("rebuild-hash", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	tmpDir := fs.String("tmpdir", "", "directory for the scratch copy of the tree")
+	p, dataPath, hashPath, root, err := parseRebuildFlagSet(fs, args)
+	if err != nil {
+		return nil, "", "", nil, err
+	}
+	p.ScratchDir = *tmpDir
+	return p, dataPath, hashPath, root, nil
+}
+
+// parseRebuildFlagSet parses the positional arguments and flags shared by
+// the commands that rewrite an existing hash tree with complete params.
+func parseRebuildFlagSet(fs *flag.FlagSet, args []string) (*verity.VerityParams, string, string, []byte, error) {
+	flags := defaultFlags(fs)
+	mf := addManifestFlags(fs)
+
+	if err := fs.Parse(args); err != nil {
+		return nil, "", "", nil, err
+	}
+
+	m, err := mf.load(fs)
+	if err != nil {
+		return nil, "", "", nil, err
+	}
+
+	rest := fs.Args()
+	if m != nil {
+		if len(rest) != 2 && len(rest) != 3 {
+			return nil, "", "", nil, errors.New("require <data_path> <hash_path> [<root_hex>] with --manifest")
+		}
+		var rootHex string
+		if len(rest) == 3 {
+			rootHex = rest[2]
+		}
+		rootBytes, err := manifestRootHash(m, rootHex)
+		if err != nil {
+			return nil, "", "", nil, err
+		}
+		p := m.Params
+		return &p, rest[0], rest[1], rootBytes, nil
+	}
+
+	var dataPath, hashPath, rootHex string
+	singleFile := len(rest) == 2
+	switch {
+	case singleFile:
+		dataPath, rootHex = rest[0], rest[1]
+		hashPath = dataPath
+	case len(rest) == 3:
+		dataPath, hashPath, rootHex = rest[0], rest[1], rest[2]
+	default:
+		return nil, "", "", nil, errors.New("require <data_path> <hash_path> <root_hex> or <file> <root_hex>")
+	}
+
+	rootBytes, err := utils.ParseRootHash(rootHex)
+	if err != nil {
+		return nil, "", "", nil, err
+	}
+
+	p, err := verifyParams(flags, dataPath, singleFile)
+	if err != nil {
+		return nil, "", "", nil, err
+	}
+	if !p.NoSuperblock {
+		if err := verity.InitParams(p, dataPath, hashPath); err != nil {
+			return nil, "", "", nil, fmt.Errorf("%w (use --manifest if the superblock is lost)", err)
+		}
+	}
+
+	return p, dataPath, hashPath, rootBytes, nil
+}
+
+type rebuildResult struct {
+	DataPath string          `json:"data_path"`
+	HashPath string          `json:"hash_path"`
+	RootHash verity.HexBytes `json:"root_hash"`
+	Rebuilt  bool            `json:"rebuilt"`
+}
+
+func runRebuildHash(p *verity.VerityParams, dataPath, hashPath string, rootDigest []byte) error {
+	if err := verity.ValidateRootHashSize(rootDigest, p.HashName); err != nil {
+		return err
+	}
+
+	if err := verity.VerityRebuild(p, dataPath, hashPath, rootDigest); err != nil {
+		return fmt.Errorf("rebuild failed: %w", err)
+	}
+
+	res := rebuildResult{DataPath: dataPath, HashPath: hashPath, RootHash: rootDigest, Rebuilt: true}
+	return emit(res, func() {
+		fmt.Printf("Hash device rebuilt\n")
+	})
+}
@@ -0,0 +1,111 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/containerd/go-dmverity/pkg/utils"
+	"github.com/containerd/go-dmverity/pkg/verity"
+)
+
+func TestParseRebuildHashArgs(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+	}{
+		{"missing root", []string{"data"}},
+		{"too many args", []string{"data", "hash", "00", "extra"}},
+		{"invalid root", []string{"data", "hash", "zz"}},
+		{"missing superblock", []string{"/nonexistent/data", "/nonexistent/hash", "00"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, _, _, err := parseRebuildHashArgs(tt.args); err == nil {
+				t.Errorf("expected error for %v", tt.args)
+			}
+		})
+	}
+}
+
+func TestRebuildHash(t *testing.T) {
+	dir := t.TempDir()
+	data := utils.MakeTempFile(t, 4096*300)
+	defer os.Remove(data)
+	hash := filepath.Join(dir, "hash.img")
+	manifest := filepath.Join(dir, "verity.json")
+
+	out, _ := utils.RunGoCLI(t, "format", "--manifest", manifest, data, hash)
+	rootHex := utils.ExtractRootHex(t, out)
+	before, err := verity.DumpDeviceInfo(hash)
+	if err != nil {
+		t.Fatalf("DumpDeviceInfo failed: %v", err)
+	}
+
+	// Damage the tree but keep the superblock.
+	f, err := os.OpenFile(hash, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteAt(make([]byte, 8192), 8192); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	scratch := t.TempDir()
+	out, _ = utils.RunGoCLI(t, "rebuild-hash", "--tmpdir", scratch, data, hash, rootHex)
+	if !strings.Contains(out, "Hash device rebuilt") {
+		t.Errorf("unexpected rebuild-hash output:\n%s", out)
+	}
+	utils.RunGoCLI(t, "verify", data, hash, rootHex)
+	if left, _ := os.ReadDir(scratch); len(left) != 0 {
+		t.Errorf("scratch files left behind: %v", left)
+	}
+
+	// Lose the hash device; only the manifest is left.
+	if err := os.Remove(hash); err != nil {
+		t.Fatal(err)
+	}
+	utils.RunGoCLI(t, "rebuild-hash", "--manifest", manifest, data, hash)
+	after, err := verity.DumpDeviceInfo(hash)
+	if err != nil {
+		t.Fatalf("DumpDeviceInfo failed: %v", err)
+	}
+	if after.Params.UUID != before.Params.UUID || string(after.Params.Salt) != string(before.Params.Salt) {
+		t.Errorf("superblock not preserved: before %+v after %+v", before.Params, after.Params)
+	}
+	utils.RunGoCLI(t, "verify", data, hash, rootHex)
+
+	image := utils.MakeTempFile(t, 4096*16)
+	defer os.Remove(image)
+	out, _ = utils.RunGoCLI(t, "format", "--append", image)
+	appendRoot := utils.ExtractRootHex(t, out)
+	utils.RunGoCLI(t, "rebuild-hash", image, appendRoot)
+	utils.RunGoCLI(t, "verify", image, appendRoot)
+
+	p, dataPath, hashPath, _, err := parseRebuildHashArgs([]string{data, hash, rootHex})
+	if err != nil {
+		t.Fatalf("parseRebuildHashArgs failed: %v", err)
+	}
+	wrong, _ := utils.ParseRootHash(strings.Repeat("00", 32))
+	if err := runRebuildHash(p, dataPath, hashPath, wrong); err == nil {
+		t.Error("expected an error for a wrong root hash")
+	}
+}
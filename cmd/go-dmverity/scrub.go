@@ -0,0 +1,81 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	verity "github.com/containerd/go-dmverity/pkg/verity"
+)
+
+func parseScrubArgs(args []string) (string, verity.ScrubOptions, error) {
+	fs := flag.NewFlagSet("scrub", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+
+	offset := fs.Uint64("offset", 0, "byte offset to start reading at")
+	length := fs.Uint64("length", 0, "bytes to read (default to the end of the device)")
+	workers := fs.Int("workers", 0, "parallel readers (default one per CPU)")
+	// Without O_DIRECT cached blocks would be served without being checked again.
+	directIO := fs.Bool("direct-io", true, "bypass the page cache")
+
+	if err := fs.Parse(args); err != nil {
+		return "", verity.ScrubOptions{}, err
+	}
+	if fs.NArg() != 1 {
+		return "", verity.ScrubOptions{}, errors.New("require <name>")
+	}
+	if *workers < 0 {
+		return "", verity.ScrubOptions{}, fmt.Errorf("invalid --workers: %d", *workers)
+	}
+
+	opts := verity.ScrubOptions{
+		Offset:   *offset,
+		Length:   *length,
+		Workers:  *workers,
+		DirectIO: *directIO,
+	}
+	return fs.Arg(0), opts, nil
+}
+
+func runScrub(name string, opts verity.ScrubOptions) error {
+	res, err := verity.VerityScrub(name, opts)
+	if err != nil {
+		return err
+	}
+
+	if err := emit(res, func() {
+		fmt.Printf("Scrubbed %s: %d bytes from offset %d\n", res.Path, res.Length, res.Offset)
+		for _, r := range res.BadRanges {
+			fmt.Printf("  sectors %d-%d: %s\n", r.StartSector, r.StartSector+r.Sectors-1, r.Error)
+		}
+		state := "verified"
+		if res.Corrupted {
+			state = "corrupted"
+		}
+		fmt.Printf("  status:      %s (%s)\n", res.Status, state)
+	}); err != nil {
+		return err
+	}
+
+	if len(res.BadRanges) > 0 || res.Corrupted {
+		return fmt.Errorf("%s has %d unreadable sector ranges (status %s)", res.Path, len(res.BadRanges), res.Status)
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/containerd/go-dmverity/pkg/utils"
+	verity "github.com/containerd/go-dmverity/pkg/verity"
+)
+
+func TestParseScrubArgs(t *testing.T) {
+	name, opts, err := parseScrubArgs([]string{"--offset", "4096", "--length", "8192", "--workers", "2", "vroot"})
+	if err != nil {
+		t.Fatalf("parseScrubArgs failed: %v", err)
+	}
+	if name != "vroot" || opts.Offset != 4096 || opts.Length != 8192 || opts.Workers != 2 || !opts.DirectIO {
+		t.Errorf("unexpected result: %s %+v", name, opts)
+	}
+
+	_, opts, err = parseScrubArgs([]string{"--direct-io=false", "vroot"})
+	if err != nil || opts.DirectIO {
+		t.Errorf("expected buffered reads, got %+v, %v", opts, err)
+	}
+
+	invalid := [][]string{
+		{},
+		{"a", "b"},
+		{"--workers", "-1", "vroot"},
+		{"--offset", "x", "vroot"},
+	}
+	for _, args := range invalid {
+		if _, _, err := parseScrubArgs(args); err == nil {
+			t.Errorf("parseScrubArgs(%v): expected error", args)
+		}
+	}
+}
+
+func TestScrub(t *testing.T) {
+	utils.RequireRoot(t)
+	utils.RequireTool(t, "dmsetup")
+
+	data, hash, rootHex := utils.CreateFormattedFiles(t)
+	dmCleanup := utils.NewDMDeviceCleanup(t)
+	defer dmCleanup.Cleanup()
+
+	d, dCleanup, err := utils.SetupLoopDevice(data)
+	if err != nil {
+		t.Fatalf("failed to setup data loop: %v", err)
+	}
+	defer dCleanup()
+	h, hCleanup, err := utils.SetupLoopDevice(hash)
+	if err != nil {
+		t.Fatalf("failed to setup hash loop: %v", err)
+	}
+	defer hCleanup()
+
+	name := "vgo-scrub"
+	utils.OpenVerityDevice(t, utils.DefaultVerityTestParams(), d, name, h, rootHex)
+	dmCleanup.Add(name)
+
+	out, _ := utils.RunGoCLI(t, "scrub", name)
+	if !strings.Contains(out, "(verified)") {
+		t.Fatalf("expected a clean scrub, got:\n%s", out)
+	}
+
+	// Corrupt data block 5 underneath the active device.
+	f, err := os.OpenFile(d, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatalf("open data loop: %v", err)
+	}
+	if _, err := f.WriteAt([]byte(strings.Repeat("x", 4096)), 5*4096); err != nil {
+		t.Fatalf("corrupt data: %v", err)
+	}
+	if err := f.Sync(); err != nil {
+		t.Fatalf("sync data loop: %v", err)
+	}
+	f.Close()
+
+	raw, err := exec.Command("go-dmverity", "scrub", "--output", "json", name).Output()
+	if err == nil {
+		t.Fatalf("expected scrub to fail on corrupted data, got:\n%s", raw)
+	}
+	var res verity.ScrubResult
+	if err := json.Unmarshal(raw, &res); err != nil {
+		t.Fatalf("invalid JSON output: %v\n%s", err, raw)
+	}
+	if !res.Corrupted || len(res.BadRanges) != 1 || res.BadRanges[0].StartSector != 40 || res.BadRanges[0].Sectors != 8 {
+		t.Errorf("unexpected scrub result: %+v", res)
+	}
+}
+
+func TestScrub_NonExistentDevice(t *testing.T) {
+	utils.RequireRoot(t)
+	utils.RequireTool(t, "dmsetup")
+
+	if err := runScrub("vgo-scrub-nonexistent", verity.ScrubOptions{}); err == nil {
+		t.Error("expected error for a non-existent device")
+	}
+}
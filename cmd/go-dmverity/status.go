@@ -22,7 +22,7 @@ import (
 	"fmt"
 	"os"
 
-	dm "github.com/containerd/go-dmverity/pkg/dm"
+	verity "github.com/containerd/go-dmverity/pkg/verity"
 )
 
 func parseStatusArgs(args []string) (string, error) {
@@ -39,34 +39,26 @@ func parseStatusArgs(args []string) (string, error) {
 }
 
 func runStatus(name string) error {
-	c, err := dm.Open()
+	st, err := verity.VerityStatus(name)
 	if err != nil {
 		return err
 	}
-	defer c.Close()
 
-	st, err := c.DeviceStatus(name)
-	if err != nil {
-		return err
-	}
-
-	state := "inactive"
-	if st.ActivePresent {
-		state = "active"
-	}
-	fmt.Printf("/dev/mapper/%s is %s.\n", name, state)
-
-	if st.ActivePresent {
-		fmt.Printf("  type:        %s\n", "verity")
-		fmt.Printf("  status:      %d:%d\n", st.Major, st.Minor)
-		fmt.Printf("  open count:  %d\n", st.OpenCount)
-		fmt.Printf("  event:       %d\n", st.EventNr)
-
-		tableStatus, err := c.TableStatus(name, false)
-		if err == nil && tableStatus != "" {
-			fmt.Printf("  table:       %s\n", tableStatus)
+	return emit(st, func() {
+		state := "inactive"
+		if st.Active {
+			state = "active"
 		}
-	}
+		fmt.Printf("%s is %s.\n", st.Path, state)
 
-	return nil
+		if st.Active {
+			fmt.Printf("  type:        %s\n", "verity")
+			fmt.Printf("  status:      %d:%d\n", st.Major, st.Minor)
+			fmt.Printf("  open count:  %d\n", st.OpenCount)
+			fmt.Printf("  event:       %d\n", st.EventNr)
+			if st.Status != "" {
+				fmt.Printf("  table:       %s\n", st.Status)
+			}
+		}
+	})
 }
@@ -0,0 +1,116 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+
+	verity "github.com/containerd/go-dmverity/pkg/verity"
+)
+
+const (
+	tableStyleAll      = "all"
+	tableStyleDMSetup  = "dmsetup"
+	tableStyleDMMod    = "dm-mod"
+	tableStyleChromeOS = "chromeos"
+)
+
+func parseTableArgs(args []string) (*verity.VerityParams, string, string, string, []byte, verity.TableOptions, string, error) {
+	fs := flag.NewFlagSet("table", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+
+	flags := defaultFlags(fs)
+	deviceFormat := fs.String("device-format", "major-minor", "device reference format: path, major-minor or partuuid")
+	dmUUID := fs.String("dm-uuid", "", "device-mapper UUID")
+	minor := fs.String("minor", "", "device-mapper minor number")
+	style := fs.String("style", tableStyleAll, "output style: all, dmsetup, dm-mod or chromeos")
+
+	var opts verity.TableOptions
+	p, dataDev, name, hashDev, rootBytes, _, _, err := parseOpenFlagSet(fs, flags, args)
+	if err != nil {
+		return nil, "", "", "", nil, opts, "", err
+	}
+
+	opts.DeviceFormat, err = verity.ParseDeviceFormat(*deviceFormat)
+	if err != nil {
+		return nil, "", "", "", nil, opts, "", err
+	}
+	if *minor != "" {
+		if _, err := strconv.ParseUint(*minor, 10, 32); err != nil {
+			return nil, "", "", "", nil, opts, "", fmt.Errorf("invalid minor number %q", *minor)
+		}
+	}
+	opts.UUID = *dmUUID
+	opts.Minor = *minor
+
+	switch *style {
+	case tableStyleAll, tableStyleDMSetup, tableStyleDMMod, tableStyleChromeOS:
+	default:
+		return nil, "", "", "", nil, opts, "", fmt.Errorf("unknown style %q", *style)
+	}
+
+	return p, dataDev, name, hashDev, rootBytes, opts, *style, nil
+}
+
+type tableResult struct {
+	Name        string `json:"name"`
+	UUID        string `json:"uuid,omitempty"`
+	Minor       string `json:"minor,omitempty"`
+	Table       string `json:"table,omitempty"`
+	DMModCreate string `json:"dm_mod_create,omitempty"`
+	ChromeOS    string `json:"chromeos,omitempty"`
+}
+
+func runTable(p *verity.VerityParams, dataDev, name, hashDev string, rootDigest []byte, opts verity.TableOptions, style string) error {
+	t, err := verity.VerityTable(p, name, dataDev, hashDev, rootDigest, opts)
+	if err != nil {
+		return err
+	}
+
+	res := tableResult{Name: t.Name, UUID: t.UUID, Minor: t.Minor}
+	switch style {
+	case tableStyleDMSetup:
+		res.Table = t.String()
+	case tableStyleDMMod:
+		res.DMModCreate = t.DMModCreate()
+	case tableStyleChromeOS:
+		s, err := t.ChromeOS()
+		if err != nil {
+			return err
+		}
+		res.ChromeOS = s
+	default:
+		res.Table = t.String()
+		res.DMModCreate = t.DMModCreate()
+		if s, err := t.ChromeOS(); err != nil {
+			fmt.Fprintf(os.Stderr, "Chrome OS dm= string not available: %v\n", err)
+		} else {
+			res.ChromeOS = s
+		}
+	}
+
+	return emit(res, func() {
+		for _, line := range []string{res.Table, res.DMModCreate, res.ChromeOS} {
+			if line != "" {
+				fmt.Println(line)
+			}
+		}
+	})
+}
@@ -0,0 +1,95 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/containerd/go-dmverity/pkg/utils"
+	verity "github.com/containerd/go-dmverity/pkg/verity"
+)
+
+func TestParseTableArgs(t *testing.T) {
+	root := strings.Repeat("ab", 32)
+
+	_, dataDev, name, hashDev, _, opts, style, err := parseTableArgs([]string{
+		"--device-format", "partuuid", "--dm-uuid", "abc", "--minor", "3", "--style", "dm-mod",
+		"data", "vroot", "hash", root,
+	})
+	if err != nil {
+		t.Fatalf("parseTableArgs failed: %v", err)
+	}
+	if dataDev != "data" || name != "vroot" || hashDev != "hash" {
+		t.Errorf("unexpected positional args: %s %s %s", dataDev, name, hashDev)
+	}
+	if opts.DeviceFormat != verity.DeviceFormatPartUUID || opts.UUID != "abc" || opts.Minor != "3" || style != "dm-mod" {
+		t.Errorf("unexpected options: %+v style=%s", opts, style)
+	}
+
+	invalid := [][]string{
+		{"data", "vroot", "hash"},
+		{"--device-format", "label", "data", "vroot", "hash", root},
+		{"--minor", "x", "data", "vroot", "hash", root},
+		{"--style", "grub", "data", "vroot", "hash", root},
+	}
+	for _, args := range invalid {
+		if _, _, _, _, _, _, _, err := parseTableArgs(args); err == nil {
+			t.Errorf("parseTableArgs(%v): expected error", args)
+		}
+	}
+}
+
+func TestTable_MajorMinor(t *testing.T) {
+	utils.RequireRoot(t)
+
+	data, hash, rootHex := utils.CreateFormattedFiles(t)
+	defer os.Remove(data)
+	defer os.Remove(hash)
+
+	dataLoop, err := utils.AttachLoopDevice(data)
+	if err != nil {
+		t.Fatalf("attach data loop: %v", err)
+	}
+	defer utils.DetachLoopDevice(dataLoop)
+	hashLoop, err := utils.AttachLoopDevice(hash)
+	if err != nil {
+		t.Fatalf("attach hash loop: %v", err)
+	}
+	defer utils.DetachLoopDevice(hashLoop)
+
+	p, dataDev, name, hashDev, root, opts, _, err := parseTableArgs([]string{"--no-superblock", dataLoop, "vgo-table", hashLoop, rootHex})
+	if err != nil {
+		t.Fatalf("parseTableArgs failed: %v", err)
+	}
+	tbl, err := verity.VerityTable(p, name, dataDev, hashDev, root, opts)
+	if err != nil {
+		t.Fatalf("VerityTable failed: %v", err)
+	}
+
+	dataNum, _ := utils.DeviceNumber(dataLoop)
+	hashNum, _ := utils.DeviceNumber(hashLoop)
+	want := fmt.Sprintf("verity 1 %s %s 4096 4096 16 0 sha256 %s -", dataNum, hashNum, rootHex)
+	if !strings.Contains(tbl.String(), want) {
+		t.Errorf("table %q does not contain %q", tbl.String(), want)
+	}
+	if !strings.HasPrefix(tbl.DMModCreate(), "dm-mod.create=\"vgo-table,,,ro,0 128 verity") {
+		t.Errorf("unexpected dm-mod.create string: %s", tbl.DMModCreate())
+	}
+}
@@ -0,0 +1,102 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	verity "github.com/containerd/go-dmverity/pkg/verity"
+)
+
+// parseUpdateArgs takes the rebuild-hash arguments, where the root hash is
+// the one of the tree before the update, plus the changed blocks.
+func parseUpdateArgs(args []string) (*verity.VerityParams, string, string, []byte, verity.UpdateOptions, error) {
+	fs := flag.NewFlagSet("update", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	blocks := fs.String("blocks", "", "changed data blocks, e.g. 1,5,10-20")
+	oldData := fs.String("old-data", "", "copy of the old data to find the changed blocks")
+
+	p, dataPath, hashPath, oldRoot, err := parseRebuildFlagSet(fs, args)
+	if err != nil {
+		return nil, "", "", nil, verity.UpdateOptions{}, err
+	}
+	if *blocks == "" && *oldData == "" {
+		return nil, "", "", nil, verity.UpdateOptions{}, errors.New("require --blocks or --old-data")
+	}
+
+	opts := verity.UpdateOptions{OldData: *oldData}
+	if *blocks != "" {
+		if opts.Blocks, err = parseBlockList(*blocks, p.DataBlocks); err != nil {
+			return nil, "", "", nil, verity.UpdateOptions{}, err
+		}
+	}
+	return p, dataPath, hashPath, oldRoot, opts, nil
+}
+
+// parseBlockList parses a comma-separated list of block numbers and
+// inclusive ranges below dataBlocks.
+func parseBlockList(s string, dataBlocks uint64) ([]uint64, error) {
+	var blocks []uint64
+	for _, item := range strings.Split(s, ",") {
+		first, last, isRange := strings.Cut(strings.TrimSpace(item), "-")
+		start, err := strconv.ParseUint(first, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid block %q", item)
+		}
+		end := start
+		if isRange {
+			if end, err = strconv.ParseUint(last, 10, 64); err != nil || end < start {
+				return nil, fmt.Errorf("invalid block range %q", item)
+			}
+		}
+		if end >= dataBlocks {
+			return nil, fmt.Errorf("block %d out of range: device has %d data blocks", end, dataBlocks)
+		}
+		for b := start; b <= end; b++ {
+			blocks = append(blocks, b)
+		}
+	}
+	return blocks, nil
+}
+
+type updateResult struct {
+	DataPath string `json:"data_path"`
+	HashPath string `json:"hash_path"`
+	*verity.UpdateResult
+}
+
+func runUpdate(p *verity.VerityParams, dataPath, hashPath string, oldRoot []byte, opts verity.UpdateOptions) error {
+	if err := verity.ValidateRootHashSize(oldRoot, p.HashName); err != nil {
+		return err
+	}
+
+	res, err := verity.VerityUpdate(p, dataPath, hashPath, oldRoot, opts)
+	if err != nil {
+		return fmt.Errorf("update failed: %w", err)
+	}
+
+	return emit(updateResult{DataPath: dataPath, HashPath: hashPath, UpdateResult: res}, func() {
+		fmt.Printf("Updated %d data blocks, wrote %d hash blocks\n", res.ChangedBlocks, res.HashBlocksWritten)
+		fmt.Printf("Root hash:              %s\n", hex.EncodeToString(res.RootHash))
+	})
+}
@@ -0,0 +1,120 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"reflect"
+	"testing"
+
+	"github.com/containerd/go-dmverity/pkg/utils"
+)
+
+func TestParseBlockList(t *testing.T) {
+	got, err := parseBlockList("7, 1,3-5", 10)
+	if err != nil {
+		t.Fatalf("parseBlockList failed: %v", err)
+	}
+	if want := []uint64{7, 1, 3, 4, 5}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	for _, s := range []string{"", "x", "5-3", "1-", "10", "8-10"} {
+		if _, err := parseBlockList(s, 10); err == nil {
+			t.Errorf("parseBlockList(%q): expected error", s)
+		}
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	const testUUID = "12345678-1234-1234-1234-123456789abc"
+	data := utils.MakeTempFile(t, 4096*300)
+	hash := utils.MakeTempFile(t, 0)
+	fresh := utils.MakeTempFile(t, 0)
+	old := utils.MakeTempFile(t, 0)
+	defer os.Remove(data)
+	defer os.Remove(hash)
+	defer os.Remove(fresh)
+	defer os.Remove(old)
+
+	out, _ := utils.RunGoCLI(t, "format", "--uuid", testUUID, data, hash)
+	oldRoot := utils.ExtractRootHex(t, out)
+	oldData, err := os.ReadFile(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldHash, err := os.ReadFile(hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(old, oldData, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, _, _, _, err := parseUpdateArgs([]string{data, hash, oldRoot}); err == nil {
+		t.Error("expected an error without --blocks or --old-data")
+	}
+	if _, _, _, _, _, err := parseUpdateArgs([]string{"--blocks", "300", data, hash, oldRoot}); err == nil {
+		t.Error("expected an out of range block to be rejected")
+	}
+
+	f, err := os.OpenFile(data, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, off := range []int64{0, 4096 * 150, 4096 * 299} {
+		if _, err := f.WriteAt([]byte("patched"), off); err != nil {
+			t.Fatal(err)
+		}
+	}
+	f.Close()
+
+	out, _ = utils.RunGoCLI(t, "format", "--uuid", testUUID, data, fresh)
+	wantRoot := utils.ExtractRootHex(t, out)
+	want, err := os.ReadFile(fresh)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, args := range [][]string{
+		{"--blocks", "0,150,299"},
+		{"--old-data", old},
+	} {
+		if err := os.WriteFile(hash, oldHash, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		out, _ = utils.RunGoCLI(t, append(append([]string{"update"}, args...), data, hash, oldRoot)...)
+		if got := utils.ExtractRootHex(t, out); got != wantRoot {
+			t.Errorf("update %v: root hash %s, want %s", args, got, wantRoot)
+		}
+		got, err := os.ReadFile(hash)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("update %v: hash device differs from a full format", args)
+		}
+	}
+
+	// The tree no longer matches the old root hash.
+	if out, err := exec.Command("go-dmverity", "update", "--blocks", "0", data, hash, oldRoot).CombinedOutput(); err == nil {
+		t.Errorf("expected update against a stale root hash to fail, got:\n%s", out)
+	}
+	utils.RunGoCLI(t, "verify", data, hash, wantRoot)
+}
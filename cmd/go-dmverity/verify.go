@@ -17,10 +17,15 @@
 package main
 
 import (
+	"crypto/rand"
+	"encoding/binary"
 	"errors"
 	"flag"
 	"fmt"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/google/uuid"
 
@@ -31,20 +36,133 @@ import (
 func parseVerifyArgs(args []string) (*verity.VerityParams, string, string, []byte, error) {
 	fs := flag.NewFlagSet("verify", flag.ContinueOnError)
 	fs.SetOutput(os.Stderr)
+	return parseVerifyFlagSet(fs, args)
+}
+
+// parseVerifySampleArgs returns the verify arguments plus the sample size
+// and seed of verify --sample. Without --seed a random seed is chosen.
+func parseVerifySampleArgs(args []string) (*verity.VerityParams, string, string, []byte, verity.SampleOptions, error) {
+	fs := flag.NewFlagSet("verify", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	sample := fs.String("sample", "", "number or percentage of data blocks to check")
+	seed := fs.Uint64("seed", 0, "seed of the block selection")
+
+	p, dataPath, hashPath, root, err := parseVerifyFlagSet(fs, args)
+	if err != nil {
+		return nil, "", "", nil, verity.SampleOptions{}, err
+	}
+	if p.CheckpointFile != "" {
+		return nil, "", "", nil, verity.SampleOptions{}, errors.New("--resume cannot be used with --sample")
+	}
+
+	var opts verity.SampleOptions
+	if pct, ok := strings.CutSuffix(*sample, "%"); ok {
+		v, err := strconv.ParseFloat(pct, 64)
+		if err != nil || v <= 0 || v > 100 {
+			return nil, "", "", nil, verity.SampleOptions{}, fmt.Errorf("invalid --sample percentage %q", *sample)
+		}
+		opts.Fraction = v / 100
+	} else {
+		v, err := strconv.ParseUint(*sample, 10, 64)
+		if err != nil || v == 0 {
+			return nil, "", "", nil, verity.SampleOptions{}, fmt.Errorf("invalid --sample %q (expected <count> or <percent>%%)", *sample)
+		}
+		opts.Count = v
+	}
 
+	seedSet := false
+	fs.Visit(func(f *flag.Flag) {
+		seedSet = seedSet || f.Name == "seed"
+	})
+	opts.Seed = *seed
+	if !seedSet {
+		var b [8]byte
+		if _, err := rand.Read(b[:]); err != nil {
+			return nil, "", "", nil, verity.SampleOptions{}, err
+		}
+		opts.Seed = binary.LittleEndian.Uint64(b[:])
+	}
+	return p, dataPath, hashPath, root, opts, nil
+}
+
+// parseVerifyFlagSet parses the positional arguments and flags shared by the
+// verify variants that check a data and a hash path against a root hash.
+func parseVerifyFlagSet(fs *flag.FlagSet, args []string) (*verity.VerityParams, string, string, []byte, error) {
 	flags := defaultFlags(fs)
+	mf := addManifestFlags(fs)
+	directIO := fs.Bool("direct-io", false, "bypass the page cache when reading the devices")
+	maxBandwidth := fs.Uint64("max-bandwidth", 0, "maximum bytes read per second (0 for unlimited)")
+	maxIOPS := fs.Uint64("max-iops", 0, "maximum reads per second (0 for unlimited)")
+	resume := fs.String("resume", "", "save progress to this state file and resume from it")
+	interval := fs.Duration("checkpoint-interval", 10*time.Second, "how often to save progress with --resume")
 
 	if err := fs.Parse(args); err != nil {
 		return nil, "", "", nil, err
 	}
+	if *interval <= 0 {
+		return nil, "", "", nil, fmt.Errorf("invalid --checkpoint-interval: %v", *interval)
+	}
+	applyIO := func(p *verity.VerityParams) {
+		p.DirectIO = *directIO
+		p.MaxBytesPerSec = *maxBandwidth
+		p.MaxIOPS = *maxIOPS
+		p.CheckpointFile = *resume
+		p.CheckpointInterval = *interval
+	}
+
+	m, err := mf.load(fs)
+	if err != nil {
+		return nil, "", "", nil, err
+	}
 
 	rest := fs.Args()
-	if len(rest) != 3 {
-		return nil, "", "", nil, errors.New("require <data_path> <hash_path> <root_hex>")
+	if m != nil {
+		if len(rest) != 2 && len(rest) != 3 {
+			return nil, "", "", nil, errors.New("require <data_path> <hash_path> [<root_hex>] with --manifest")
+		}
+		var rootHex string
+		if len(rest) == 3 {
+			rootHex = rest[2]
+		}
+		rootBytes, err := manifestRootHash(m, rootHex)
+		if err != nil {
+			return nil, "", "", nil, err
+		}
+		p := m.Params
+		applyIO(&p)
+		return &p, rest[0], rest[1], rootBytes, nil
 	}
-	dataPath := rest[0]
-	hashPath := rest[1]
 
+	var dataPath, hashPath, rootHex string
+	singleFile := len(rest) == 2
+	switch {
+	case singleFile:
+		dataPath, rootHex = rest[0], rest[1]
+		hashPath = dataPath
+	case len(rest) == 3:
+		dataPath, hashPath, rootHex = rest[0], rest[1], rest[2]
+	default:
+		return nil, "", "", nil, errors.New("require <data_path> <hash_path> <root_hex> or <file> <root_hex>")
+	}
+
+	p, err := verifyParams(flags, dataPath, singleFile)
+	if err != nil {
+		return nil, "", "", nil, err
+	}
+
+	rootBytes, err := utils.ParseRootHash(rootHex)
+	if err != nil {
+		return nil, "", "", nil, err
+	}
+	applyIO(p)
+
+	return p, dataPath, hashPath, rootBytes, nil
+}
+
+// verifyParams builds the params of the commands that read an existing hash
+// tree from the verify flags. Without --no-superblock most of them are left
+// for the superblock to fill in.
+func verifyParams(flags *CommonFlags, dataPath string, singleFile bool) (*verity.VerityParams, error) {
 	p := verity.DefaultVerityParams()
 
 	applyFlags(&p, flags)
@@ -56,24 +174,30 @@ func parseVerifyArgs(args []string) (*verity.VerityParams, string, string, []byt
 	}
 
 	if err := validateAndApplyBlockSizes(&p, flags); err != nil {
-		return nil, "", "", nil, err
+		return nil, err
 	}
 
 	if err := utils.ValidateHashOffset(p.HashAreaOffset, p.HashBlockSize, p.NoSuperblock); err != nil {
-		return nil, "", "", nil, err
+		return nil, err
 	}
 
 	salt, saltSize, err := utils.ApplySalt(*flags.SaltHex, int(verity.MaxSaltSize))
 	if err != nil {
-		return nil, "", "", nil, err
+		return nil, err
 	}
 	p.Salt = salt
 	p.SaltSize = saltSize
 
+	if singleFile {
+		if err := applyTrailer(&p, dataPath); err != nil {
+			return nil, err
+		}
+	}
+
 	if p.NoSuperblock {
 		dataBlocks, err := utils.CalculateDataBlocks(dataPath, *flags.DataBlocks, p.DataBlockSize)
 		if err != nil {
-			return nil, "", "", nil, err
+			return nil, err
 		}
 		p.DataBlocks = dataBlocks
 	}
@@ -83,22 +207,17 @@ func parseVerifyArgs(args []string) (*verity.VerityParams, string, string, []byt
 			return uuid.New().String(), nil
 		})
 		if err != nil {
-			return nil, "", "", nil, err
+			return nil, err
 		}
 		p.UUID = uuid
 	}
 
-	rootBytes, err := utils.ParseRootHash(rest[2])
-	if err != nil {
-		return nil, "", "", nil, err
-	}
-
-	return &p, dataPath, hashPath, rootBytes, nil
+	return &p, nil
 }
 
 func runVerify(p *verity.VerityParams, dataPath, hashPath string, rootDigest []byte) error {
 	if p.HashName != "" {
-		if err := utils.ValidateRootHashSize(rootDigest, p.HashName); err != nil {
+		if err := verity.ValidateRootHashSize(rootDigest, p.HashName); err != nil {
 			return err
 		}
 	}
@@ -107,6 +226,51 @@ func runVerify(p *verity.VerityParams, dataPath, hashPath string, rootDigest []b
 		return fmt.Errorf("verification failed: %w", err)
 	}
 
-	fmt.Printf("Verification succeeded\n")
+	return printVerifyResult(dataPath, hashPath, rootDigest)
+}
+
+func runVerifySample(p *verity.VerityParams, dataPath, hashPath string, rootDigest []byte, opts verity.SampleOptions) error {
+	if p.HashName != "" {
+		if err := verity.ValidateRootHashSize(rootDigest, p.HashName); err != nil {
+			return err
+		}
+	}
+
+	res, err := verity.VeritySample(p, dataPath, hashPath, rootDigest, opts)
+	if err != nil {
+		return fmt.Errorf("verification failed: %w", err)
+	}
+
+	if err := emit(res, func() {
+		fmt.Printf("Sampled %d of %d data blocks (seed %d), read %d hash blocks\n",
+			res.Sampled, res.DataBlocks, res.Seed, res.HashBlocksRead)
+		for _, b := range res.FailedBlocks {
+			fmt.Printf("  data block %d failed verification\n", b)
+		}
+		if len(res.FailedBlocks) == 0 {
+			fmt.Printf("Verification of the sample succeeded: with %g%% confidence at most %.4g%% of the data blocks are corrupted\n",
+				res.Confidence*100, res.MaxCorruptFraction*100)
+		}
+	}); err != nil {
+		return err
+	}
+
+	if len(res.FailedBlocks) > 0 {
+		return fmt.Errorf("verification failed: %d of %d sampled data blocks are corrupted", len(res.FailedBlocks), res.Sampled)
+	}
 	return nil
 }
+
+type verifyResult struct {
+	DataPath string          `json:"data_path"`
+	HashPath string          `json:"hash_path"`
+	RootHash verity.HexBytes `json:"root_hash"`
+	Verified bool            `json:"verified"`
+}
+
+func printVerifyResult(dataPath, hashPath string, rootDigest []byte) error {
+	res := verifyResult{DataPath: dataPath, HashPath: hashPath, RootHash: rootDigest, Verified: true}
+	return emit(res, func() {
+		fmt.Printf("Verification succeeded\n")
+	})
+}
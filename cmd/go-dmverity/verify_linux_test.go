@@ -19,7 +19,10 @@ package main
 import (
 	"os"
 	"os/exec"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/containerd/go-dmverity/pkg/utils"
 )
@@ -150,6 +153,10 @@ func TestParseVerifyArgs_InvalidArgs(t *testing.T) {
 			name: "invalid hash block size",
 			args: []string{"--hash-block-size", "1000", "data", "hash", "root"},
 		},
+		{
+			name: "invalid checkpoint interval",
+			args: []string{"--resume", "state", "--checkpoint-interval", "0s", "data", "hash", "root"},
+		},
 	}
 
 	for _, tt := range tests {
@@ -161,3 +168,82 @@ func TestParseVerifyArgs_InvalidArgs(t *testing.T) {
 		})
 	}
 }
+
+func TestVerify_ResumeAndLimits(t *testing.T) {
+	data := utils.MakeTempFile(t, 4096*512)
+	hash := utils.MakeTempFile(t, 0)
+	defer os.Remove(data)
+	defer os.Remove(hash)
+	state := filepath.Join(t.TempDir(), "verify.state")
+
+	outGo, _ := utils.RunGoCLI(t, "format", data, hash)
+	rootHex := utils.ExtractRootHex(t, outGo)
+
+	p, _, _, _, err := parseVerifyArgs([]string{
+		"--max-bandwidth", "1048576", "--max-iops", "100", "--resume", state, "--checkpoint-interval", "1m",
+		data, hash, rootHex,
+	})
+	if err != nil {
+		t.Fatalf("parseVerifyArgs failed: %v", err)
+	}
+	if p.MaxBytesPerSec != 1<<20 || p.MaxIOPS != 100 || p.CheckpointFile != state || p.CheckpointInterval != time.Minute {
+		t.Errorf("unexpected params: %+v", p)
+	}
+
+	// 2 MiB of data at 4 MiB/s takes at least a quarter of a second.
+	start := time.Now()
+	utils.RunGoCLI(t, "verify", "--max-bandwidth", "4194304", "--resume", state, data, hash, rootHex)
+	if elapsed := time.Since(start); elapsed < 250*time.Millisecond {
+		t.Errorf("rate-limited verify took %v", elapsed)
+	}
+	if _, err := os.Stat(state); !os.IsNotExist(err) {
+		t.Errorf("expected the state file to be removed after success, got %v", err)
+	}
+}
+
+func TestVerify_Sample(t *testing.T) {
+	data := utils.MakeTempFile(t, 4096*256)
+	hash := utils.MakeTempFile(t, 0)
+	defer os.Remove(data)
+	defer os.Remove(hash)
+
+	outGo, _ := utils.RunGoCLI(t, "format", data, hash)
+	rootHex := utils.ExtractRootHex(t, outGo)
+
+	_, _, _, _, opts, err := parseVerifySampleArgs([]string{"--sample", "12.5%", "--seed", "7", data, hash, rootHex})
+	if err != nil {
+		t.Fatalf("parseVerifySampleArgs failed: %v", err)
+	}
+	if opts.Fraction != 0.125 || opts.Count != 0 || opts.Seed != 7 {
+		t.Errorf("unexpected sample options: %+v", opts)
+	}
+	_, _, _, _, opts, err = parseVerifySampleArgs([]string{"--sample", "10", data, hash, rootHex})
+	if err != nil || opts.Count != 10 {
+		t.Errorf("expected a sample of 10 blocks, got %+v, %v", opts, err)
+	}
+
+	for _, sample := range []string{"0", "-1", "0%", "101%", "x", ""} {
+		if _, _, _, _, _, err := parseVerifySampleArgs([]string{"--sample", sample, data, hash, rootHex}); err == nil {
+			t.Errorf("--sample %q: expected error", sample)
+		}
+	}
+	if _, _, _, _, _, err := parseVerifySampleArgs([]string{"--sample", "10", "--resume", "state", data, hash, rootHex}); err == nil {
+		t.Error("expected --resume to be rejected with --sample")
+	}
+
+	utils.RunGoCLI(t, "verify", "--sample", "10%", "--seed", "1", data, hash, rootHex)
+
+	f, err := os.OpenFile(data, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatalf("failed to open data file: %v", err)
+	}
+	if _, err := f.WriteAt([]byte("corrupted"), 4096*100); err != nil {
+		t.Fatalf("failed to corrupt data: %v", err)
+	}
+	f.Close()
+
+	out, err := exec.Command("go-dmverity", "verify", "--sample", "100%", data, hash, rootHex).CombinedOutput()
+	if err == nil || !strings.Contains(string(out), "data block 100 failed") {
+		t.Errorf("expected block 100 to fail, got %v:\n%s", err, out)
+	}
+}
@@ -5,3 +5,5 @@ go 1.24.3
 require golang.org/x/sys v0.38.0
 
 require github.com/google/uuid v1.6.0
+
+require golang.org/x/crypto v0.45.0
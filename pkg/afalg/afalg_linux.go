@@ -0,0 +1,206 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+// Package afalg computes digests with the kernel crypto API through AF_ALG
+// sockets, for hash algorithms the Go standard library does not provide.
+package afalg
+
+import (
+	"errors"
+	"fmt"
+	"hash"
+	"runtime"
+	"strings"
+	"sync"
+
+	"golang.org/x/sys/unix"
+)
+
+// ErrNotSupported is returned when the kernel has no AF_ALG sockets.
+var ErrNotSupported = errors.New("afalg: kernel crypto API sockets not supported")
+
+// maxDigestSize bounds the digest of any kernel hash (HASH_MAX_DIGESTSIZE).
+const maxDigestSize = 64
+
+// Hash is a kernel hash algorithm such as "sha3-256" or "sm3". It keeps a
+// socket bound to the algorithm open for the life of the process.
+type Hash struct {
+	name string
+	size int
+	tfm  int
+}
+
+var (
+	hashesMu sync.Mutex
+	hashes   = map[string]*Hash{}
+)
+
+// NewHash returns the kernel hash called name. Every caller asking for the
+// same name shares one Hash.
+func NewHash(name string) (*Hash, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+
+	hashesMu.Lock()
+	defer hashesMu.Unlock()
+	if h, ok := hashes[name]; ok {
+		return h, nil
+	}
+
+	tfm, err := unix.Socket(unix.AF_ALG, unix.SOCK_SEQPACKET|unix.SOCK_CLOEXEC, 0)
+	if errors.Is(err, unix.EAFNOSUPPORT) {
+		return nil, ErrNotSupported
+	} else if err != nil {
+		return nil, fmt.Errorf("afalg: socket: %w", err)
+	}
+	if err := unix.Bind(tfm, &unix.SockaddrALG{Type: "hash", Name: name}); err != nil {
+		unix.Close(tfm)
+		return nil, fmt.Errorf("afalg: hash %s not available: %w", name, err)
+	}
+
+	// AF_ALG does not report the digest size, so measure the digest of
+	// the empty message. This also catches keyed hashes, which cannot be
+	// used without a key.
+	op, err := accept(tfm)
+	if err != nil {
+		unix.Close(tfm)
+		return nil, fmt.Errorf("afalg: hash %s: %w", name, err)
+	}
+	buf := make([]byte, maxDigestSize)
+	n, err := read(op, buf)
+	unix.Close(op)
+	if err != nil {
+		unix.Close(tfm)
+		return nil, fmt.Errorf("afalg: hash %s: %w", name, err)
+	}
+
+	h := &Hash{name: name, size: n, tfm: tfm}
+	hashes[name] = h
+	return h, nil
+}
+
+// Name returns the kernel name of the algorithm.
+func (h *Hash) Name() string { return h.name }
+
+// Size returns the digest size in bytes.
+func (h *Hash) Size() int { return h.size }
+
+// New returns a hash.Hash computing h. As hash.Hash has no way to report
+// them, the first socket error is kept and returned by the Err() error
+// method of the result; digests summed after it are zeros.
+func (h *Hash) New() hash.Hash {
+	d := &digest{h: h}
+	d.op, d.err = accept(h.tfm)
+	if d.err == nil {
+		runtime.AddCleanup(d, func(fd int) { unix.Close(fd) }, d.op)
+	}
+	return d
+}
+
+type digest struct {
+	h    *Hash
+	op   int
+	err  error
+	more bool // data written since the last reset
+}
+
+func (d *digest) Write(p []byte) (int, error) {
+	if d.err != nil {
+		return 0, d.err
+	}
+	for sent := 0; sent < len(p); {
+		n, err := unix.SendmsgN(d.op, p[sent:], nil, nil, unix.MSG_MORE)
+		if errors.Is(err, unix.EINTR) {
+			continue
+		}
+		if err != nil {
+			d.err = fmt.Errorf("afalg: %s: %w", d.h.name, err)
+			return sent, d.err
+		}
+		sent += n
+		d.more = true
+	}
+	return len(p), nil
+}
+
+func (d *digest) Sum(b []byte) []byte {
+	out := make([]byte, d.h.size)
+	if d.err != nil {
+		return append(b, out...)
+	}
+	fd := d.op
+	if d.more {
+		// Reading the digest ends the operation; read it from a copy of
+		// the state so that d can take more writes.
+		clone, err := accept(d.op)
+		if err != nil {
+			d.err = fmt.Errorf("afalg: %s: %w", d.h.name, err)
+			return append(b, out...)
+		}
+		defer unix.Close(clone)
+		fd = clone
+	}
+	if _, err := read(fd, out); err != nil {
+		d.err = fmt.Errorf("afalg: %s: %w", d.h.name, err)
+		clear(out)
+	}
+	return append(b, out...)
+}
+
+func (d *digest) Reset() {
+	if d.err != nil || !d.more {
+		return
+	}
+	var discard [maxDigestSize]byte
+	if _, err := read(d.op, discard[:d.h.size]); err != nil {
+		d.err = fmt.Errorf("afalg: %s: %w", d.h.name, err)
+	}
+	d.more = false
+}
+
+func (d *digest) Size() int { return d.h.size }
+
+// Err returns the first socket error of d.
+func (d *digest) Err() error { return d.err }
+
+// BlockSize returns 1: AF_ALG does not report the block size, and writes
+// of any size cost the same system call.
+func (d *digest) BlockSize() int { return 1 }
+
+// accept returns a new operation socket for a bound socket, or a copy of
+// the state of an operation socket. unix.Accept cannot decode AF_ALG
+// addresses, so accept4 is called directly.
+func accept(fd int) (int, error) {
+	for {
+		nfd, _, errno := unix.Syscall6(unix.SYS_ACCEPT4, uintptr(fd), 0, 0, unix.SOCK_CLOEXEC, 0, 0)
+		if errno == unix.EINTR {
+			continue
+		}
+		if errno != 0 {
+			return -1, errno
+		}
+		return int(nfd), nil
+	}
+}
+
+func read(fd int, buf []byte) (int, error) {
+	for {
+		n, err := unix.Read(fd, buf)
+		if errors.Is(err, unix.EINTR) {
+			continue
+		}
+		return n, err
+	}
+}
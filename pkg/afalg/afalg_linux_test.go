@@ -0,0 +1,127 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package afalg
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/sha512"
+	"errors"
+	"hash"
+	"testing"
+)
+
+func requireHash(t *testing.T, name string) *Hash {
+	t.Helper()
+	h, err := NewHash(name)
+	if errors.Is(err, ErrNotSupported) {
+		t.Skip("AF_ALG sockets not supported")
+	}
+	if err != nil {
+		t.Skipf("kernel hash %s not available: %v", name, err)
+	}
+	return h
+}
+
+func TestHashMatchesGo(t *testing.T) {
+	tests := []struct {
+		name string
+		ref  func() hash.Hash
+	}{
+		{"sha256", sha256.New},
+		{"sha384", sha512.New384},
+		{"sha512", sha512.New},
+	}
+
+	data := make([]byte, 3*4096+17)
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := requireHash(t, tt.name)
+			want := tt.ref()
+			if h.Size() != want.Size() {
+				t.Fatalf("Size() = %d, want %d", h.Size(), want.Size())
+			}
+
+			got := h.New()
+			if !bytes.Equal(got.Sum(nil), want.Sum(nil)) {
+				t.Error("digest of the empty message differs")
+			}
+
+			got.Write(data[:100])
+			want.Write(data[:100])
+			if !bytes.Equal(got.Sum(nil), want.Sum(nil)) {
+				t.Error("partial digest differs")
+			}
+			// Sum must not end the operation.
+			got.Write(data[100:])
+			want.Write(data[100:])
+			if !bytes.Equal(got.Sum([]byte("prefix")), want.Sum([]byte("prefix"))) {
+				t.Error("digest after Sum differs")
+			}
+
+			got.Reset()
+			want.Reset()
+			got.Write(data[:4096])
+			want.Write(data[:4096])
+			if !bytes.Equal(got.Sum(nil), want.Sum(nil)) {
+				t.Error("digest after Reset differs")
+			}
+		})
+	}
+}
+
+func TestNewHashUnknown(t *testing.T) {
+	requireHash(t, "sha256")
+	if _, err := NewHash("no-such-hash"); err == nil {
+		t.Error("expected an error for an unknown algorithm")
+	}
+	if _, err := NewHash("hmac(sha256)"); err == nil {
+		t.Error("expected an error for a keyed hash")
+	}
+}
+
+func TestNewHashShared(t *testing.T) {
+	a := requireHash(t, "sha256")
+	b := requireHash(t, " SHA256 ")
+	if a != b {
+		t.Error("expected one Hash per algorithm name")
+	}
+}
+
+func TestSocketError(t *testing.T) {
+	// A closed socket stands in for errors such as fd exhaustion.
+	h := &Hash{name: "sha256", size: sha256.Size, tfm: -1}
+	if d := h.New(); d.(*digest).Err() == nil {
+		t.Error("expected an accept error")
+	}
+
+	d := &digest{h: h, op: -1}
+	sum := d.Sum(nil)
+	if d.Err() == nil {
+		t.Error("expected a read error")
+	}
+	if !bytes.Equal(sum, make([]byte, sha256.Size)) {
+		t.Errorf("digest after an error = %x, want zeros", sum)
+	}
+	if _, err := d.Write([]byte("data")); err == nil {
+		t.Error("expected Write to return the kept error")
+	}
+}
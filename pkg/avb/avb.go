@@ -0,0 +1,375 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+// Package avb reads the Android Verified Boot footer and the hashtree
+// descriptors of a vbmeta image. Signatures are not verified.
+package avb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/containerd/go-dmverity/pkg/verity"
+)
+
+const (
+	footerMagic   = "AVBf"
+	vbmetaMagic   = "AVB0"
+	FooterSize    = 64
+	VBMetaHeader  = 256
+	maxVBMetaSize = 64 * 1024 * 1024
+
+	tagHashtree = 1
+	// Size of the fixed part of a hashtree descriptor, including the
+	// 16 byte tag/length header.
+	hashtreeDescriptorSize = 180
+
+	FlagDoNotUseAB      = 1 << 0
+	FlagCheckAtMostOnce = 1 << 1
+)
+
+var ErrNoFooter = errors.New("avb: no AVB footer found")
+
+type Footer struct {
+	VersionMajor      uint32
+	VersionMinor      uint32
+	OriginalImageSize uint64
+	VBMetaOffset      uint64
+	VBMetaSize        uint64
+}
+
+type vbmetaHeader struct {
+	Magic                      [4]byte
+	RequiredLibavbVersionMajor uint32
+	RequiredLibavbVersionMinor uint32
+	AuthenticationDataSize     uint64
+	AuxiliaryDataSize          uint64
+	AlgorithmType              uint32
+	HashOffset                 uint64
+	HashSize                   uint64
+	SignatureOffset            uint64
+	SignatureSize              uint64
+	PublicKeyOffset            uint64
+	PublicKeySize              uint64
+	PublicKeyMetadataOffset    uint64
+	PublicKeyMetadataSize      uint64
+	DescriptorsOffset          uint64
+	DescriptorsSize            uint64
+	RollbackIndex              uint64
+	Flags                      uint32
+	RollbackIndexLocation      uint32
+	ReleaseString              [48]byte
+	Reserved                   [80]byte
+}
+
+type hashtreeHeader struct {
+	Tag               uint64
+	NumBytesFollowing uint64
+	DMVerityVersion   uint32
+	ImageSize         uint64
+	TreeOffset        uint64
+	TreeSize          uint64
+	DataBlockSize     uint32
+	HashBlockSize     uint32
+	FECNumRoots       uint32
+	FECOffset         uint64
+	FECSize           uint64
+	HashAlgorithm     [32]byte
+	PartitionNameLen  uint32
+	SaltLen           uint32
+	RootDigestLen     uint32
+	Flags             uint32
+	Reserved          [60]byte
+}
+
+// HashtreeDescriptor describes a partition protected by a dm-verity hash
+// tree stored in the same image.
+type HashtreeDescriptor struct {
+	DMVerityVersion uint32
+	ImageSize       uint64
+	TreeOffset      uint64
+	TreeSize        uint64
+	DataBlockSize   uint32
+	HashBlockSize   uint32
+	FECNumRoots     uint32
+	FECOffset       uint64
+	FECSize         uint64
+	HashAlgorithm   string
+	PartitionName   string
+	Salt            []byte
+	RootDigest      []byte
+	Flags           uint32
+}
+
+// VBMeta holds the parts of a vbmeta image this package understands.
+type VBMeta struct {
+	RollbackIndex uint64
+	Flags         uint32
+	Release       string
+	Hashtrees     []HashtreeDescriptor
+}
+
+// ReadFooter reads the AVB footer stored in the last 64 bytes of an image
+// of the given size.
+func ReadFooter(r io.ReaderAt, size int64) (*Footer, error) {
+	if size < FooterSize {
+		return nil, ErrNoFooter
+	}
+	buf := make([]byte, FooterSize)
+	if _, err := r.ReadAt(buf, size-FooterSize); err != nil {
+		return nil, fmt.Errorf("avb: read footer: %w", err)
+	}
+	if string(buf[:4]) != footerMagic {
+		return nil, ErrNoFooter
+	}
+
+	f := &Footer{}
+	if err := binary.Read(bytes.NewReader(buf[4:]), binary.BigEndian, f); err != nil {
+		return nil, fmt.Errorf("avb: decode footer: %w", err)
+	}
+	if f.VersionMajor != 1 {
+		return nil, fmt.Errorf("avb: unsupported footer version %d.%d", f.VersionMajor, f.VersionMinor)
+	}
+	if f.VBMetaSize < VBMetaHeader || f.VBMetaSize > maxVBMetaSize || f.VBMetaOffset+f.VBMetaSize > uint64(size) {
+		return nil, fmt.Errorf("avb: footer points outside the image (offset %d, size %d)", f.VBMetaOffset, f.VBMetaSize)
+	}
+	return f, nil
+}
+
+// ReadVBMeta parses the vbmeta image of the given size at offset.
+func ReadVBMeta(r io.ReaderAt, offset, size uint64) (*VBMeta, error) {
+	if size < VBMetaHeader || size > maxVBMetaSize {
+		return nil, fmt.Errorf("avb: invalid vbmeta size %d", size)
+	}
+	buf := make([]byte, size)
+	if n, err := r.ReadAt(buf, int64(offset)); err != nil && !(errors.Is(err, io.EOF) && n == len(buf)) {
+		return nil, fmt.Errorf("avb: read vbmeta: %w", err)
+	}
+	return ParseVBMeta(buf)
+}
+
+// ParseVBMeta parses a vbmeta image held in memory.
+func ParseVBMeta(buf []byte) (*VBMeta, error) {
+	if len(buf) < VBMetaHeader {
+		return nil, errors.New("avb: vbmeta image too short")
+	}
+	var h vbmetaHeader
+	if err := binary.Read(bytes.NewReader(buf[:VBMetaHeader]), binary.BigEndian, &h); err != nil {
+		return nil, fmt.Errorf("avb: decode vbmeta header: %w", err)
+	}
+	if string(h.Magic[:]) != vbmetaMagic {
+		return nil, errors.New("avb: invalid vbmeta magic")
+	}
+	if h.RequiredLibavbVersionMajor != 1 {
+		return nil, fmt.Errorf("avb: unsupported vbmeta version %d.%d", h.RequiredLibavbVersionMajor, h.RequiredLibavbVersionMinor)
+	}
+
+	auxStart := uint64(VBMetaHeader) + h.AuthenticationDataSize
+	auxEnd := auxStart + h.AuxiliaryDataSize
+	if auxStart < h.AuthenticationDataSize || auxEnd < auxStart || auxEnd > uint64(len(buf)) {
+		return nil, errors.New("avb: vbmeta data blocks exceed image size")
+	}
+	aux := buf[auxStart:auxEnd]
+	if h.DescriptorsOffset+h.DescriptorsSize < h.DescriptorsOffset || h.DescriptorsOffset+h.DescriptorsSize > uint64(len(aux)) {
+		return nil, errors.New("avb: descriptors exceed auxiliary data block")
+	}
+
+	m := &VBMeta{
+		RollbackIndex: h.RollbackIndex,
+		Flags:         h.Flags,
+		Release:       cString(h.ReleaseString[:]),
+	}
+	descs := aux[h.DescriptorsOffset : h.DescriptorsOffset+h.DescriptorsSize]
+	for len(descs) > 0 {
+		if len(descs) < 16 {
+			return nil, errors.New("avb: truncated descriptor")
+		}
+		tag := binary.BigEndian.Uint64(descs[0:8])
+		following := binary.BigEndian.Uint64(descs[8:16])
+		if following%8 != 0 || following > uint64(len(descs)-16) {
+			return nil, fmt.Errorf("avb: invalid descriptor length %d", following)
+		}
+		d := descs[:16+following]
+		descs = descs[16+following:]
+
+		if tag != tagHashtree {
+			continue
+		}
+		ht, err := parseHashtree(d)
+		if err != nil {
+			return nil, err
+		}
+		m.Hashtrees = append(m.Hashtrees, *ht)
+	}
+	return m, nil
+}
+
+func parseHashtree(d []byte) (*HashtreeDescriptor, error) {
+	if len(d) < hashtreeDescriptorSize {
+		return nil, errors.New("avb: hashtree descriptor too short")
+	}
+	var h hashtreeHeader
+	if err := binary.Read(bytes.NewReader(d[:hashtreeDescriptorSize]), binary.BigEndian, &h); err != nil {
+		return nil, fmt.Errorf("avb: decode hashtree descriptor: %w", err)
+	}
+
+	rest := d[hashtreeDescriptorSize:]
+	need := uint64(h.PartitionNameLen) + uint64(h.SaltLen) + uint64(h.RootDigestLen)
+	if need > uint64(len(rest)) {
+		return nil, errors.New("avb: hashtree descriptor payload exceeds descriptor")
+	}
+	name := rest[:h.PartitionNameLen]
+	rest = rest[h.PartitionNameLen:]
+	salt := rest[:h.SaltLen]
+	rest = rest[h.SaltLen:]
+	root := rest[:h.RootDigestLen]
+
+	return &HashtreeDescriptor{
+		DMVerityVersion: h.DMVerityVersion,
+		ImageSize:       h.ImageSize,
+		TreeOffset:      h.TreeOffset,
+		TreeSize:        h.TreeSize,
+		DataBlockSize:   h.DataBlockSize,
+		HashBlockSize:   h.HashBlockSize,
+		FECNumRoots:     h.FECNumRoots,
+		FECOffset:       h.FECOffset,
+		FECSize:         h.FECSize,
+		HashAlgorithm:   strings.ToLower(cString(h.HashAlgorithm[:])),
+		PartitionName:   string(name),
+		Salt:            append([]byte(nil), salt...),
+		RootDigest:      append([]byte(nil), root...),
+		Flags:           h.Flags,
+	}, nil
+}
+
+// ReadImage reads the footer of an image and returns the hashtree
+// descriptor of its embedded vbmeta. If partition is not empty the
+// descriptor with that partition name is selected, otherwise the image must
+// carry exactly one hashtree descriptor.
+func ReadImage(r io.ReaderAt, size int64, partition string) (*HashtreeDescriptor, error) {
+	f, err := ReadFooter(r, size)
+	if err != nil {
+		return nil, err
+	}
+	m, err := ReadVBMeta(r, f.VBMetaOffset, f.VBMetaSize)
+	if err != nil {
+		return nil, err
+	}
+	ht, err := m.Hashtree(partition)
+	if err != nil {
+		return nil, err
+	}
+	if ht.TreeOffset+ht.TreeSize > f.VBMetaOffset {
+		return nil, fmt.Errorf("avb: hash tree (offset %d, size %d) overlaps vbmeta at %d", ht.TreeOffset, ht.TreeSize, f.VBMetaOffset)
+	}
+	return ht, nil
+}
+
+// Hashtree selects a hashtree descriptor by partition name. An empty name
+// selects the only descriptor.
+func (m *VBMeta) Hashtree(partition string) (*HashtreeDescriptor, error) {
+	if partition == "" {
+		switch len(m.Hashtrees) {
+		case 0:
+			return nil, errors.New("avb: vbmeta has no hashtree descriptor")
+		case 1:
+			return &m.Hashtrees[0], nil
+		}
+		return nil, fmt.Errorf("avb: vbmeta has %d hashtree descriptors, a partition name is required", len(m.Hashtrees))
+	}
+	for i := range m.Hashtrees {
+		if m.Hashtrees[i].PartitionName == partition {
+			return &m.Hashtrees[i], nil
+		}
+	}
+	return nil, fmt.Errorf("avb: no hashtree descriptor for partition %q", partition)
+}
+
+// Validate checks that the descriptor describes a tree dm-verity can use.
+func (ht *HashtreeDescriptor) Validate() error {
+	if ht.DMVerityVersion > 1 {
+		return fmt.Errorf("avb: unsupported dm-verity version %d", ht.DMVerityVersion)
+	}
+	if ht.DataBlockSize == 0 || ht.HashBlockSize == 0 {
+		return errors.New("avb: block sizes must be non-zero")
+	}
+	if ht.ImageSize == 0 || ht.ImageSize%uint64(ht.DataBlockSize) != 0 {
+		return fmt.Errorf("avb: image size %d is not a multiple of the data block size %d", ht.ImageSize, ht.DataBlockSize)
+	}
+	if ht.TreeOffset%uint64(ht.HashBlockSize) != 0 {
+		return fmt.Errorf("avb: tree offset %d is not aligned to the hash block size %d", ht.TreeOffset, ht.HashBlockSize)
+	}
+	if ht.TreeOffset < ht.ImageSize {
+		return fmt.Errorf("avb: tree offset %d overlaps the data area", ht.TreeOffset)
+	}
+	if _, err := verity.HashSize(ht.HashAlgorithm); err != nil {
+		return fmt.Errorf("avb: unsupported hash algorithm %q", ht.HashAlgorithm)
+	}
+	if err := verity.ValidateRootHashSize(ht.RootDigest, ht.HashAlgorithm); err != nil {
+		return fmt.Errorf("avb: %w", err)
+	}
+	if len(ht.Salt) > verity.MaxSaltSize {
+		return fmt.Errorf("avb: salt size %d exceeds maximum of %d bytes", len(ht.Salt), verity.MaxSaltSize)
+	}
+	return nil
+}
+
+// DataBlocks returns the number of data blocks covered by the tree.
+func (ht *HashtreeDescriptor) DataBlocks() uint64 {
+	return ht.ImageSize / uint64(ht.DataBlockSize)
+}
+
+// VerityParams maps the descriptor to superblock-less verity parameters with
+// the hash tree stored after the data in the same image.
+func (ht *HashtreeDescriptor) VerityParams() verity.VerityParams {
+	return verity.VerityParams{
+		HashName:       ht.HashAlgorithm,
+		DataBlockSize:  ht.DataBlockSize,
+		HashBlockSize:  ht.HashBlockSize,
+		DataBlocks:     ht.DataBlocks(),
+		HashType:       ht.DMVerityVersion,
+		Salt:           ht.Salt,
+		SaltSize:       uint16(len(ht.Salt)),
+		HashAreaOffset: ht.TreeOffset,
+		NoSuperblock:   true,
+	}
+}
+
+// FECArgs returns the dm-verity optional arguments enabling forward error
+// correction from device, or nil if the image has no FEC data.
+func (ht *HashtreeDescriptor) FECArgs(device string) []string {
+	if ht.FECNumRoots == 0 || ht.FECSize == 0 {
+		return nil
+	}
+	blocks := fmt.Sprintf("%d", ht.FECOffset/uint64(ht.DataBlockSize))
+	return []string{
+		"use_fec_from_device", device,
+		"fec_roots", fmt.Sprintf("%d", ht.FECNumRoots),
+		"fec_blocks", blocks,
+		"fec_start", blocks,
+	}
+}
+
+func cString(b []byte) string {
+	if i := bytes.IndexByte(b, 0); i >= 0 {
+		b = b[:i]
+	}
+	return string(b)
+}
@@ -0,0 +1,267 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package avb
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/containerd/go-dmverity/pkg/verity"
+)
+
+const testBlockSize = 4096
+
+func encodeHashtree(t *testing.T, ht *HashtreeDescriptor) []byte {
+	t.Helper()
+	h := hashtreeHeader{
+		Tag:              tagHashtree,
+		DMVerityVersion:  ht.DMVerityVersion,
+		ImageSize:        ht.ImageSize,
+		TreeOffset:       ht.TreeOffset,
+		TreeSize:         ht.TreeSize,
+		DataBlockSize:    ht.DataBlockSize,
+		HashBlockSize:    ht.HashBlockSize,
+		FECNumRoots:      ht.FECNumRoots,
+		FECOffset:        ht.FECOffset,
+		FECSize:          ht.FECSize,
+		PartitionNameLen: uint32(len(ht.PartitionName)),
+		SaltLen:          uint32(len(ht.Salt)),
+		RootDigestLen:    uint32(len(ht.RootDigest)),
+		Flags:            ht.Flags,
+	}
+	copy(h.HashAlgorithm[:], ht.HashAlgorithm)
+
+	payload := append([]byte(ht.PartitionName), ht.Salt...)
+	payload = append(payload, ht.RootDigest...)
+	for (hashtreeDescriptorSize+len(payload))%8 != 0 {
+		payload = append(payload, 0)
+	}
+	h.NumBytesFollowing = uint64(hashtreeDescriptorSize - 16 + len(payload))
+
+	var buf bytes.Buffer
+	if err := binary.Write(&buf, binary.BigEndian, &h); err != nil {
+		t.Fatal(err)
+	}
+	buf.Write(payload)
+	return buf.Bytes()
+}
+
+func encodeVBMeta(t *testing.T, descriptors ...[]byte) []byte {
+	t.Helper()
+	descs := bytes.Join(descriptors, nil)
+	h := vbmetaHeader{
+		RequiredLibavbVersionMajor: 1,
+		AuxiliaryDataSize:          uint64(len(descs)),
+		DescriptorsSize:            uint64(len(descs)),
+	}
+	copy(h.Magic[:], vbmetaMagic)
+	copy(h.ReleaseString[:], "avbtool 1.2.0")
+
+	var buf bytes.Buffer
+	if err := binary.Write(&buf, binary.BigEndian, &h); err != nil {
+		t.Fatal(err)
+	}
+	buf.Write(descs)
+	return buf.Bytes()
+}
+
+func encodeFooter(t *testing.T, f Footer) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	buf.WriteString(footerMagic)
+	if err := binary.Write(&buf, binary.BigEndian, &f); err != nil {
+		t.Fatal(err)
+	}
+	out := make([]byte, FooterSize)
+	copy(out, buf.Bytes())
+	return out
+}
+
+// buildImage writes an image with dataBlocks random blocks, its hash tree,
+// an embedded vbmeta and a footer, the way avbtool add_hashtree_footer lays
+// it out.
+func buildImage(t *testing.T, dataBlocks uint64) (string, *HashtreeDescriptor) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "system.img")
+
+	data := make([]byte, dataBlocks*testBlockSize)
+	if _, err := rand.Read(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	salt := []byte{0x5a, 0x17}
+	params := verity.VerityParams{
+		HashName:       "sha256",
+		DataBlockSize:  testBlockSize,
+		HashBlockSize:  testBlockSize,
+		DataBlocks:     dataBlocks,
+		HashType:       1,
+		Salt:           salt,
+		SaltSize:       uint16(len(salt)),
+		HashAreaOffset: uint64(len(data)),
+		NoSuperblock:   true,
+	}
+	treeSize, err := verity.GetHashTreeSize(&params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, err := verity.VerityCreate(&params, path, path)
+	if err != nil {
+		t.Fatalf("VerityCreate failed: %v", err)
+	}
+
+	ht := &HashtreeDescriptor{
+		DMVerityVersion: 1,
+		ImageSize:       uint64(len(data)),
+		TreeOffset:      uint64(len(data)),
+		TreeSize:        treeSize,
+		DataBlockSize:   testBlockSize,
+		HashBlockSize:   testBlockSize,
+		HashAlgorithm:   "sha256",
+		PartitionName:   "system",
+		Salt:            salt,
+		RootDigest:      root,
+		Flags:           FlagCheckAtMostOnce,
+	}
+	vbmeta := encodeVBMeta(t, encodeHashtree(t, ht))
+	vbmetaOffset := ht.TreeOffset + treeSize
+	imageSize := vbmetaOffset + uint64(len(vbmeta)) + testBlockSize
+	imageSize -= imageSize % testBlockSize
+
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.WriteAt(vbmeta, int64(vbmetaOffset)); err != nil {
+		t.Fatal(err)
+	}
+	footer := encodeFooter(t, Footer{
+		VersionMajor:      1,
+		OriginalImageSize: ht.ImageSize,
+		VBMetaOffset:      vbmetaOffset,
+		VBMetaSize:        uint64(len(vbmeta)),
+	})
+	if _, err := f.WriteAt(footer, int64(imageSize-FooterSize)); err != nil {
+		t.Fatal(err)
+	}
+	return path, ht
+}
+
+func TestReadImage(t *testing.T) {
+	path, want := buildImage(t, 64)
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	st, _ := f.Stat()
+
+	ht, err := ReadImage(f, st.Size(), "")
+	if err != nil {
+		t.Fatalf("ReadImage failed: %v", err)
+	}
+	if ht.PartitionName != "system" || ht.ImageSize != want.ImageSize || ht.TreeOffset != want.TreeOffset ||
+		ht.HashAlgorithm != "sha256" || !bytes.Equal(ht.RootDigest, want.RootDigest) || !bytes.Equal(ht.Salt, want.Salt) {
+		t.Errorf("unexpected descriptor: %+v", ht)
+	}
+	if err := ht.Validate(); err != nil {
+		t.Errorf("Validate failed: %v", err)
+	}
+	if _, err := ReadImage(f, st.Size(), "vendor"); err == nil {
+		t.Error("expected error for unknown partition name")
+	}
+
+	p := ht.VerityParams()
+	if !p.NoSuperblock || p.HashAreaOffset != want.TreeOffset || p.DataBlocks != 64 {
+		t.Errorf("unexpected params: %+v", p)
+	}
+	if err := verity.VerityVerify(&p, path, path, ht.RootDigest); err != nil {
+		t.Errorf("VerityVerify failed: %v", err)
+	}
+}
+
+func TestReadImageNoFooter(t *testing.T) {
+	if _, err := ReadImage(bytes.NewReader(make([]byte, 8192)), 8192, ""); !errors.Is(err, ErrNoFooter) {
+		t.Errorf("expected ErrNoFooter, got %v", err)
+	}
+}
+
+func TestParseVBMetaErrors(t *testing.T) {
+	ht := &HashtreeDescriptor{
+		DMVerityVersion: 1,
+		ImageSize:       testBlockSize,
+		TreeOffset:      testBlockSize,
+		DataBlockSize:   testBlockSize,
+		HashBlockSize:   testBlockSize,
+		HashAlgorithm:   "sha256",
+		RootDigest:      make([]byte, 32),
+	}
+	good := encodeVBMeta(t, encodeHashtree(t, ht))
+	if _, err := ParseVBMeta(good); err != nil {
+		t.Fatalf("ParseVBMeta failed: %v", err)
+	}
+
+	badMagic := append([]byte(nil), good...)
+	copy(badMagic, "XXXX")
+	truncated := good[:len(good)-8]
+	badLength := append([]byte(nil), good...)
+	binary.BigEndian.PutUint64(badLength[VBMetaHeader+8:], 1<<20)
+
+	for name, buf := range map[string][]byte{
+		"bad magic":      badMagic,
+		"truncated":      truncated,
+		"bad length":     badLength,
+		"short header":   good[:100],
+		"empty metadata": nil,
+	} {
+		if _, err := ParseVBMeta(buf); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestFECArgs(t *testing.T) {
+	ht := &HashtreeDescriptor{DataBlockSize: 4096}
+	if args := ht.FECArgs("/dev/loop0"); args != nil {
+		t.Errorf("expected no FEC args, got %v", args)
+	}
+
+	ht.FECNumRoots = 2
+	ht.FECOffset = 4096 * 100
+	ht.FECSize = 4096 * 2
+	want := []string{"use_fec_from_device", "/dev/loop0", "fec_roots", "2", "fec_blocks", "100", "fec_start", "100"}
+	got := ht.FECArgs("/dev/loop0")
+	if len(got) != len(want) {
+		t.Fatalf("FECArgs = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("FECArgs = %v, want %v", got, want)
+			break
+		}
+	}
+}
@@ -19,6 +19,7 @@ package dm
 import (
 	"encoding/hex"
 	"fmt"
+	"strconv"
 	"strings"
 )
 
@@ -99,3 +100,88 @@ func BuildTargetParams(a OpenArgs) (string, error) {
 
 	return b, nil
 }
+
+// Optional verity arguments that consume a value.
+var optionalArgValues = map[string]int{
+	"use_fec_from_device":    1,
+	"fec_roots":              1,
+	"fec_blocks":             1,
+	"fec_start":              1,
+	"root_hash_sig_key_desc": 1,
+}
+
+// ParseTargetParams parses a verity target parameter string in the format
+// produced by BuildTargetParams.
+func ParseTargetParams(s string) (OpenArgs, error) {
+	var a OpenArgs
+	fields := strings.Fields(s)
+	if len(fields) < 10 {
+		return a, fmt.Errorf("verity table needs at least 10 arguments, got %d", len(fields))
+	}
+
+	version, err := strconv.ParseUint(fields[0], 10, 32)
+	if err != nil {
+		return a, fmt.Errorf("invalid version %q", fields[0])
+	}
+	dataBlockSize, err := strconv.ParseUint(fields[3], 10, 32)
+	if err != nil {
+		return a, fmt.Errorf("invalid data block size %q", fields[3])
+	}
+	hashBlockSize, err := strconv.ParseUint(fields[4], 10, 32)
+	if err != nil {
+		return a, fmt.Errorf("invalid hash block size %q", fields[4])
+	}
+	dataBlocks, err := strconv.ParseUint(fields[5], 10, 64)
+	if err != nil {
+		return a, fmt.Errorf("invalid data block count %q", fields[5])
+	}
+	hashStart, err := strconv.ParseUint(fields[6], 10, 64)
+	if err != nil {
+		return a, fmt.Errorf("invalid hash start block %q", fields[6])
+	}
+	root, err := hex.DecodeString(fields[8])
+	if err != nil || len(root) == 0 {
+		return a, fmt.Errorf("invalid root digest %q", fields[8])
+	}
+	var salt []byte
+	if fields[9] != "-" {
+		if salt, err = hex.DecodeString(fields[9]); err != nil {
+			return a, fmt.Errorf("invalid salt %q", fields[9])
+		}
+	}
+
+	a = OpenArgs{
+		Version:        uint32(version),
+		DataDevice:     fields[1],
+		HashDevice:     fields[2],
+		DataBlockSize:  uint32(dataBlockSize),
+		HashBlockSize:  uint32(hashBlockSize),
+		DataBlocks:     dataBlocks,
+		HashName:       strings.ToLower(fields[7]),
+		RootDigest:     root,
+		Salt:           salt,
+		HashStartBytes: hashStart * hashBlockSize,
+	}
+
+	opt := fields[10:]
+	if len(opt) == 0 {
+		return a, nil
+	}
+	count, err := strconv.Atoi(opt[0])
+	if err != nil || count != len(opt)-1 {
+		return a, fmt.Errorf("optional argument count %q does not match %d arguments", opt[0], len(opt)-1)
+	}
+	for i := 1; i < len(opt); i++ {
+		n := optionalArgValues[opt[i]]
+		if i+n >= len(opt) {
+			return a, fmt.Errorf("optional argument %s requires a value", opt[i])
+		}
+		if opt[i] == "root_hash_sig_key_desc" {
+			a.RootHashSigKeyDesc = opt[i+1]
+		} else {
+			a.Flags = append(a.Flags, opt[i:i+n+1]...)
+		}
+		i += n
+	}
+	return a, nil
+}
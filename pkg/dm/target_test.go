@@ -0,0 +1,67 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package dm
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseTargetParamsRoundTrip(t *testing.T) {
+	want := OpenArgs{
+		Version:            1,
+		DataDevice:         "7:0",
+		HashDevice:         "PARTUUID=0f6e1a2b-0000-4000-8000-000000000001",
+		DataBlockSize:      4096,
+		HashBlockSize:      4096,
+		DataBlocks:         256,
+		HashName:           "sha256",
+		RootDigest:         []byte{0xde, 0xad, 0xbe, 0xef},
+		Salt:               []byte{0x01, 0x02},
+		HashStartBytes:     8192,
+		Flags:              []string{"ignore_zero_blocks", "use_fec_from_device", "7:2", "fec_roots", "2"},
+		RootHashSigKeyDesc: "cryptsetup:vroot",
+	}
+
+	s, err := BuildTargetParams(want)
+	if err != nil {
+		t.Fatalf("BuildTargetParams failed: %v", err)
+	}
+	got, err := ParseTargetParams(s)
+	if err != nil {
+		t.Fatalf("ParseTargetParams(%q) failed: %v", s, err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("round trip mismatch:\n got %+v\nwant %+v", got, want)
+	}
+}
+
+func TestParseTargetParamsErrors(t *testing.T) {
+	tests := []string{
+		"1 7:0 7:1 4096 4096 256 0 sha256 abcd",
+		"x 7:0 7:1 4096 4096 256 0 sha256 abcd -",
+		"1 7:0 7:1 4096 4096 256 0 sha256 zz -",
+		"1 7:0 7:1 4096 4096 256 0 sha256 abcd - 2 ignore_zero_blocks",
+		"1 7:0 7:1 4096 4096 256 0 sha256 abcd - 1 fec_roots",
+	}
+
+	for _, s := range tests {
+		if _, err := ParseTargetParams(s); err == nil {
+			t.Errorf("ParseTargetParams(%q): expected error", s)
+		}
+	}
+}
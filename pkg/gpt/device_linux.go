@@ -0,0 +1,161 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package gpt
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	sysDevBlock = "/sys/dev/block"
+	sysBlock    = "/sys/block"
+)
+
+// DevicePartUUID returns the GPT unique partition GUID of the partition block
+// device at path. The partition table is read from the parent disk, so this
+// works without udev.
+func DevicePartUUID(path string) (uuid.UUID, error) {
+	var st unix.Stat_t
+	if err := unix.Stat(path, &st); err != nil {
+		return uuid.Nil, err
+	}
+	if st.Mode&unix.S_IFMT != unix.S_IFBLK {
+		return uuid.Nil, fmt.Errorf("gpt: %s is not a block device", path)
+	}
+
+	sysPath, err := filepath.EvalSymlinks(fmt.Sprintf("%s/%d:%d", sysDevBlock, unix.Major(st.Rdev), unix.Minor(st.Rdev)))
+	if err != nil {
+		return uuid.Nil, err
+	}
+	raw, err := os.ReadFile(filepath.Join(sysPath, "partition"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return uuid.Nil, fmt.Errorf("gpt: %s is not a partition", path)
+		}
+		return uuid.Nil, err
+	}
+	index, err := strconv.Atoi(strings.TrimSpace(string(raw)))
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("gpt: invalid partition number for %s: %w", path, err)
+	}
+
+	diskName, err := ueventDevName(filepath.Dir(sysPath))
+	if err != nil {
+		return uuid.Nil, err
+	}
+	t, err := readDisk(filepath.Join("/dev", diskName))
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("gpt: read parent disk: %w", err)
+	}
+	for _, p := range t.Partitions {
+		if p.Index == index {
+			return p.UUID, nil
+		}
+	}
+	return uuid.Nil, fmt.Errorf("gpt: partition %d not found on /dev/%s", index, diskName)
+}
+
+func ueventDevName(sysPath string) (string, error) {
+	f, err := os.Open(filepath.Join(sysPath, "uevent"))
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		if name, ok := strings.CutPrefix(sc.Text(), "DEVNAME="); ok {
+			return name, nil
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return "", err
+	}
+	return "", fmt.Errorf("gpt: no DEVNAME in %s/uevent", sysPath)
+}
+
+// FindPartition returns the device path of the partition whose unique GUID
+// is u, or of the partition nrOffset entries after it on the same disk, like
+// the kernel's PARTUUID=<uuid>/PARTNROFF=<n> syntax. All block devices listed
+// in sysfs are probed, so no udev links are required.
+func FindPartition(u uuid.UUID, nrOffset int) (string, error) {
+	disks, err := os.ReadDir(sysBlock)
+	if err != nil {
+		return "", err
+	}
+	for _, d := range disks {
+		diskPath := filepath.Join(sysBlock, d.Name())
+		devName, err := ueventDevName(diskPath)
+		if err != nil {
+			continue
+		}
+		t, err := readDisk(filepath.Join("/dev", devName))
+		if err != nil {
+			continue
+		}
+		p, ok := t.FindByUUID(u)
+		if !ok {
+			continue
+		}
+		return partitionDevice(diskPath, p.Index+nrOffset)
+	}
+	return "", fmt.Errorf("gpt: no partition with PARTUUID %s", u)
+}
+
+func readDisk(path string) (*Table, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	size, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	}
+	return Read(f, size)
+}
+
+func partitionDevice(diskPath string, index int) (string, error) {
+	entries, err := os.ReadDir(diskPath)
+	if err != nil {
+		return "", err
+	}
+	for _, e := range entries {
+		raw, err := os.ReadFile(filepath.Join(diskPath, e.Name(), "partition"))
+		if err != nil {
+			continue
+		}
+		if n, err := strconv.Atoi(strings.TrimSpace(string(raw))); err == nil && n == index {
+			name, err := ueventDevName(filepath.Join(diskPath, e.Name()))
+			if err != nil {
+				return "", err
+			}
+			return filepath.Join("/dev", name), nil
+		}
+	}
+	return "", fmt.Errorf("gpt: partition %d of %s has no block device", index, filepath.Base(diskPath))
+}
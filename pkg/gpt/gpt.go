@@ -0,0 +1,417 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package gpt
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+	"runtime"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/google/uuid"
+)
+
+const (
+	headerSignature = "EFI PART"
+	minHeaderSize   = 92
+	maxEntries      = 4096
+	minEntrySize    = 128
+)
+
+var errNoGPT = errors.New("gpt: no GUID partition table found")
+
+// Partition types from the Discoverable Partitions Specification.
+var (
+	RootAMD64       = uuid.MustParse("4f68bce3-e8cd-4db1-96e7-fbcaf984b709")
+	RootVerityAMD64 = uuid.MustParse("2c7357ed-ebd2-46d9-aec1-23d437ec2bf5")
+	UsrAMD64        = uuid.MustParse("8484680c-9521-48c6-9c11-b0720656f69e")
+	UsrVerityAMD64  = uuid.MustParse("77ff5f63-e7b6-4633-acf4-1565b864c0e6")
+	RootARM64       = uuid.MustParse("b921b045-1df0-41c3-af44-4c6f280d3fae")
+	RootVerityARM64 = uuid.MustParse("df3300ce-d69f-4c92-978c-9bfb0f38d820")
+	UsrARM64        = uuid.MustParse("b0e01050-ee5f-4390-949a-9101b17104e9")
+	UsrVerityARM64  = uuid.MustParse("6e11a4e7-fbca-4ded-b9e9-e1a512bb664e")
+)
+
+// VerityPair associates a data partition type with the type of the verity
+// partition protecting it.
+type VerityPair struct {
+	Name   string
+	Data   uuid.UUID
+	Verity uuid.UUID
+}
+
+var verityPairs = map[string][]VerityPair{
+	"amd64": {
+		{Name: "root", Data: RootAMD64, Verity: RootVerityAMD64},
+		{Name: "usr", Data: UsrAMD64, Verity: UsrVerityAMD64},
+	},
+	"arm64": {
+		{Name: "root", Data: RootARM64, Verity: RootVerityARM64},
+		{Name: "usr", Data: UsrARM64, Verity: UsrVerityARM64},
+	},
+}
+
+// VerityPairs returns the root and usr partition type pairs for arch, or nil
+// if the architecture is not known.
+func VerityPairs(arch string) []VerityPair {
+	return verityPairs[arch]
+}
+
+// NativeVerityPairs returns the partition type pairs for the running architecture.
+func NativeVerityPairs() []VerityPair {
+	return VerityPairs(runtime.GOARCH)
+}
+
+type header struct {
+	Signature      [8]byte
+	Revision       uint32
+	HeaderSize     uint32
+	HeaderCRC      uint32
+	Reserved       uint32
+	CurrentLBA     uint64
+	BackupLBA      uint64
+	FirstUsableLBA uint64
+	LastUsableLBA  uint64
+	DiskGUID       [16]byte
+	EntriesLBA     uint64
+	NumEntries     uint32
+	EntrySize      uint32
+	EntriesCRC     uint32
+}
+
+type entry struct {
+	TypeGUID   [16]byte
+	UniqueGUID [16]byte
+	FirstLBA   uint64
+	LastLBA    uint64
+	Attributes uint64
+	Name       [72]byte
+}
+
+type Partition struct {
+	Index      int
+	Type       uuid.UUID
+	UUID       uuid.UUID
+	FirstLBA   uint64
+	LastLBA    uint64
+	Attributes uint64
+	Name       string
+}
+
+type Table struct {
+	SectorSize uint32
+	DiskGUID   uuid.UUID
+	Partitions []Partition
+
+	primary header
+	backup  header
+	hasBack bool
+}
+
+// Offset returns the byte offset of the partition on a disk with the given
+// logical sector size.
+func (p Partition) Offset(sectorSize uint32) uint64 {
+	return p.FirstLBA * uint64(sectorSize)
+}
+
+// Size returns the partition size in bytes.
+func (p Partition) Size(sectorSize uint32) uint64 {
+	return (p.LastLBA - p.FirstLBA + 1) * uint64(sectorSize)
+}
+
+func (t *Table) FindByUUID(u uuid.UUID) (Partition, bool) {
+	for _, p := range t.Partitions {
+		if p.UUID == u {
+			return p, true
+		}
+	}
+	return Partition{}, false
+}
+
+func (t *Table) FindByType(typ uuid.UUID) []Partition {
+	var out []Partition
+	for _, p := range t.Partitions {
+		if p.Type == typ {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// PartitionUUIDsFromRootHash derives the data and verity partition UUIDs
+// from a root hash: the first 128 bits name the data partition and the last
+// 128 bits name the verity partition.
+func PartitionUUIDsFromRootHash(rootHash []byte) (uuid.UUID, uuid.UUID, error) {
+	if len(rootHash) < 32 {
+		return uuid.Nil, uuid.Nil, fmt.Errorf("gpt: root hash too short for partition UUIDs: %d bytes", len(rootHash))
+	}
+	var data, verity uuid.UUID
+	copy(data[:], rootHash[:16])
+	copy(verity[:], rootHash[len(rootHash)-16:])
+	return data, verity, nil
+}
+
+// Read parses the primary GUID partition table, falling back to the backup
+// header if the primary one is damaged. Both 512 and 4096 byte logical
+// sectors are probed.
+func Read(r io.ReaderAt, size int64) (*Table, error) {
+	var lastErr error = errNoGPT
+	for _, sectorSize := range []uint32{512, 4096} {
+		t, err := readWithSectorSize(r, size, sectorSize)
+		if err == nil {
+			return t, nil
+		}
+		if !errors.Is(err, errNoGPT) {
+			lastErr = err
+		}
+	}
+	return nil, lastErr
+}
+
+func readWithSectorSize(r io.ReaderAt, size int64, sectorSize uint32) (*Table, error) {
+	primary, perr := readHeader(r, 1, sectorSize)
+	if perr == nil {
+		entries, err := readEntries(r, primary, sectorSize)
+		if err == nil {
+			t := newTable(primary, entries, sectorSize)
+			if backup, berr := readHeader(r, primary.BackupLBA, sectorSize); berr == nil {
+				t.backup = *backup
+				t.hasBack = true
+			}
+			return t, nil
+		}
+		perr = err
+	}
+	if size <= 0 {
+		return nil, perr
+	}
+	lastLBA := uint64(size)/uint64(sectorSize) - 1
+	backup, err := readHeader(r, lastLBA, sectorSize)
+	if errors.Is(perr, errNoGPT) && errors.Is(err, errNoGPT) {
+		return nil, errNoGPT
+	}
+	if err != nil {
+		return nil, fmt.Errorf("gpt: primary header invalid (%v) and backup unusable: %w", perr, err)
+	}
+	entries, err := readEntries(r, backup, sectorSize)
+	if err != nil {
+		return nil, fmt.Errorf("gpt: primary header invalid (%v) and backup unusable: %w", perr, err)
+	}
+	t := newTable(backup, entries, sectorSize)
+	t.backup = *backup
+	t.hasBack = true
+	return t, nil
+}
+
+func newTable(h *header, entries []entry, sectorSize uint32) *Table {
+	t := &Table{
+		SectorSize: sectorSize,
+		DiskGUID:   guidToUUID(h.DiskGUID),
+		primary:    *h,
+	}
+	for i, e := range entries {
+		if e.TypeGUID == ([16]byte{}) {
+			continue
+		}
+		t.Partitions = append(t.Partitions, Partition{
+			Index:      i + 1,
+			Type:       guidToUUID(e.TypeGUID),
+			UUID:       guidToUUID(e.UniqueGUID),
+			FirstLBA:   e.FirstLBA,
+			LastLBA:    e.LastLBA,
+			Attributes: e.Attributes,
+			Name:       decodeName(e.Name),
+		})
+	}
+	return t
+}
+
+func readHeader(r io.ReaderAt, lba uint64, sectorSize uint32) (*header, error) {
+	off := lba * uint64(sectorSize)
+	if off > math.MaxInt64 {
+		return nil, fmt.Errorf("gpt: header offset overflows int64: %d", off)
+	}
+	buf := make([]byte, sectorSize)
+	if _, err := r.ReadAt(buf, int64(off)); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, errNoGPT
+		}
+		return nil, fmt.Errorf("gpt: read header at LBA %d: %w", lba, err)
+	}
+	if string(buf[:8]) != headerSignature {
+		return nil, errNoGPT
+	}
+
+	h := &header{}
+	if err := binary.Read(bytes.NewReader(buf), binary.LittleEndian, h); err != nil {
+		return nil, fmt.Errorf("gpt: decode header: %w", err)
+	}
+	if h.HeaderSize < minHeaderSize || h.HeaderSize > sectorSize {
+		return nil, fmt.Errorf("gpt: invalid header size %d", h.HeaderSize)
+	}
+	if h.CurrentLBA != lba {
+		return nil, fmt.Errorf("gpt: header at LBA %d claims LBA %d", lba, h.CurrentLBA)
+	}
+
+	hdr := make([]byte, h.HeaderSize)
+	copy(hdr, buf[:h.HeaderSize])
+	binary.LittleEndian.PutUint32(hdr[16:20], 0)
+	if crc32.ChecksumIEEE(hdr) != h.HeaderCRC {
+		return nil, fmt.Errorf("gpt: header CRC mismatch at LBA %d", lba)
+	}
+	if h.NumEntries == 0 || h.NumEntries > maxEntries {
+		return nil, fmt.Errorf("gpt: unsupported partition entry count %d", h.NumEntries)
+	}
+	if h.EntrySize < minEntrySize || h.EntrySize%8 != 0 || h.EntrySize > 4096 {
+		return nil, fmt.Errorf("gpt: unsupported partition entry size %d", h.EntrySize)
+	}
+	return h, nil
+}
+
+func readEntries(r io.ReaderAt, h *header, sectorSize uint32) ([]entry, error) {
+	raw, err := readEntriesRaw(r, h, sectorSize)
+	if err != nil {
+		return nil, err
+	}
+	if crc32.ChecksumIEEE(raw) != h.EntriesCRC {
+		return nil, errors.New("gpt: partition entry array CRC mismatch")
+	}
+
+	entries := make([]entry, h.NumEntries)
+	for i := range entries {
+		rec := raw[i*int(h.EntrySize) : i*int(h.EntrySize)+minEntrySize]
+		if err := binary.Read(bytes.NewReader(rec), binary.LittleEndian, &entries[i]); err != nil {
+			return nil, fmt.Errorf("gpt: decode partition entry %d: %w", i+1, err)
+		}
+		if entries[i].TypeGUID != ([16]byte{}) && entries[i].LastLBA < entries[i].FirstLBA {
+			return nil, fmt.Errorf("gpt: partition %d ends before it starts", i+1)
+		}
+	}
+	return entries, nil
+}
+
+func readEntriesRaw(r io.ReaderAt, h *header, sectorSize uint32) ([]byte, error) {
+	off := h.EntriesLBA * uint64(sectorSize)
+	if off > math.MaxInt64 {
+		return nil, fmt.Errorf("gpt: entry array offset overflows int64: %d", off)
+	}
+	raw := make([]byte, int(h.NumEntries)*int(h.EntrySize))
+	if _, err := r.ReadAt(raw, int64(off)); err != nil {
+		return nil, fmt.Errorf("gpt: read partition entries: %w", err)
+	}
+	return raw, nil
+}
+
+// SetPartitionUUID rewrites the unique GUID of the partition with the given
+// 1-based index in both the primary and the backup table, updating all CRCs.
+func SetPartitionUUID(rw interface {
+	io.ReaderAt
+	io.WriterAt
+}, t *Table, index int, u uuid.UUID) error {
+	if t == nil {
+		return errors.New("gpt: nil table")
+	}
+	headers := []*header{&t.primary}
+	if t.hasBack && t.backup.CurrentLBA != t.primary.CurrentLBA {
+		headers = append(headers, &t.backup)
+	}
+
+	for _, h := range headers {
+		if index < 1 || index > int(h.NumEntries) {
+			return fmt.Errorf("gpt: partition index %d out of range", index)
+		}
+		raw, err := readEntriesRaw(rw, h, t.SectorSize)
+		if err != nil {
+			return err
+		}
+		guid := uuidToGUID(u)
+		start := (index-1)*int(h.EntrySize) + 16
+		copy(raw[start:start+16], guid[:])
+		h.EntriesCRC = crc32.ChecksumIEEE(raw)
+
+		if _, err := rw.WriteAt(raw, int64(h.EntriesLBA*uint64(t.SectorSize))); err != nil {
+			return fmt.Errorf("gpt: write partition entries: %w", err)
+		}
+		if err := writeHeader(rw, h, t.SectorSize); err != nil {
+			return err
+		}
+	}
+
+	for i := range t.Partitions {
+		if t.Partitions[i].Index == index {
+			t.Partitions[i].UUID = u
+		}
+	}
+	return nil
+}
+
+func writeHeader(w io.WriterAt, h *header, sectorSize uint32) error {
+	h.HeaderCRC = 0
+	buf := bytes.NewBuffer(make([]byte, 0, minHeaderSize))
+	if err := binary.Write(buf, binary.LittleEndian, h); err != nil {
+		return fmt.Errorf("gpt: encode header: %w", err)
+	}
+	hdr := buf.Bytes()
+	if int(h.HeaderSize) > len(hdr) {
+		hdr = append(hdr, make([]byte, int(h.HeaderSize)-len(hdr))...)
+	}
+	h.HeaderCRC = crc32.ChecksumIEEE(hdr[:h.HeaderSize])
+	binary.LittleEndian.PutUint32(hdr[16:20], h.HeaderCRC)
+
+	if _, err := w.WriteAt(hdr[:h.HeaderSize], int64(h.CurrentLBA*uint64(sectorSize))); err != nil {
+		return fmt.Errorf("gpt: write header at LBA %d: %w", h.CurrentLBA, err)
+	}
+	return nil
+}
+
+// guidToUUID converts the mixed-endian on-disk GUID layout into the
+// canonical RFC 4122 byte order.
+func guidToUUID(g [16]byte) uuid.UUID {
+	var u uuid.UUID
+	u[0], u[1], u[2], u[3] = g[3], g[2], g[1], g[0]
+	u[4], u[5] = g[5], g[4]
+	u[6], u[7] = g[7], g[6]
+	copy(u[8:], g[8:])
+	return u
+}
+
+func uuidToGUID(u uuid.UUID) [16]byte {
+	var g [16]byte
+	g[0], g[1], g[2], g[3] = u[3], u[2], u[1], u[0]
+	g[4], g[5] = u[5], u[4]
+	g[6], g[7] = u[7], u[6]
+	copy(g[8:], u[8:])
+	return g
+}
+
+func decodeName(raw [72]byte) string {
+	units := make([]uint16, 0, len(raw)/2)
+	for i := 0; i+1 < len(raw); i += 2 {
+		c := binary.LittleEndian.Uint16(raw[i:])
+		if c == 0 {
+			break
+		}
+		units = append(units, c)
+	}
+	return strings.TrimSpace(string(utf16.Decode(units)))
+}
@@ -0,0 +1,242 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package gpt
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"hash/crc32"
+	"os"
+	"testing"
+	"unicode/utf16"
+
+	"github.com/google/uuid"
+)
+
+type testPart struct {
+	typ      uuid.UUID
+	id       uuid.UUID
+	firstLBA uint64
+	lastLBA  uint64
+	name     string
+}
+
+const testEntries = 128
+
+func buildDisk(t *testing.T, sectorSize uint32, sectors uint64, parts []testPart) *os.File {
+	t.Helper()
+
+	f, err := os.CreateTemp("", "gpt-test-*.img")
+	if err != nil {
+		t.Fatalf("create temp disk: %v", err)
+	}
+	t.Cleanup(func() {
+		f.Close()
+		os.Remove(f.Name())
+	})
+	if err := f.Truncate(int64(sectors) * int64(sectorSize)); err != nil {
+		t.Fatalf("truncate disk: %v", err)
+	}
+
+	raw := make([]byte, testEntries*minEntrySize)
+	for i, p := range parts {
+		e := entry{
+			TypeGUID:   uuidToGUID(p.typ),
+			UniqueGUID: uuidToGUID(p.id),
+			FirstLBA:   p.firstLBA,
+			LastLBA:    p.lastLBA,
+		}
+		for j, c := range utf16.Encode([]rune(p.name)) {
+			binary.LittleEndian.PutUint16(e.Name[j*2:], c)
+		}
+		buf := bytes.NewBuffer(nil)
+		if err := binary.Write(buf, binary.LittleEndian, &e); err != nil {
+			t.Fatalf("encode entry: %v", err)
+		}
+		copy(raw[i*minEntrySize:], buf.Bytes())
+	}
+
+	entrySectors := uint64(len(raw)) / uint64(sectorSize)
+	lastLBA := sectors - 1
+	primary := header{
+		Revision:       0x00010000,
+		HeaderSize:     minHeaderSize,
+		CurrentLBA:     1,
+		BackupLBA:      lastLBA,
+		FirstUsableLBA: 2 + entrySectors,
+		LastUsableLBA:  lastLBA - 1 - entrySectors,
+		DiskGUID:       uuidToGUID(uuid.New()),
+		EntriesLBA:     2,
+		NumEntries:     testEntries,
+		EntrySize:      minEntrySize,
+		EntriesCRC:     crc32.ChecksumIEEE(raw),
+	}
+	copy(primary.Signature[:], headerSignature)
+	backup := primary
+	backup.CurrentLBA = lastLBA
+	backup.BackupLBA = 1
+	backup.EntriesLBA = lastLBA - entrySectors
+
+	for _, h := range []*header{&primary, &backup} {
+		if _, err := f.WriteAt(raw, int64(h.EntriesLBA)*int64(sectorSize)); err != nil {
+			t.Fatalf("write entries: %v", err)
+		}
+		if err := writeHeader(f, h, sectorSize); err != nil {
+			t.Fatalf("write header: %v", err)
+		}
+	}
+	return f
+}
+
+func TestReadTable(t *testing.T) {
+	for _, sectorSize := range []uint32{512, 4096} {
+		dataID := uuid.New()
+		hashID := uuid.New()
+		f := buildDisk(t, sectorSize, 2048, []testPart{
+			{RootAMD64, dataID, 64, 1023, "root"},
+			{RootVerityAMD64, hashID, 1024, 1151, "root-verity"},
+		})
+
+		tbl, err := Read(f, 2048*int64(sectorSize))
+		if err != nil {
+			t.Fatalf("sector size %d: Read failed: %v", sectorSize, err)
+		}
+		if tbl.SectorSize != sectorSize {
+			t.Errorf("sector size = %d, want %d", tbl.SectorSize, sectorSize)
+		}
+		if len(tbl.Partitions) != 2 {
+			t.Fatalf("got %d partitions, want 2", len(tbl.Partitions))
+		}
+
+		p, ok := tbl.FindByUUID(dataID)
+		if !ok {
+			t.Fatalf("data partition %s not found", dataID)
+		}
+		if p.Index != 1 || p.Type != RootAMD64 || p.Name != "root" {
+			t.Errorf("unexpected data partition: %+v", p)
+		}
+		if p.Offset(sectorSize) != 64*uint64(sectorSize) || p.Size(sectorSize) != 960*uint64(sectorSize) {
+			t.Errorf("unexpected data partition geometry: offset %d size %d", p.Offset(sectorSize), p.Size(sectorSize))
+		}
+		if got := tbl.FindByType(RootVerityAMD64); len(got) != 1 || got[0].UUID != hashID {
+			t.Errorf("FindByType(root verity) = %+v", got)
+		}
+	}
+}
+
+func TestReadFallsBackToBackup(t *testing.T) {
+	dataID := uuid.New()
+	f := buildDisk(t, 512, 2048, []testPart{{UsrARM64, dataID, 64, 127, "usr"}})
+
+	// Corrupt the primary header CRC.
+	if _, err := f.WriteAt([]byte{0xff, 0xff, 0xff, 0xff}, 512+16); err != nil {
+		t.Fatal(err)
+	}
+
+	tbl, err := Read(f, 2048*512)
+	if err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+	if _, ok := tbl.FindByUUID(dataID); !ok {
+		t.Error("partition not found through backup header")
+	}
+}
+
+func TestReadNoGPT(t *testing.T) {
+	f, err := os.CreateTemp("", "gpt-test-*.img")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+	if err := f.Truncate(1 << 20); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Read(f, 1<<20); err == nil {
+		t.Error("expected error for disk without GPT")
+	}
+}
+
+func TestSetPartitionUUID(t *testing.T) {
+	f := buildDisk(t, 512, 2048, []testPart{
+		{RootAMD64, uuid.New(), 64, 1023, "root"},
+		{RootVerityAMD64, uuid.New(), 1024, 1151, "root-verity"},
+	})
+
+	tbl, err := Read(f, 2048*512)
+	if err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+
+	newID := uuid.MustParse("0123e4e5-6789-4abc-8def-0123456789ab")
+	if err := SetPartitionUUID(f, tbl, 2, newID); err != nil {
+		t.Fatalf("SetPartitionUUID failed: %v", err)
+	}
+
+	reread, err := Read(f, 2048*512)
+	if err != nil {
+		t.Fatalf("re-Read failed: %v", err)
+	}
+	if p, ok := reread.FindByUUID(newID); !ok || p.Index != 2 {
+		t.Fatalf("updated partition not found in primary table")
+	}
+
+	// The backup table must carry the same update with a valid CRC.
+	if _, err := f.WriteAt(make([]byte, 512), 512); err != nil {
+		t.Fatal(err)
+	}
+	fromBackup, err := Read(f, 2048*512)
+	if err != nil {
+		t.Fatalf("Read from backup failed: %v", err)
+	}
+	if _, ok := fromBackup.FindByUUID(newID); !ok {
+		t.Error("updated partition not found in backup table")
+	}
+}
+
+func TestPartitionUUIDsFromRootHash(t *testing.T) {
+	root, _ := hex.DecodeString("0123456789abcdef0123456789abcdeffedcba9876543210fedcba9876543210")
+
+	data, verity, err := PartitionUUIDsFromRootHash(root)
+	if err != nil {
+		t.Fatalf("PartitionUUIDsFromRootHash failed: %v", err)
+	}
+	if data.String() != "01234567-89ab-cdef-0123-456789abcdef" {
+		t.Errorf("data UUID = %s", data)
+	}
+	if verity.String() != "fedcba98-7654-3210-fedc-ba9876543210" {
+		t.Errorf("verity UUID = %s", verity)
+	}
+
+	if _, _, err := PartitionUUIDsFromRootHash(root[:20]); err == nil {
+		t.Error("expected error for short root hash")
+	}
+}
+
+func TestGUIDRoundTrip(t *testing.T) {
+	u := uuid.New()
+	g := uuidToGUID(u)
+	if guidToUUID(g) != u {
+		t.Errorf("GUID round trip mismatch")
+	}
+	// The on-disk layout stores the first three fields little endian.
+	if g[0] != u[3] || g[4] != u[5] || g[6] != u[7] || g[8] != u[8] {
+		t.Errorf("unexpected mixed-endian layout: %x vs %x", g, u)
+	}
+}
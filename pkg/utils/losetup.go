@@ -43,6 +43,10 @@ type LoopParams struct {
 	Autoclear bool
 	// Use direct IO to access the loop backing file
 	Direct bool
+	// Offset into the backing file at which the loop device starts
+	Offset uint64
+	// Size limit of the loop device in bytes, zero means up to the end
+	SizeLimit uint64
 }
 
 func getFreeLoopDev() (uint32, error) {
@@ -90,6 +94,8 @@ func setupLoopDev(backingFile, loopDev string, param LoopParams) (_ *os.File, re
 	}
 
 	copy(config.Info.File_name[:], backingFile)
+	config.Info.Offset = param.Offset
+	config.Info.Sizelimit = param.SizeLimit
 	if param.Readonly {
 		config.Info.Flags |= unix.LO_FLAGS_READ_ONLY
 	}
@@ -121,6 +127,8 @@ func setupLoopDev(backingFile, loopDev string, param LoopParams) (_ *os.File, re
 	// 3. Set Info
 	info := unix.LoopInfo64{}
 	copy(info.File_name[:], backingFile)
+	info.Offset = param.Offset
+	info.Sizelimit = param.SizeLimit
 	if param.Readonly {
 		info.Flags |= unix.LO_FLAGS_READ_ONLY
 	}
@@ -186,7 +194,13 @@ func removeLoop(loopdev string) error {
 
 // AttachLoopDevice attaches a specified backing file to a loop device
 func AttachLoopDevice(backingFile string) (string, error) {
-	file, err := setupLoop(backingFile, LoopParams{})
+	return AttachLoopDeviceWithParams(backingFile, LoopParams{})
+}
+
+// AttachLoopDeviceWithParams attaches a backing file to a loop device using
+// the given loop parameters
+func AttachLoopDeviceWithParams(backingFile string, param LoopParams) (string, error) {
+	file, err := setupLoop(backingFile, param)
 	if err != nil {
 		return "", err
 	}
@@ -227,3 +241,23 @@ func SetupLoopDevice(path string) (string, func(), error) {
 
 	return loopPath, cleanup, nil
 }
+
+// SetupLoopDeviceRange attaches a loop device exposing size bytes of path
+// starting at offset. Unlike SetupLoopDevice a loop device is created even if
+// path is already a block device.
+func SetupLoopDeviceRange(path string, offset, size uint64, readonly bool) (string, func(), error) {
+	loopPath, err := AttachLoopDeviceWithParams(path, LoopParams{
+		Readonly:  readonly,
+		Offset:    offset,
+		SizeLimit: size,
+	})
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to setup loop device for %s at offset %d: %w", path, offset, err)
+	}
+
+	cleanup := func() {
+		_ = DetachLoopDevice(loopPath)
+	}
+
+	return loopPath, cleanup, nil
+}
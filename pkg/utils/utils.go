@@ -17,13 +17,10 @@
 package utils
 
 import (
-	"crypto"
-	_ "crypto/sha1"
-	_ "crypto/sha256"
-	_ "crypto/sha512"
 	"encoding/hex"
 	"fmt"
 	"os"
+	"path/filepath"
 	"strings"
 	"unsafe"
 
@@ -53,22 +50,63 @@ func GetBlockOrFileSize(path string) (int64, error) {
 	return st.Size(), nil
 }
 
-func SelectHashSize(name string) int {
-	switch strings.ToLower(strings.TrimSpace(name)) {
-	case "sha1":
-		if crypto.SHA1.Available() {
-			return crypto.SHA1.Size()
-		}
-	case "sha256":
-		if crypto.SHA256.Available() {
-			return crypto.SHA256.Size()
-		}
-	case "sha512":
-		if crypto.SHA512.Available() {
-			return crypto.SHA512.Size()
+// DeviceNumber returns the "major:minor" number of the block device at path.
+func DeviceNumber(path string) (string, error) {
+	var st unix.Stat_t
+	if err := unix.Stat(path, &st); err != nil {
+		return "", err
+	}
+	if st.Mode&unix.S_IFMT != unix.S_IFBLK {
+		return "", fmt.Errorf("%s is not a block device", path)
+	}
+	return fmt.Sprintf("%d:%d", unix.Major(st.Rdev), unix.Minor(st.Rdev)), nil
+}
+
+// DeviceFromNumber returns the /dev path of the block device with the given
+// "major:minor" number, looked up through sysfs.
+func DeviceFromNumber(devno string) (string, error) {
+	b, err := os.ReadFile(filepath.Join("/sys/dev/block", devno, "uevent"))
+	if err != nil {
+		return "", fmt.Errorf("no block device %s: %w", devno, err)
+	}
+	for _, line := range strings.Split(string(b), "\n") {
+		if name, ok := strings.CutPrefix(line, "DEVNAME="); ok {
+			return filepath.Join("/dev", name), nil
 		}
 	}
-	return -1
+	return "", fmt.Errorf("no device name for block device %s", devno)
+}
+
+var deviceSpecDirs = map[string]string{
+	"PARTUUID":  "/dev/disk/by-partuuid",
+	"PARTLABEL": "/dev/disk/by-partlabel",
+	"UUID":      "/dev/disk/by-uuid",
+	"LABEL":     "/dev/disk/by-label",
+}
+
+// ResolveDeviceSpec turns an fstab-style device specification such as
+// PARTUUID=... or UUID=... into a device path. Plain paths are returned as is.
+func ResolveDeviceSpec(spec string) (string, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		return "", fmt.Errorf("empty device specification")
+	}
+	key, value, ok := strings.Cut(spec, "=")
+	if !ok {
+		return spec, nil
+	}
+	dir, known := deviceSpecDirs[strings.ToUpper(key)]
+	if !known {
+		return "", fmt.Errorf("unsupported device specification %q", spec)
+	}
+	value = strings.Trim(value, "\"")
+	if value == "" || strings.Contains(value, "/") {
+		return "", fmt.Errorf("invalid device specification %q", spec)
+	}
+	if strings.EqualFold(key, "PARTUUID") || strings.EqualFold(key, "UUID") {
+		value = strings.ToLower(value)
+	}
+	return dir + "/" + value, nil
 }
 
 func GetBitsDown(u uint32) uint {
@@ -121,18 +159,6 @@ func ParseRootHash(rootHex string) ([]byte, error) {
 	return rootBytes[:n], nil
 }
 
-func ValidateRootHashSize(rootDigest []byte, hashName string) error {
-	expectedHashSize := SelectHashSize(hashName)
-	if expectedHashSize == 0 {
-		expectedHashSize = crypto.SHA256.Size()
-	}
-	if len(rootDigest) != expectedHashSize {
-		return fmt.Errorf("invalid root hash size: got %d bytes, expected %d bytes for %s",
-			len(rootDigest), expectedHashSize, hashName)
-	}
-	return nil
-}
-
 func ValidateHashOffset(hashAreaOffset uint64, hashBlockSize uint32, noSuperblock bool) error {
 	if noSuperblock && (hashAreaOffset%uint64(hashBlockSize) != 0) {
 		return fmt.Errorf("hash offset %d must be aligned to hash block size %d",
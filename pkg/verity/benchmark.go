@@ -0,0 +1,161 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package verity
+
+import (
+	"bytes"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/containerd/go-dmverity/pkg/utils"
+)
+
+// HashBenchmark is the measured hashing throughput of one set of params, in
+// bytes per second.
+type HashBenchmark struct {
+	HashName      string  `json:"hash_algorithm"`
+	DataBlockSize uint32  `json:"data_block_size"`
+	HashBlockSize uint32  `json:"hash_block_size"`
+	SaltSize      uint16  `json:"salt_size"`
+	DataRate      float64 `json:"data_bytes_per_sec"`
+	HashRate      float64 `json:"hash_bytes_per_sec"`
+	DeviceRate    float64 `json:"device_bytes_per_sec,omitempty"`
+}
+
+// BenchmarkHash measures how fast the data blocks and the hash blocks of
+// params are hashed, each over size bytes of random in-memory data. The
+// measurement goes through the same code as VerityCreate and VerityVerify,
+// minus the I/O. params.DataBlocks is ignored.
+func BenchmarkHash(params *VerityParams, size uint64) (*HashBenchmark, error) {
+	vh, err := newBenchmarkHash(params)
+	if err != nil {
+		return nil, err
+	}
+
+	data := make([]byte, size)
+	if _, err := rand.Read(data); err != nil {
+		return nil, err
+	}
+
+	b := &HashBenchmark{
+		HashName:      params.HashName,
+		DataBlockSize: params.DataBlockSize,
+		HashBlockSize: params.HashBlockSize,
+		SaltSize:      params.SaltSize,
+	}
+	b.DataRate, err = vh.hashRate(bytes.NewReader(data), params.DataBlockSize, size)
+	if err != nil {
+		return nil, err
+	}
+	b.HashRate = b.DataRate
+	if params.HashBlockSize != params.DataBlockSize {
+		b.HashRate, err = vh.hashRate(bytes.NewReader(data), params.HashBlockSize, size)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
+}
+
+// BenchmarkDevice adds to b the rate at which up to size bytes of device are
+// read and hashed as data blocks, honouring params.DirectIO.
+func (b *HashBenchmark) BenchmarkDevice(params *VerityParams, device string, size uint64) error {
+	vh, err := newBenchmarkHash(params)
+	if err != nil {
+		return err
+	}
+
+	devSize, err := utils.GetBlockOrFileSize(device)
+	if err != nil {
+		return err
+	}
+	size = min(size, uint64(devSize))
+
+	f, err := openForIO(device, os.O_RDONLY, params.DirectIO)
+	if err != nil {
+		return fmt.Errorf("cannot open device %s: %w", device, err)
+	}
+	defer f.Close()
+
+	b.DeviceRate, err = vh.hashRate(f, params.DataBlockSize, size)
+	return err
+}
+
+// ProjectedTime returns how long hashing the data and the whole tree of
+// dataSize bytes takes at the measured rates, which bounds format and
+// verify. The device rate is used for the data when it was measured.
+func (b *HashBenchmark) ProjectedTime(dataSize uint64) (time.Duration, error) {
+	if b.DataRate <= 0 || b.HashRate <= 0 {
+		return 0, fmt.Errorf("benchmark has no rates")
+	}
+	vh, err := NewVerityHash(b.HashName, b.DataBlockSize, b.HashBlockSize,
+		dataSize/uint64(b.DataBlockSize), 1, make([]byte, b.SaltSize), 0, "", "", nil)
+	if err != nil {
+		return 0, err
+	}
+	treeSize, err := vh.GetHashTreeSize()
+	if err != nil {
+		return 0, err
+	}
+
+	dataRate := b.DataRate
+	if b.DeviceRate > 0 {
+		dataRate = b.DeviceRate
+	}
+	seconds := float64(dataSize)/dataRate + float64(treeSize)/b.HashRate
+	return time.Duration(seconds * float64(time.Second)), nil
+}
+
+func newBenchmarkHash(params *VerityParams) (*VerityHash, error) {
+	if params == nil {
+		return nil, fmt.Errorf("verity: nil params")
+	}
+	vh, err := NewVerityHash(params.HashName, params.DataBlockSize, params.HashBlockSize, 0,
+		params.HashType, params.Salt, 0, "", "", nil)
+	if err != nil {
+		return nil, err
+	}
+	p := *params
+	p.NoSuperblock = true
+	p.HashAreaOffset = 0
+	if err := validateParams(&p, vh.hashFunc.Size()); err != nil {
+		return nil, err
+	}
+	return vh, nil
+}
+
+// hashRate hashes the first size bytes of rd in blockSize blocks and returns
+// the rate in bytes per second.
+func (vh *VerityHash) hashRate(rd io.ReaderAt, blockSize uint32, size uint64) (float64, error) {
+	blocks := size / uint64(blockSize)
+	if blocks == 0 {
+		return 0, fmt.Errorf("benchmark size %d is smaller than a %d byte block", size, blockSize)
+	}
+
+	digest := make([]byte, vh.hashFunc.Size())
+	start := time.Now()
+	err := vh.createOrVerify(rd, nil, 0, blockSize, 0, vh.hashBlockSize,
+		blocks, make([]byte, blockSize), false, digest)
+	if err != nil {
+		return 0, err
+	}
+	elapsed := time.Since(start).Seconds()
+	return float64(blocks*uint64(blockSize)) / elapsed, nil
+}
@@ -0,0 +1,67 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package verity
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBenchmarkHash(t *testing.T) {
+	p := &VerityParams{
+		HashName:      "sha256",
+		DataBlockSize: 4096,
+		HashBlockSize: 512,
+		HashType:      1,
+		Salt:          make([]byte, 32),
+		SaltSize:      32,
+	}
+	b, err := BenchmarkHash(p, 1<<20)
+	if err != nil {
+		t.Fatalf("BenchmarkHash failed: %v", err)
+	}
+	if b.DataRate <= 0 || b.HashRate <= 0 || b.DeviceRate != 0 {
+		t.Fatalf("unexpected rates: %+v", b)
+	}
+
+	// 256 data blocks need 16 + 1 hash blocks of 512 bytes.
+	b.DataRate, b.HashRate = 1<<20, 17*512
+	d, err := b.ProjectedTime(1 << 20)
+	if err != nil {
+		t.Fatalf("ProjectedTime failed: %v", err)
+	}
+	if d < 2*time.Second || d > 2*time.Second+100*time.Millisecond {
+		t.Errorf("expected about 2s projected, got %v", d)
+	}
+
+	dev, _ := createTestDataFile(t, 4096, 256)
+	if err := b.BenchmarkDevice(p, dev, 1<<30); err != nil {
+		t.Fatalf("BenchmarkDevice failed: %v", err)
+	}
+	if b.DeviceRate <= 0 {
+		t.Errorf("expected a device rate, got %v", b.DeviceRate)
+	}
+
+	if _, err := BenchmarkHash(p, 100); err == nil {
+		t.Error("expected error for a size below one block")
+	}
+	bad := *p
+	bad.SaltSize = MaxSaltSize + 1
+	if _, err := BenchmarkHash(&bad, 1<<20); err == nil {
+		t.Error("expected error for an oversized salt")
+	}
+}
@@ -0,0 +1,121 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package verity
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/containerd/go-dmverity/pkg/utils"
+)
+
+// VerityCheckHash checks the hash device without reading any data: the
+// superblock, the device size, and every hash block up to rootHash. Unless
+// params.NoSuperblock is set, the superblock is read at params.HashAreaOffset.
+func VerityCheckHash(params *VerityParams, hashDevice string, rootHash []byte) error {
+	if params == nil {
+		return errors.New("verity: nil params")
+	}
+
+	if !params.NoSuperblock {
+		if err := readCheckedSuperblock(params, hashDevice, params.HashAreaOffset); err != nil {
+			return err
+		}
+	}
+
+	vh, err := NewVerityHash(
+		params.HashName,
+		params.DataBlockSize, params.HashBlockSize,
+		params.DataBlocks,
+		params.HashType,
+		params.Salt,
+		params.HashAreaOffset,
+		hashDevice, hashDevice,
+		rootHash,
+	)
+	if err != nil {
+		return err
+	}
+
+	if err := validateParams(params, vh.hashFunc.Size()); err != nil {
+		return err
+	}
+	if len(rootHash) != vh.hashFunc.Size() {
+		return fmt.Errorf("invalid root hash size: got %d bytes, expected %d bytes for %s",
+			len(rootHash), vh.hashFunc.Size(), params.HashName)
+	}
+
+	treeSize, err := vh.GetHashTreeSize()
+	if err != nil {
+		return err
+	}
+	size, err := utils.GetBlockOrFileSize(hashDevice)
+	if err != nil {
+		return fmt.Errorf("cannot determine hash device size: %w", err)
+	}
+	if need := params.HashAreaOffset + treeSize; uint64(size) < need {
+		return fmt.Errorf("hash device too small: %d bytes, hash tree ends at %d", size, need)
+	}
+
+	return vh.CheckHashTree()
+}
+
+// readCheckedSuperblock adopts the superblock at sbOffset into params after
+// checking that its reserved fields, unused salt bytes and the rest of its
+// hash block are zero.
+func readCheckedSuperblock(params *VerityParams, hashDevice string, sbOffset uint64) error {
+	hashFile, err := os.Open(hashDevice)
+	if err != nil {
+		return fmt.Errorf("cannot open hash device: %w", err)
+	}
+	defer hashFile.Close()
+
+	sb, err := ReadSuperblock(hashFile, sbOffset)
+	if err != nil {
+		return err
+	}
+	if sb.SaltSize <= MaxSaltSize && !isZero(sb.Salt[sb.SaltSize:]) {
+		return errors.New("verity: superblock has data after the salt")
+	}
+	if !isZero(sb.Pad1[:]) || !isZero(sb.Pad2[:]) {
+		return errors.New("verity: superblock padding is not zeroed")
+	}
+
+	if err := adoptParamsFromSuperblock(params, sb, sbOffset); err != nil {
+		return err
+	}
+
+	spareStart := sbOffset + VeritySuperblockSize
+	if params.HashAreaOffset <= spareStart {
+		return nil
+	}
+	spare := make([]byte, params.HashAreaOffset-spareStart)
+	if err := readFullAt(hashFile, spare, int64(spareStart)); err != nil {
+		return fmt.Errorf("cannot read superblock spare area: %w", err)
+	}
+	return verifyZero(spare, spareStart)
+}
+
+func isZero(b []byte) bool {
+	for _, c := range b {
+		if c != 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,150 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package verity
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestVerityCheckHash(t *testing.T) {
+	tests := []struct {
+		name         string
+		hashType     uint32
+		noSuperblock bool
+	}{
+		{"superblock", 1, false},
+		{"no superblock", 1, true},
+		{"chrome os format", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dataPath, _ := createTestDataFile(t, 4096, 300)
+			defer os.Remove(dataPath)
+			hashPath := createTestHashFile(t, 0)
+			defer os.Remove(hashPath)
+
+			params := DefaultVerityParams()
+			params.HashType = tt.hashType
+			params.DataBlockSize = 4096
+			params.HashBlockSize = 4096
+			params.DataBlocks = 300
+			params.NoSuperblock = tt.noSuperblock
+			params.Salt = []byte{0x01, 0x02}
+			params.SaltSize = 2
+			if !tt.noSuperblock {
+				params.HashAreaOffset = 4096
+				testUUID := uuid.New()
+				copy(params.UUID[:], testUUID[:])
+			}
+			rootHash, err := VerityCreate(&params, dataPath, hashPath)
+			if err != nil {
+				t.Fatalf("VerityCreate failed: %v", err)
+			}
+
+			check := func(root []byte) error {
+				p := params
+				if !tt.noSuperblock {
+					p = VerityParams{}
+				}
+				return VerityCheckHash(&p, hashPath, root)
+			}
+
+			if err := check(rootHash); err != nil {
+				t.Fatalf("VerityCheckHash failed on an intact device: %v", err)
+			}
+
+			wrong := append([]byte(nil), rootHash...)
+			wrong[0] ^= 0xff
+			if err := check(wrong); err == nil {
+				t.Error("expected an error for a wrong root hash")
+			}
+			long := append(append([]byte(nil), rootHash...), make([]byte, len(rootHash))...)
+			if err := check(long); err == nil || !strings.Contains(err.Error(), "root hash size") {
+				t.Errorf("expected a root hash size error, got %v", err)
+			}
+
+			// A changed level 0 digest breaks the level above it, and data
+			// corruption is not visible at all.
+			levels, err := HashTreeLevels(&params)
+			if err != nil {
+				t.Fatalf("HashTreeLevels failed: %v", err)
+			}
+			corruptByte(t, hashPath, int64(levels[0].Offset))
+			if err := check(rootHash); err == nil {
+				t.Error("expected an error for a corrupted level 0 hash block")
+			}
+			corruptByte(t, hashPath, int64(levels[0].Offset))
+			corruptByte(t, dataPath, 0)
+			if err := check(rootHash); err != nil {
+				t.Errorf("data corruption should not affect the check: %v", err)
+			}
+
+			// The last level 0 block holds 300-256 digests; the rest is spare.
+			lastBlock := levels[0].Offset + (levels[0].Blocks-1)*4096
+			corruptByte(t, hashPath, int64(lastBlock+4095))
+			if err := check(rootHash); err == nil || !strings.Contains(err.Error(), "not zeroed") {
+				t.Errorf("expected a spare area error, got %v", err)
+			}
+			corruptByte(t, hashPath, int64(lastBlock+4095))
+
+			if err := os.Truncate(hashPath, int64(lastBlock+2048)); err != nil {
+				t.Fatal(err)
+			}
+			if err := check(rootHash); err == nil || !strings.Contains(err.Error(), "too small") {
+				t.Errorf("expected a size error, got %v", err)
+			}
+		})
+	}
+}
+
+func TestVerityCheckHash_SuperblockPadding(t *testing.T) {
+	dataPath, _ := createTestDataFile(t, 4096, 8)
+	defer os.Remove(dataPath)
+	hashPath := createTestHashFile(t, 0)
+	defer os.Remove(hashPath)
+
+	params := DefaultVerityParams()
+	params.DataBlockSize = 4096
+	params.HashBlockSize = 4096
+	params.DataBlocks = 8
+	params.HashAreaOffset = 4096
+	testUUID := uuid.New()
+	copy(params.UUID[:], testUUID[:])
+	rootHash, err := VerityCreate(&params, dataPath, hashPath)
+	if err != nil {
+		t.Fatalf("VerityCreate failed: %v", err)
+	}
+
+	corruptByte(t, hashPath, VeritySuperblockSize-1)
+	var p VerityParams
+	if err := VerityCheckHash(&p, hashPath, rootHash); err == nil || !strings.Contains(err.Error(), "padding") {
+		t.Errorf("expected a superblock padding error, got %v", err)
+	}
+
+	corruptByte(t, hashPath, VeritySuperblockSize-1)
+
+	corruptByte(t, hashPath, VeritySuperblockSize+100)
+	p = VerityParams{}
+	if err := VerityCheckHash(&p, hashPath, rootHash); err == nil || !strings.Contains(err.Error(), "not zeroed") {
+		t.Errorf("expected a spare area error, got %v", err)
+	}
+}
@@ -0,0 +1,191 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package verity
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	CheckpointVersion = 1
+
+	defaultCheckpointInterval = 10 * time.Second
+)
+
+// VerifyCheckpoint is the saved progress of a VerityVerify run. Everything
+// before Level and Block has been checked against the hash device, so a
+// resumed run trusts the checkpoint file as much as it trusts the devices
+// not to have changed in between.
+type VerifyCheckpoint struct {
+	Version    int          `json:"version"`
+	Params     VerityParams `json:"params"`
+	RootHash   HexBytes     `json:"root_hash"`
+	DataDevice string       `json:"data_device"`
+	HashDevice string       `json:"hash_device"`
+	// Level is the tree level being checked: 0 hashes the data blocks and
+	// level i > 0 the hash blocks of level i-1.
+	Level int `json:"level"`
+	// Block counts the blocks of the level's input hashed so far. Partial
+	// holds the digests of those not yet compared, which fill the start of
+	// the current hash block.
+	Block   uint64   `json:"block"`
+	Partial HexBytes `json:"partial,omitempty"`
+}
+
+// ReadVerifyCheckpoint reads the checkpoint file at path.
+func ReadVerifyCheckpoint(path string) (*VerifyCheckpoint, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var cp VerifyCheckpoint
+	if err := json.Unmarshal(b, &cp); err != nil {
+		return nil, fmt.Errorf("verity: checkpoint %s: %w", path, err)
+	}
+	if cp.Version != CheckpointVersion {
+		return nil, fmt.Errorf("verity: checkpoint %s: unsupported version %d", path, cp.Version)
+	}
+	return &cp, nil
+}
+
+// checkpointer saves the progress of one verification to a file.
+type checkpointer struct {
+	path     string
+	interval time.Duration
+	state    VerifyCheckpoint
+	last     time.Time
+}
+
+// loadCheckpoint resumes from params.CheckpointFile if it exists and
+// describes the same tree and devices, and starts afresh otherwise.
+func loadCheckpoint(params *VerityParams, dataDevice, hashDevice string, rootHash []byte) (*checkpointer, error) {
+	c := &checkpointer{
+		path:     params.CheckpointFile,
+		interval: params.CheckpointInterval,
+		state: VerifyCheckpoint{
+			Version:    CheckpointVersion,
+			Params:     *params,
+			RootHash:   rootHash,
+			DataDevice: dataDevice,
+			HashDevice: hashDevice,
+		},
+		last: time.Now(),
+	}
+	if c.interval <= 0 {
+		c.interval = defaultCheckpointInterval
+	}
+
+	saved, err := ReadVerifyCheckpoint(c.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	want, err := json.Marshal(c.state.Params)
+	if err != nil {
+		return nil, err
+	}
+	got, err := json.Marshal(saved.Params)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(want, got) || !bytes.Equal(rootHash, saved.RootHash) ||
+		saved.DataDevice != dataDevice || saved.HashDevice != hashDevice {
+		return nil, fmt.Errorf("verity: checkpoint %s is for a different tree or devices", c.path)
+	}
+	if saved.Level < 0 {
+		return nil, fmt.Errorf("verity: checkpoint %s: invalid level %d", c.path, saved.Level)
+	}
+	c.state.Level = saved.Level
+	c.state.Block = saved.Block
+	c.state.Partial = saved.Partial
+	return c, nil
+}
+
+// enter reports whether level still needs checking and, unless it is the
+// checkpointed level, resets the progress to its start.
+func (c *checkpointer) enter(level int) bool {
+	if c == nil {
+		return true
+	}
+	if level < c.state.Level {
+		return false
+	}
+	if level > c.state.Level {
+		c.state.Level = level
+		c.state.Block = 0
+		c.state.Partial = nil
+	}
+	return true
+}
+
+func (c *checkpointer) due() bool {
+	return c != nil && time.Since(c.last) >= c.interval
+}
+
+// save records that block blocks of the current level are hashed and
+// partial holds the digests not yet compared.
+func (c *checkpointer) save(block uint64, partial []byte) error {
+	c.state.Block = block
+	c.state.Partial = bytes.Clone(partial)
+	c.last = time.Now()
+
+	b, err := json.MarshalIndent(&c.state, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(c.path), "."+filepath.Base(c.path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("cannot create checkpoint: %w", err)
+	}
+	tmpPath := tmp.Name()
+	defer os.Remove(tmpPath)
+	defer tmp.Close()
+
+	if _, err := tmp.Write(append(b, '\n')); err != nil {
+		return fmt.Errorf("cannot write checkpoint: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		return fmt.Errorf("cannot write checkpoint: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("cannot write checkpoint: %w", err)
+	}
+	if err := os.Rename(tmpPath, c.path); err != nil {
+		return fmt.Errorf("cannot replace checkpoint %s: %w", c.path, err)
+	}
+	return nil
+}
+
+// remove deletes the checkpoint file once verification has succeeded.
+func (c *checkpointer) remove() error {
+	if c == nil {
+		return nil
+	}
+	if err := os.Remove(c.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
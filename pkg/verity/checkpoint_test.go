@@ -0,0 +1,175 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package verity
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestVerifyCheckpointResume(t *testing.T) {
+	tests := []struct {
+		name          string
+		dataBlockSize uint32
+		hashBlockSize uint32
+		dataBlocks    uint64
+		stopAt        uint64 // first data block that cannot be read
+		wantPartial   bool
+	}{
+		{"512B blocks", 512, 512, 8192, 4096, false},
+		{"large data blocks", 128 << 10, 4096, 64, 32, true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			dataPath, data := createTestDataFile(t, tc.dataBlockSize, tc.dataBlocks)
+			defer os.Remove(dataPath)
+			hashPath := createTestHashFile(t, 0)
+			defer os.Remove(hashPath)
+
+			params := DefaultVerityParams()
+			params.DataBlockSize = tc.dataBlockSize
+			params.HashBlockSize = tc.hashBlockSize
+			params.DataBlocks = tc.dataBlocks
+			params.NoSuperblock = true
+			rootHash, err := VerityCreate(&params, dataPath, hashPath)
+			if err != nil {
+				t.Fatalf("VerityCreate failed: %v", err)
+			}
+
+			cpPath := filepath.Join(t.TempDir(), "verify.state")
+			params.CheckpointFile = cpPath
+			params.CheckpointInterval = time.Nanosecond
+
+			// Interrupt the first run by making the data short.
+			stop := int64(tc.stopAt)*int64(tc.dataBlockSize) + 100
+			if err := os.Truncate(dataPath, stop); err != nil {
+				t.Fatal(err)
+			}
+			if err := VerityVerify(&params, dataPath, hashPath, rootHash); err == nil {
+				t.Fatal("expected verification of short data to fail")
+			}
+			cp, err := ReadVerifyCheckpoint(cpPath)
+			if err != nil {
+				t.Fatalf("ReadVerifyCheckpoint failed: %v", err)
+			}
+			if cp.Level != 0 || cp.Block != tc.stopAt || (len(cp.Partial) > 0) != tc.wantPartial {
+				t.Fatalf("unexpected checkpoint: level %d block %d partial %d bytes", cp.Level, cp.Block, len(cp.Partial))
+			}
+
+			// Restore the data but corrupt a block that was already
+			// checked: the resumed run must not look at it again.
+			data[tc.dataBlockSize*3] ^= 0xff
+			if err := os.WriteFile(dataPath, data, 0o644); err != nil {
+				t.Fatal(err)
+			}
+			if err := VerityVerify(&params, dataPath, hashPath, rootHash); err != nil {
+				t.Fatalf("resumed VerityVerify failed: %v", err)
+			}
+			if _, err := os.Stat(cpPath); !errors.Is(err, os.ErrNotExist) {
+				t.Errorf("expected checkpoint to be removed, got %v", err)
+			}
+
+			// Without the checkpoint the corruption is found.
+			if err := VerityVerify(&params, dataPath, hashPath, rootHash); err == nil {
+				t.Error("expected corrupted data to fail a fresh verification")
+			}
+		})
+	}
+}
+
+func TestVerifyCheckpointMismatch(t *testing.T) {
+	dataPath, _ := createTestDataFile(t, 4096, 64)
+	defer os.Remove(dataPath)
+	hashPath := createTestHashFile(t, 0)
+	defer os.Remove(hashPath)
+
+	params := DefaultVerityParams()
+	params.DataBlockSize = 4096
+	params.HashBlockSize = 4096
+	params.DataBlocks = 64
+	params.NoSuperblock = true
+	rootHash, err := VerityCreate(&params, dataPath, hashPath)
+	if err != nil {
+		t.Fatalf("VerityCreate failed: %v", err)
+	}
+
+	cpPath := filepath.Join(t.TempDir(), "verify.state")
+	params.CheckpointFile = cpPath
+	c, err := loadCheckpoint(&params, dataPath, hashPath, rootHash)
+	if err != nil {
+		t.Fatalf("loadCheckpoint failed: %v", err)
+	}
+	c.enter(1)
+	if err := c.save(0, nil); err != nil {
+		t.Fatalf("save failed: %v", err)
+	}
+
+	other := params
+	other.DataBlocks = 32
+	if err := VerityVerify(&other, dataPath, hashPath, rootHash); err == nil {
+		t.Error("expected a checkpoint for other params to be rejected")
+	}
+	if err := VerityVerify(&params, dataPath, dataPath, rootHash); err == nil {
+		t.Error("expected a checkpoint for another hash device to be rejected")
+	}
+
+	// A checkpoint past level 0 skips the data, so that it is never read.
+	if err := os.Truncate(dataPath, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := VerityVerify(&params, dataPath, hashPath, rootHash); err != nil {
+		t.Errorf("VerityVerify from level 1 failed: %v", err)
+	}
+}
+
+func TestIOLimiter(t *testing.T) {
+	var nilLimiter *ioLimiter
+	nilLimiter.wait(1 << 30)
+	if newIOLimiter(0, 0) != nil {
+		t.Error("expected no limiter without limits")
+	}
+
+	tests := []struct {
+		name        string
+		bytesPerSec uint64
+		iops        uint64
+		size        int
+	}{
+		{"bandwidth", 10 << 20, 0, 1 << 20},
+		{"iops", 0, 50, 1},
+		{"both", 100 << 20, 50, 1 << 20},
+	}
+	for _, tc := range tests {
+		l := newIOLimiter(tc.bytesPerSec, tc.iops)
+		start := time.Now()
+		for range 6 {
+			l.wait(tc.size)
+		}
+		// Five waits of 100ms (bandwidth) or 20ms (iops) each.
+		want := 100 * time.Millisecond
+		if tc.bytesPerSec == 10<<20 {
+			want = 500 * time.Millisecond
+		}
+		if elapsed := time.Since(start); elapsed < want-10*time.Millisecond {
+			t.Errorf("%s: 6 operations took %v, expected at least %v", tc.name, elapsed, want)
+		}
+	}
+}
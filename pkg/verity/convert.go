@@ -0,0 +1,144 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package verity
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/containerd/go-dmverity/pkg/utils"
+)
+
+// VerityConvert adds or removes the superblock of the hash file hashPath in
+// place. params describe the current layout: the superblock is read at
+// offset 0 unless params.NoSuperblock is set. A hash tree without superblock
+// must start at offset 0; with one it starts after the superblock, aligned
+// to the hash block size. Adding a superblock requires params.UUID.
+//
+// The converted file is written next to hashPath, checked against rootHash
+// with VerityCheckHash and then renamed over hashPath, so a failure leaves
+// the original untouched. On success params describe the new layout. Block
+// devices are rejected: they cannot be replaced atomically, and a tree
+// gaining a superblock may not fit.
+func VerityConvert(params *VerityParams, hashPath string, rootHash []byte, toSuperblock bool) error {
+	if params == nil {
+		return errors.New("verity: nil params")
+	}
+	st, err := os.Stat(hashPath)
+	if err != nil {
+		return err
+	}
+	if !st.Mode().IsRegular() {
+		return fmt.Errorf("verity: %s is not a regular file; only hash files can be converted, "+
+			"use migrate to write a block device with a new layout", hashPath)
+	}
+	if params.NoSuperblock != toSuperblock {
+		if toSuperblock {
+			return errors.New("verity: hash device already has a superblock")
+		}
+		return errors.New("verity: hash device already has no superblock")
+	}
+	if params.HashAreaOffset != 0 {
+		return fmt.Errorf("verity: hash area offset %d: only separate hash devices can be converted", params.HashAreaOffset)
+	}
+
+	// Checking the source also fills src from its superblock.
+	src := *params
+	if err := VerityCheckHash(&src, hashPath, rootHash); err != nil {
+		return fmt.Errorf("source hash device: %w", err)
+	}
+
+	dst := src
+	if toSuperblock {
+		dst.NoSuperblock = false
+		dst.UUID = params.UUID
+		if dst.UUID == ([16]byte{}) {
+			return errors.New("verity: UUID required to add a superblock")
+		}
+		dst.HashAreaOffset = utils.AlignUp(uint64(VeritySuperblockSize), uint64(dst.HashBlockSize))
+	} else {
+		dst.NoSuperblock = true
+		dst.UUID = [16]byte{}
+		dst.HashAreaOffset = 0
+	}
+
+	treeSize, err := GetHashTreeSize(&src)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(hashPath), "."+filepath.Base(hashPath)+".convert-*")
+	if err != nil {
+		return fmt.Errorf("cannot create temporary hash file: %w", err)
+	}
+	tmpPath := tmp.Name()
+	defer os.Remove(tmpPath)
+	defer tmp.Close()
+
+	if err := writeConvertedHash(tmp, hashPath, &src, &dst, treeSize); err != nil {
+		return err
+	}
+	if err := tmp.Chmod(st.Mode().Perm()); err != nil {
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	check := dst
+	if !dst.NoSuperblock {
+		check = VerityParams{}
+	}
+	if err := VerityCheckHash(&check, tmpPath, rootHash); err != nil {
+		return fmt.Errorf("converted hash device: %w", err)
+	}
+
+	if err := os.Rename(tmpPath, hashPath); err != nil {
+		return fmt.Errorf("cannot replace %s: %w", hashPath, err)
+	}
+	*params = dst
+	return nil
+}
+
+// writeConvertedHash writes the superblock of dst, if any, and copies the
+// hash tree of src to dst.HashAreaOffset.
+func writeConvertedHash(w *os.File, srcPath string, src, dst *VerityParams, treeSize uint64) error {
+	if !dst.NoSuperblock {
+		sb, err := buildSuperblockFromParams(dst)
+		if err != nil {
+			return err
+		}
+		if err := sb.WriteSuperblock(w, 0); err != nil {
+			return err
+		}
+	}
+
+	in, err := os.Open(srcPath)
+	if err != nil {
+		return fmt.Errorf("cannot open hash device: %w", err)
+	}
+	defer in.Close()
+
+	tree := io.NewSectionReader(in, int64(src.HashAreaOffset), int64(treeSize))
+	if _, err := io.Copy(io.NewOffsetWriter(w, int64(dst.HashAreaOffset)), tree); err != nil {
+		return fmt.Errorf("cannot copy hash tree: %w", err)
+	}
+	return w.Sync()
+}
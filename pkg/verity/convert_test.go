@@ -0,0 +1,99 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package verity
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestVerityConvert(t *testing.T) {
+	dataPath, _ := createTestDataFile(t, 4096, 300)
+	defer os.Remove(dataPath)
+	hashPath := createTestHashFile(t, 0)
+	defer os.Remove(hashPath)
+
+	params := DefaultVerityParams()
+	params.DataBlockSize = 4096
+	params.HashBlockSize = 4096
+	params.DataBlocks = 300
+	params.HashAreaOffset = 4096
+	params.Salt = []byte{0x01, 0x02}
+	params.SaltSize = 2
+	testUUID := uuid.New()
+	copy(params.UUID[:], testUUID[:])
+	rootHash, err := VerityCreate(&params, dataPath, hashPath)
+	if err != nil {
+		t.Fatalf("VerityCreate failed: %v", err)
+	}
+	if err := os.Chmod(hashPath, 0640); err != nil {
+		t.Fatal(err)
+	}
+
+	var p VerityParams
+	if err := VerityConvert(&p, hashPath, rootHash, true); err == nil {
+		t.Error("expected an error adding a superblock twice")
+	}
+
+	wrong := append([]byte(nil), rootHash...)
+	wrong[0] ^= 0xff
+	if err := VerityConvert(&p, hashPath, wrong, false); err == nil || !strings.Contains(err.Error(), "source") {
+		t.Errorf("expected a source check error, got %v", err)
+	}
+
+	p = VerityParams{}
+	if err := VerityConvert(&p, hashPath, rootHash, false); err != nil {
+		t.Fatalf("removing the superblock failed: %v", err)
+	}
+	if !p.NoSuperblock || p.HashAreaOffset != 0 || p.DataBlocks != 300 || string(p.Salt) != "\x01\x02" {
+		t.Errorf("unexpected params after removing the superblock: %+v", p)
+	}
+	if st, err := os.Stat(hashPath); err != nil || st.Mode().Perm() != 0640 {
+		t.Errorf("file mode not kept: %v %v", st.Mode(), err)
+	}
+	noSB := p
+	if err := VerityVerify(&noSB, dataPath, hashPath, rootHash); err != nil {
+		t.Errorf("VerityVerify without superblock failed: %v", err)
+	}
+
+	if err := VerityConvert(&p, hashPath, rootHash, true); err == nil || !strings.Contains(err.Error(), "UUID") {
+		t.Errorf("expected a missing UUID error, got %v", err)
+	}
+	p.UUID = params.UUID
+	if err := VerityConvert(&p, hashPath, rootHash, true); err != nil {
+		t.Fatalf("adding the superblock failed: %v", err)
+	}
+	if p.NoSuperblock || p.HashAreaOffset != 4096 {
+		t.Errorf("unexpected params after adding the superblock: %+v", p)
+	}
+
+	sbParams := VerityParams{}
+	if err := VerityVerify(&sbParams, dataPath, hashPath, rootHash); err != nil {
+		t.Errorf("VerityVerify with superblock failed: %v", err)
+	}
+	if sbParams.UUID != params.UUID {
+		t.Errorf("UUID = %x, want %x", sbParams.UUID, params.UUID)
+	}
+
+	devParams := VerityParams{}
+	if err := VerityConvert(&devParams, "/dev/null", rootHash, false); err == nil || !strings.Contains(err.Error(), "not a regular file") {
+		t.Errorf("expected a non-regular file error, got %v", err)
+	}
+}
@@ -0,0 +1,51 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package verity
+
+import (
+	"errors"
+	"os"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// directIOAlign is the alignment of the buffers used for O_DIRECT I/O.
+const directIOAlign = 4096
+
+// openForIO opens path with flag, adding O_DIRECT when direct is set. A file
+// on which O_DIRECT is rejected, such as one on tmpfs, is opened buffered.
+func openForIO(path string, flag int, direct bool) (*os.File, error) {
+	if direct {
+		f, err := os.OpenFile(path, flag|unix.O_DIRECT, 0)
+		if !errors.Is(err, unix.EINVAL) {
+			return f, err
+		}
+	}
+	return os.OpenFile(path, flag, 0)
+}
+
+// alignedBuffer returns a zeroed buffer of size bytes starting on a
+// directIOAlign boundary.
+func alignedBuffer(size int) []byte {
+	buf := make([]byte, size+directIOAlign)
+	off := 0
+	if rem := int(uintptr(unsafe.Pointer(&buf[0])) & (directIOAlign - 1)); rem != 0 {
+		off = directIOAlign - rem
+	}
+	return buf[off : off+size : off+size]
+}
@@ -0,0 +1,131 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package verity
+
+import (
+	"bytes"
+	"os"
+	"testing"
+	"unsafe"
+)
+
+func TestVerityDirectIO(t *testing.T) {
+	tests := []struct {
+		name          string
+		dataBlockSize uint32
+		hashBlockSize uint32
+		dataBlocks    uint64
+	}{
+		{"4K blocks", 4096, 4096, 300},
+		{"512B blocks", 512, 512, 1001},
+		{"mixed blocks", 512, 4096, 513},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			dataPath, _ := createTestDataFile(t, tc.dataBlockSize, tc.dataBlocks)
+			defer os.Remove(dataPath)
+
+			create := func(direct bool) (string, []byte) {
+				hashPath := createTestHashFile(t, 0)
+				params := DefaultVerityParams()
+				params.DataBlockSize = tc.dataBlockSize
+				params.HashBlockSize = tc.hashBlockSize
+				params.DataBlocks = tc.dataBlocks
+				params.HashAreaOffset = uint64(tc.hashBlockSize)
+				params.Salt = []byte{0x01, 0x02, 0x03}
+				params.SaltSize = 3
+				params.UUID = [16]byte{0x12, 0x34, 0x56, 0x78}
+				params.DirectIO = direct
+				rootHash, err := VerityCreate(&params, dataPath, hashPath)
+				if err != nil {
+					t.Fatalf("VerityCreate(direct=%v) failed: %v", direct, err)
+				}
+				return hashPath, rootHash
+			}
+
+			bufferedPath, bufferedRoot := create(false)
+			defer os.Remove(bufferedPath)
+			directPath, directRoot := create(true)
+			defer os.Remove(directPath)
+
+			if !bytes.Equal(bufferedRoot, directRoot) {
+				t.Fatalf("root hash differs: buffered %x direct %x", bufferedRoot, directRoot)
+			}
+			buffered, err := os.ReadFile(bufferedPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			direct, err := os.ReadFile(directPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(buffered, direct) {
+				t.Fatal("hash device written with direct IO differs")
+			}
+
+			params := DefaultVerityParams()
+			params.HashName = ""
+			params.DirectIO = true
+			if err := VerityVerify(&params, dataPath, directPath, directRoot); err != nil {
+				t.Fatalf("VerityVerify with direct IO failed: %v", err)
+			}
+
+			corruptByte(t, dataPath, int64(tc.dataBlockSize)*int64(tc.dataBlocks-1))
+			params = DefaultVerityParams()
+			params.HashName = ""
+			params.DirectIO = true
+			if err := VerityVerify(&params, dataPath, directPath, directRoot); err == nil {
+				t.Error("expected VerityVerify with direct IO to detect corruption")
+			}
+		})
+	}
+}
+
+func TestOpenForIOFallback(t *testing.T) {
+	dir := "/dev/shm"
+	if st, err := os.Stat(dir); err != nil || !st.IsDir() {
+		t.Skip("no tmpfs to test the buffered fallback on")
+	}
+	f, err := os.CreateTemp(dir, "directio-")
+	if err != nil {
+		t.Skip(err)
+	}
+	defer os.Remove(f.Name())
+	f.Close()
+
+	f, err = openForIO(f.Name(), os.O_RDWR, true)
+	if err != nil {
+		t.Fatalf("openForIO failed: %v", err)
+	}
+	defer f.Close()
+	if _, err := f.WriteAt([]byte("unaligned"), 3); err != nil {
+		t.Errorf("write after fallback failed: %v", err)
+	}
+}
+
+func TestAlignedBuffer(t *testing.T) {
+	for _, size := range []int{512, 4096, 1 << 20} {
+		buf := alignedBuffer(size)
+		if len(buf) != size || cap(buf) != size {
+			t.Errorf("alignedBuffer(%d): len %d cap %d", size, len(buf), cap(buf))
+		}
+		if addr := uintptr(unsafe.Pointer(&buf[0])); addr%directIOAlign != 0 {
+			t.Errorf("alignedBuffer(%d) starts at %#x", size, addr)
+		}
+	}
+}
@@ -0,0 +1,159 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package verity
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha3"
+	"crypto/sha512"
+	"fmt"
+	"hash"
+	"slices"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/blake2b"
+
+	"github.com/containerd/go-dmverity/pkg/afalg"
+)
+
+// hashErr returns the error kept by a hasher that cannot report it through
+// hash.Hash, like those of package afalg.
+func hashErr(h hash.Hash) error {
+	if e, ok := h.(interface{ Err() error }); ok {
+		return e.Err()
+	}
+	return nil
+}
+
+// hashFunction creates the hashers of a tree. It is implemented by
+// registered algorithms and kernel hashes from package afalg.
+type hashFunction interface {
+	New() hash.Hash
+	Size() int
+}
+
+type registeredHash struct {
+	size    int
+	newHash func() hash.Hash
+}
+
+func (r *registeredHash) New() hash.Hash { return r.newHash() }
+func (r *registeredHash) Size() int      { return r.size }
+
+var (
+	hashRegistryMu sync.RWMutex
+	hashRegistry   = map[string]*registeredHash{}
+)
+
+func init() {
+	RegisterHash("sha1", sha1.Size, sha1.New)
+	RegisterHash("sha224", sha256.Size224, sha256.New224)
+	RegisterHash("sha256", sha256.Size, sha256.New)
+	RegisterHash("sha384", sha512.Size384, sha512.New384)
+	RegisterHash("sha512", sha512.Size, sha512.New)
+	RegisterHash("sha3-224", 28, func() hash.Hash { return sha3.New224() })
+	RegisterHash("sha3-256", 32, func() hash.Hash { return sha3.New256() })
+	RegisterHash("sha3-384", 48, func() hash.Hash { return sha3.New384() })
+	RegisterHash("sha3-512", 64, func() hash.Hash { return sha3.New512() })
+	for _, size := range []int{20, 32, 48, 64} {
+		RegisterHash(fmt.Sprintf("blake2b-%d", size*8), size, func() hash.Hash {
+			h, err := blake2b.New(size, nil)
+			if err != nil {
+				panic(err)
+			}
+			return h
+		})
+	}
+}
+
+// RegisterHash makes a hash algorithm available for hash trees under its
+// kernel crypto API name, which is what dm-verity tables and superblocks
+// record. newHash must return hashers with size byte digests. Registering a
+// name again replaces the earlier algorithm, including a built-in one.
+func RegisterHash(name string, size int, newHash func() hash.Hash) {
+	name = normalizeHashName(name)
+	if name == "" || len(name) > len(VeritySuperblock{}.Algorithm) {
+		panic(fmt.Sprintf("verity: invalid hash algorithm name %q", name))
+	}
+	if size <= 0 || size > VerityMaxDigestSize || newHash == nil {
+		panic(fmt.Sprintf("verity: invalid hash algorithm %s", name))
+	}
+
+	hashRegistryMu.Lock()
+	defer hashRegistryMu.Unlock()
+	hashRegistry[name] = &registeredHash{size: size, newHash: newHash}
+}
+
+// HashAlgorithms returns the names of the registered hash algorithms in
+// sorted order. Other algorithms of the running kernel are also accepted.
+func HashAlgorithms() []string {
+	hashRegistryMu.RLock()
+	defer hashRegistryMu.RUnlock()
+	names := make([]string, 0, len(hashRegistry))
+	for name := range hashRegistry {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// HashSize returns the digest size of the named hash algorithm.
+func HashSize(name string) (int, error) {
+	h, err := lookupHash(name)
+	if err != nil {
+		return 0, err
+	}
+	return h.Size(), nil
+}
+
+// ValidateRootHashSize checks that rootDigest is a digest of the named hash
+// algorithm.
+func ValidateRootHashSize(rootDigest []byte, hashName string) error {
+	size, err := HashSize(hashName)
+	if err != nil {
+		return err
+	}
+	if len(rootDigest) != size {
+		return fmt.Errorf("invalid root hash size: got %d bytes, expected %d bytes for %s",
+			len(rootDigest), size, hashName)
+	}
+	return nil
+}
+
+// lookupHash returns the registered algorithm called name, or the kernel's
+// through AF_ALG for names that are not registered.
+func lookupHash(name string) (hashFunction, error) {
+	name = normalizeHashName(name)
+
+	hashRegistryMu.RLock()
+	r, ok := hashRegistry[name]
+	hashRegistryMu.RUnlock()
+	if ok {
+		return r, nil
+	}
+
+	if h, err := afalg.NewHash(name); err == nil {
+		return h, nil
+	}
+	return nil, fmt.Errorf("verity: hash algorithm %q not supported", name)
+}
+
+func normalizeHashName(name string) string {
+	return strings.ToLower(strings.TrimSpace(name))
+}
@@ -0,0 +1,202 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package verity
+
+import (
+	"crypto/sha256"
+	"errors"
+	"hash"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestHashAlgorithms(t *testing.T) {
+	names := HashAlgorithms()
+	for _, want := range []string{"sha1", "sha224", "sha256", "sha384", "sha512",
+		"sha3-224", "sha3-256", "sha3-384", "sha3-512",
+		"blake2b-160", "blake2b-256", "blake2b-384", "blake2b-512"} {
+		if !slices.Contains(names, want) {
+			t.Errorf("built-in %s not registered", want)
+		}
+	}
+	if !slices.IsSorted(names) {
+		t.Errorf("HashAlgorithms() not sorted: %v", names)
+	}
+}
+
+func TestRegisterHash(t *testing.T) {
+	// sha256 under another name must build the same tree as sha256.
+	RegisterHash("Test-SHA256", sha256.Size, sha256.New)
+	defer func() {
+		hashRegistryMu.Lock()
+		delete(hashRegistry, "test-sha256")
+		hashRegistryMu.Unlock()
+	}()
+
+	if size, err := HashSize("test-sha256"); err != nil || size != sha256.Size {
+		t.Fatalf("HashSize(test-sha256) = %d, %v", size, err)
+	}
+
+	dataPath, _ := createTestDataFile(t, 4096, 64)
+	defer os.Remove(dataPath)
+	create := func(name string) []byte {
+		hashPath := createTestHashFile(t, 0)
+		defer os.Remove(hashPath)
+		params := DefaultVerityParams()
+		params.HashName = name
+		params.DataBlockSize = 4096
+		params.HashBlockSize = 4096
+		params.DataBlocks = 64
+		params.NoSuperblock = true
+		rootHash, err := VerityCreate(&params, dataPath, hashPath)
+		if err != nil {
+			t.Fatalf("VerityCreate(%s) failed: %v", name, err)
+		}
+		return rootHash
+	}
+	if got, want := create("test-sha256"), create("sha256"); string(got) != string(want) {
+		t.Errorf("registered algorithm root %x, want %x", got, want)
+	}
+
+	invalid := []struct {
+		name    string
+		size    int
+		newHash func() hash.Hash
+	}{
+		{"", 32, sha256.New},
+		{strings.Repeat("x", 33), 32, sha256.New},
+		{"zero-size", 0, sha256.New},
+		{"nil-constructor", 32, nil},
+	}
+	for _, tt := range invalid {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("RegisterHash(%q, %d) did not panic", tt.name, tt.size)
+				}
+			}()
+			RegisterHash(tt.name, tt.size, tt.newHash)
+		}()
+	}
+}
+
+// failingHash is a hasher that, like those of package afalg, keeps an
+// error that hash.Hash cannot return.
+type failingHash struct {
+	hash.Hash
+}
+
+func (failingHash) Err() error { return errors.New("socket closed") }
+
+func TestHashError(t *testing.T) {
+	RegisterHash("test-failing", sha256.Size, func() hash.Hash { return failingHash{sha256.New()} })
+	defer func() {
+		hashRegistryMu.Lock()
+		delete(hashRegistry, "test-failing")
+		hashRegistryMu.Unlock()
+	}()
+
+	dataPath, _ := createTestDataFile(t, 4096, 16)
+	defer os.Remove(dataPath)
+	hashPath := createTestHashFile(t, 0)
+	defer os.Remove(hashPath)
+
+	params := DefaultVerityParams()
+	params.HashName = "test-failing"
+	params.DataBlockSize = 4096
+	params.HashBlockSize = 4096
+	params.DataBlocks = 16
+	params.NoSuperblock = true
+	p := params
+	if _, err := VerityCreate(&p, dataPath, hashPath); err == nil || !strings.Contains(err.Error(), "socket closed") {
+		t.Errorf("VerityCreate: expected the hasher error, got %v", err)
+	}
+	p = params
+	if err := VerityVerify(&p, dataPath, hashPath, make([]byte, sha256.Size)); err == nil || !strings.Contains(err.Error(), "socket closed") {
+		t.Errorf("VerityVerify: expected the hasher error, got %v", err)
+	}
+	if err := VerifyBlock(&params, "test-failing", make([]byte, 4096), nil, make([]byte, sha256.Size)); err == nil || !strings.Contains(err.Error(), "socket closed") {
+		t.Errorf("VerifyBlock: expected the hasher error, got %v", err)
+	}
+}
+
+func TestUnknownHashAlgorithm(t *testing.T) {
+	if _, err := NewVerityHash("no-such-hash", 4096, 4096, 1, 1, nil, 0, "", "", nil); err == nil {
+		t.Error("NewVerityHash accepted an unknown algorithm")
+	}
+
+	params := DefaultVerityParams()
+	if err := VerifyBlock(&params, "no-such-hash", make([]byte, 4096), nil, make([]byte, 32)); err == nil {
+		t.Error("VerifyBlock accepted an unknown algorithm")
+	}
+	if err := ValidateRootHashSize(make([]byte, 32), "no-such-hash"); err == nil {
+		t.Error("ValidateRootHashSize accepted an unknown algorithm")
+	}
+
+	dataPath, _ := createTestDataFile(t, 4096, 4)
+	defer os.Remove(dataPath)
+	hashPath := createTestHashFile(t, 0)
+	defer os.Remove(hashPath)
+	params.HashName = "no-such-hash"
+	params.DataBlockSize = 4096
+	params.HashBlockSize = 4096
+	params.DataBlocks = 4
+	params.NoSuperblock = true
+	if _, err := VerityCreate(&params, dataPath, hashPath); err == nil || !strings.Contains(err.Error(), "not supported") {
+		t.Errorf("VerityCreate with an unknown algorithm: %v", err)
+	}
+}
+
+func TestBuiltinHashTrees(t *testing.T) {
+	dataPath, _ := createTestDataFile(t, 4096, 100)
+	defer os.Remove(dataPath)
+
+	for _, name := range []string{"sha224", "sha384", "sha3-256", "sha3-512", "blake2b-256", "blake2b-512"} {
+		t.Run(name, func(t *testing.T) {
+			hashPath := createTestHashFile(t, 0)
+			defer os.Remove(hashPath)
+
+			params := DefaultVerityParams()
+			params.HashName = name
+			params.DataBlockSize = 4096
+			params.HashBlockSize = 4096
+			params.DataBlocks = 100
+			params.HashAreaOffset = 4096
+			params.Salt = []byte{0xab}
+			params.SaltSize = 1
+			params.UUID = [16]byte{1}
+			rootHash, err := VerityCreate(&params, dataPath, hashPath)
+			if err != nil {
+				t.Fatalf("VerityCreate failed: %v", err)
+			}
+			if err := ValidateRootHashSize(rootHash, name); err != nil {
+				t.Error(err)
+			}
+
+			verifyParams := DefaultVerityParams()
+			verifyParams.HashName = ""
+			if err := VerityVerify(&verifyParams, dataPath, hashPath, rootHash); err != nil {
+				t.Fatalf("VerityVerify failed: %v", err)
+			}
+			if verifyParams.HashName != name {
+				t.Errorf("superblock algorithm %q, want %q", verifyParams.HashName, name)
+			}
+		})
+	}
+}
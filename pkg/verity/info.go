@@ -0,0 +1,228 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package verity
+
+import (
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"github.com/containerd/go-dmverity/pkg/dm"
+)
+
+// HexBytes is a byte slice that is encoded as a hex string in JSON.
+type HexBytes []byte
+
+func (h HexBytes) String() string {
+	return hex.EncodeToString(h)
+}
+
+func (h HexBytes) MarshalText() ([]byte, error) {
+	return []byte(hex.EncodeToString(h)), nil
+}
+
+func (h *HexBytes) UnmarshalText(b []byte) error {
+	v, err := hex.DecodeString(string(b))
+	if err != nil {
+		return err
+	}
+	*h = v
+	return nil
+}
+
+// VerityInfo describes a hash device. RootHash is only set when it is known,
+// for example right after VerityCreate or from a Manifest.
+type VerityInfo struct {
+	Path           string       `json:"path"`
+	Params         VerityParams `json:"params"`
+	RootHash       HexBytes     `json:"root_hash,omitempty"`
+	HashBlocks     uint64       `json:"hash_blocks"`
+	HashDeviceSize uint64       `json:"hash_device_size"`
+	Levels         []TreeLevel  `json:"levels,omitempty"`
+}
+
+// TreeLevel is one level of the hash tree. Level 0 holds the digests of the
+// data blocks and the highest level is the single block hashed into the root
+// hash; it is stored first, at the hash area offset.
+type TreeLevel struct {
+	Level  int    `json:"level"`
+	Offset uint64 `json:"offset"`
+	Blocks uint64 `json:"blocks"`
+	Size   uint64 `json:"size"`
+}
+
+// HashTreeLevels returns the position of every hash tree level on the hash
+// device described by params.
+func HashTreeLevels(params *VerityParams) ([]TreeLevel, error) {
+	if params.DataBlocks == 0 {
+		return nil, fmt.Errorf("data blocks must be greater than 0")
+	}
+
+	vh, err := NewVerityHash(params.HashName, params.DataBlockSize, params.HashBlockSize, params.DataBlocks,
+		params.HashType, nil, params.HashAreaOffset, "", "", nil)
+	if err != nil {
+		return nil, err
+	}
+	levels, err := vh.hashLevels(params.DataBlocks)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]TreeLevel, len(levels))
+	for i, l := range levels {
+		out[i] = TreeLevel{
+			Level:  i,
+			Offset: l.offset,
+			Blocks: l.numBlocks,
+			Size:   l.numBlocks * uint64(params.HashBlockSize),
+		}
+	}
+	return out, nil
+}
+
+// DumpDeviceInfo reads the superblock of hashPath.
+func DumpDeviceInfo(hashPath string) (*VerityInfo, error) {
+	return DumpDeviceInfoAt(hashPath, 0)
+}
+
+// DumpDeviceInfoAt is like DumpDeviceInfo for a superblock stored at sbOffset.
+func DumpDeviceInfoAt(hashPath string, sbOffset uint64) (*VerityInfo, error) {
+	hashFile, err := os.Open(hashPath)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open hash device: %w", err)
+	}
+	defer hashFile.Close()
+
+	params := &VerityParams{}
+	superblock, err := ReadSuperblock(hashFile, sbOffset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read superblock: %w", err)
+	}
+
+	if err := adoptParamsFromSuperblock(params, superblock, sbOffset); err != nil {
+		return nil, fmt.Errorf("failed to adopt params from superblock: %w", err)
+	}
+
+	if _, err := superblock.UUIDString(); err != nil {
+		return nil, fmt.Errorf("failed to get UUID string: %w", err)
+	}
+	copy(params.UUID[:], superblock.UUID[:])
+
+	return ParamsInfo(hashPath, params)
+}
+
+// ParamsInfo describes a hash device from params alone, for hash devices
+// without a superblock. Like veritysetup dump, HashBlocks counts the blocks
+// of every tree level and HashDeviceSize is where the tree ends.
+func ParamsInfo(hashPath string, params *VerityParams) (*VerityInfo, error) {
+	levels, err := HashTreeLevels(params)
+	if err != nil {
+		return nil, err
+	}
+	var hashBlocks uint64
+	for _, l := range levels {
+		hashBlocks += l.Blocks
+	}
+
+	return &VerityInfo{
+		Path:           hashPath,
+		Params:         *params,
+		HashBlocks:     hashBlocks,
+		HashDeviceSize: params.HashAreaOffset + hashBlocks*uint64(params.HashBlockSize),
+	}, nil
+}
+
+// String formats i like veritysetup dump.
+func (i *VerityInfo) String() string {
+	params := &i.Params
+	var uuidStr string
+	if params.UUID != ([16]byte{}) {
+		uuidStr = uuid.UUID(params.UUID).String()
+	}
+
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("\nVERITY header information for %s\n", i.Path))
+	sb.WriteString(fmt.Sprintf("UUID:            \t%s\n", uuidStr))
+	sb.WriteString(fmt.Sprintf("Hash type:       \t%d\n", params.HashType))
+	sb.WriteString(fmt.Sprintf("Data blocks:     \t%d\n", params.DataBlocks))
+	sb.WriteString(fmt.Sprintf("Data block size: \t%d\n", params.DataBlockSize))
+	sb.WriteString(fmt.Sprintf("Hash blocks:     \t%d\n", i.HashBlocks))
+	sb.WriteString(fmt.Sprintf("Hash block size: \t%d\n", params.HashBlockSize))
+	sb.WriteString(fmt.Sprintf("Hash algorithm:  \t%s\n", params.HashName))
+
+	sb.WriteString("Salt:            \t")
+	if params.SaltSize > 0 {
+		sb.WriteString(fmt.Sprintf("%x\n", params.Salt[:params.SaltSize]))
+	} else {
+		sb.WriteString("-\n")
+	}
+
+	sb.WriteString(fmt.Sprintf("Hash device size: \t%d [bytes]\n", i.HashDeviceSize))
+	if len(i.RootHash) > 0 {
+		sb.WriteString(fmt.Sprintf("Root hash:       \t%x\n", []byte(i.RootHash)))
+	}
+	for _, l := range i.Levels {
+		sb.WriteString(fmt.Sprintf("Level %d:         \toffset %d, %d blocks, bytes %d-%d\n",
+			l.Level, l.Offset, l.Blocks, l.Offset, l.Offset+l.Size-1))
+	}
+	return sb.String()
+}
+
+// DeviceStatus describes an opened verity device. Status is the verity
+// target status ("V" verified, "C" corruption detected) of an active device.
+type DeviceStatus struct {
+	Name      string `json:"name"`
+	Path      string `json:"path"`
+	Active    bool   `json:"active"`
+	Major     uint32 `json:"major"`
+	Minor     uint32 `json:"minor"`
+	OpenCount int32  `json:"open_count"`
+	EventNr   uint32 `json:"event_nr"`
+	Status    string `json:"status,omitempty"`
+}
+
+func VerityStatus(name string) (*DeviceStatus, error) {
+	c, err := dm.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer c.Close()
+
+	st, err := c.DeviceStatus(name)
+	if err != nil {
+		return nil, err
+	}
+
+	ds := &DeviceStatus{
+		Name:      name,
+		Path:      "/dev/mapper/" + name,
+		Active:    st.ActivePresent,
+		Major:     st.Major,
+		Minor:     st.Minor,
+		OpenCount: st.OpenCount,
+		EventNr:   st.EventNr,
+	}
+	if st.ActivePresent {
+		if status, err := c.TableStatus(name, false); err == nil {
+			ds.Status = strings.TrimSpace(status)
+		}
+	}
+	return ds, nil
+}
@@ -0,0 +1,127 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package verity
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestDumpDeviceInfo(t *testing.T) {
+	dataPath, _ := createTestDataFile(t, 4096, 300)
+	defer os.Remove(dataPath)
+	hashPath := createTestHashFile(t, 0)
+	defer os.Remove(hashPath)
+
+	params := DefaultVerityParams()
+	params.DataBlockSize = 4096
+	params.HashBlockSize = 4096
+	params.DataBlocks = 300
+	params.HashAreaOffset = 4096
+	params.Salt = []byte{0xaa, 0xbb}
+	params.SaltSize = 2
+	testUUID := uuid.New()
+	copy(params.UUID[:], testUUID[:])
+	if _, err := VerityCreate(&params, dataPath, hashPath); err != nil {
+		t.Fatalf("VerityCreate failed: %v", err)
+	}
+
+	info, err := DumpDeviceInfo(hashPath)
+	if err != nil {
+		t.Fatalf("DumpDeviceInfo failed: %v", err)
+	}
+	if info.Path != hashPath || info.Params.DataBlocks != 300 || info.Params.UUID != params.UUID ||
+		!bytes.Equal(info.Params.Salt, params.Salt) || info.HashBlocks != 4 || info.HashDeviceSize != 4096+4*4096 {
+		t.Errorf("unexpected info: %+v", info)
+	}
+	if len(info.RootHash) != 0 {
+		t.Errorf("root hash should be unknown, got %x", info.RootHash)
+	}
+
+	text, err := DumpDevice(hashPath)
+	if err != nil {
+		t.Fatalf("DumpDevice failed: %v", err)
+	}
+	if text != info.String() {
+		t.Errorf("DumpDevice = %q, want %q", text, info.String())
+	}
+
+	info.RootHash = HexBytes{0x01, 0x02}
+	b, err := json.Marshal(info)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	var got VerityInfo
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if !reflect.DeepEqual(&got, info) {
+		t.Errorf("JSON round trip: got %+v, want %+v", got, info)
+	}
+}
+
+func TestDumpDeviceInfoNoSuperblock(t *testing.T) {
+	hashPath := createTestHashFile(t, 4096)
+	defer os.Remove(hashPath)
+
+	if _, err := DumpDeviceInfo(hashPath); err == nil {
+		t.Error("expected error for a hash device without a superblock")
+	}
+}
+
+func TestHashTreeLevels(t *testing.T) {
+	params := DefaultVerityParams()
+	params.DataBlockSize = 4096
+	params.HashBlockSize = 4096
+	params.DataBlocks = 128*128 + 1
+	params.HashAreaOffset = 8192
+
+	levels, err := HashTreeLevels(&params)
+	if err != nil {
+		t.Fatalf("HashTreeLevels failed: %v", err)
+	}
+	want := []TreeLevel{
+		{Level: 0, Offset: 8192 + 3*4096, Blocks: 129, Size: 129 * 4096},
+		{Level: 1, Offset: 8192 + 1*4096, Blocks: 2, Size: 2 * 4096},
+		{Level: 2, Offset: 8192, Blocks: 1, Size: 4096},
+	}
+	if !reflect.DeepEqual(levels, want) {
+		t.Errorf("HashTreeLevels = %+v, want %+v", levels, want)
+	}
+
+	treeSize, err := GetHashTreeSize(&params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var total uint64
+	for _, l := range levels {
+		total += l.Size
+	}
+	if total != treeSize {
+		t.Errorf("levels cover %d bytes, GetHashTreeSize = %d", total, treeSize)
+	}
+
+	params.HashName = "no-such-hash"
+	if _, err := HashTreeLevels(&params); err == nil {
+		t.Error("expected error for unsupported hash algorithm")
+	}
+}
@@ -0,0 +1,172 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package verity
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// BlockHash compares the digest stored in one hash tree level with the
+// digest computed from the block below it on the path to the root: the data
+// block for level 0, otherwise a hash block of the level below.
+type BlockHash struct {
+	Level       int      `json:"level"`
+	ChildOffset uint64   `json:"child_offset"`
+	Offset      uint64   `json:"offset"`
+	Stored      HexBytes `json:"stored"`
+	Computed    HexBytes `json:"computed"`
+	Match       bool     `json:"match"`
+}
+
+// BlockInspection is the hash path of one data block. RootHash is empty when
+// no root hash was given, in which case RootMatch is false.
+type BlockInspection struct {
+	Block        uint64      `json:"block"`
+	DataOffset   uint64      `json:"data_offset"`
+	Levels       []BlockHash `json:"levels"`
+	ComputedRoot HexBytes    `json:"computed_root"`
+	RootHash     HexBytes    `json:"root_hash,omitempty"`
+	RootMatch    bool        `json:"root_match"`
+}
+
+// Diagnosis names the block that is wrong. The highest mismatch on the path
+// is the one to trust: every level above it is authenticated by the root.
+func (bi *BlockInspection) Diagnosis() string {
+	if len(bi.RootHash) > 0 && !bi.RootMatch {
+		return "root hash mismatch: the root hash is wrong or the top hash block is corrupted"
+	}
+	for i := len(bi.Levels) - 1; i >= 0; i-- {
+		l := bi.Levels[i]
+		if l.Match {
+			continue
+		}
+		if i == 0 {
+			return fmt.Sprintf("data block %d is corrupted", bi.Block)
+		}
+		return fmt.Sprintf("level %d hash block at offset %d is corrupted", i-1, l.ChildOffset)
+	}
+	if len(bi.RootHash) == 0 {
+		return "hash path is consistent; no root hash given"
+	}
+	return "hash path is intact"
+}
+
+// InspectBlock walks the hash tree from data block block to the root and
+// records the stored and computed digest at every level. Mismatches are
+// reported in the result rather than as errors.
+func InspectBlock(params *VerityParams, dataDevice, hashDevice string, rootHash []byte, block uint64) (*BlockInspection, error) {
+	if params == nil {
+		return nil, errors.New("verity: nil params")
+	}
+	if err := readSuperblockParams(params, dataDevice, hashDevice); err != nil {
+		return nil, err
+	}
+	if block >= params.DataBlocks {
+		return nil, fmt.Errorf("block %d out of range: device has %d data blocks", block, params.DataBlocks)
+	}
+
+	vh, err := NewVerityHash(
+		params.HashName,
+		params.DataBlockSize, params.HashBlockSize,
+		params.DataBlocks,
+		params.HashType,
+		params.Salt,
+		params.HashAreaOffset,
+		dataDevice, hashDevice,
+		nil,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateParams(params, vh.hashFunc.Size()); err != nil {
+		return nil, err
+	}
+
+	levels, err := vh.hashLevels(params.DataBlocks)
+	if err != nil {
+		return nil, err
+	}
+
+	dataFile, err := os.Open(dataDevice)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open data device %s: %w", dataDevice, err)
+	}
+	defer dataFile.Close()
+	hashFile, err := os.Open(hashDevice)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open hash device %s: %w", hashDevice, err)
+	}
+	defer hashFile.Close()
+
+	digestSize := uint32(vh.hashFunc.Size())
+	hashPerBlock := uint64(1) << getBitsDown(params.HashBlockSize/digestSize)
+	entrySize := uint64(vh.getDigestSizeFull(digestSize))
+
+	bi := &BlockInspection{
+		Block:      block,
+		DataOffset: block * uint64(params.DataBlockSize),
+	}
+
+	child := make([]byte, params.DataBlockSize)
+	if err := readFullAt(dataFile, child, int64(bi.DataOffset)); err != nil {
+		return nil, fmt.Errorf("cannot read data block %d: %w", block, err)
+	}
+	childOffset := bi.DataOffset
+	hashBlock := make([]byte, params.HashBlockSize)
+
+	idx := block
+	for i, level := range levels {
+		computed, err := vh.verifyHashBlock(child, vh.salt)
+		if err != nil {
+			return nil, err
+		}
+
+		blockOffset := level.offset + (idx/hashPerBlock)*uint64(params.HashBlockSize)
+		if err := readFullAt(hashFile, hashBlock, int64(blockOffset)); err != nil {
+			return nil, fmt.Errorf("cannot read level %d hash block: %w", i, err)
+		}
+		entry := (idx % hashPerBlock) * entrySize
+		stored := append([]byte(nil), hashBlock[entry:entry+uint64(digestSize)]...)
+
+		bi.Levels = append(bi.Levels, BlockHash{
+			Level:       i,
+			ChildOffset: childOffset,
+			Offset:      blockOffset + entry,
+			Stored:      stored,
+			Computed:    computed,
+			Match:       bytes.Equal(stored, computed),
+		})
+
+		child = append(child[:0], hashBlock...)
+		childOffset = blockOffset
+		idx /= hashPerBlock
+	}
+
+	root, err := vh.verifyHashBlock(child, vh.salt)
+	if err != nil {
+		return nil, err
+	}
+	bi.ComputedRoot = root
+	if len(rootHash) > 0 {
+		bi.RootHash = append(HexBytes(nil), rootHash...)
+		bi.RootMatch = bytes.Equal(root, rootHash)
+	}
+	return bi, nil
+}
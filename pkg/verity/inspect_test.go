@@ -0,0 +1,150 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package verity
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func corruptByte(t *testing.T, path string, offset int64) {
+	t.Helper()
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		t.Fatalf("open %s: %v", path, err)
+	}
+	defer f.Close()
+	b := make([]byte, 1)
+	if _, err := f.ReadAt(b, offset); err != nil {
+		t.Fatalf("read %s: %v", path, err)
+	}
+	b[0] ^= 0xff
+	if _, err := f.WriteAt(b, offset); err != nil {
+		t.Fatalf("write %s: %v", path, err)
+	}
+}
+
+func TestInspectBlock(t *testing.T) {
+	dataPath, _ := createTestDataFile(t, 4096, 300)
+	defer os.Remove(dataPath)
+	hashPath := createTestHashFile(t, 0)
+	defer os.Remove(hashPath)
+
+	params := DefaultVerityParams()
+	params.DataBlockSize = 4096
+	params.HashBlockSize = 4096
+	params.DataBlocks = 300
+	params.HashAreaOffset = 4096
+	params.Salt = []byte{0x01, 0x02, 0x03, 0x04}
+	params.SaltSize = 4
+	testUUID := uuid.New()
+	copy(params.UUID[:], testUUID[:])
+	rootHash, err := VerityCreate(&params, dataPath, hashPath)
+	if err != nil {
+		t.Fatalf("VerityCreate failed: %v", err)
+	}
+
+	inspect := func(root []byte, block uint64) *BlockInspection {
+		t.Helper()
+		p := DefaultVerityParams()
+		bi, err := InspectBlock(&p, dataPath, hashPath, root, block)
+		if err != nil {
+			t.Fatalf("InspectBlock failed: %v", err)
+		}
+		return bi
+	}
+
+	bi := inspect(rootHash, 200)
+	if len(bi.Levels) != 2 || bi.DataOffset != 200*4096 || !bi.RootMatch {
+		t.Fatalf("unexpected inspection: %+v", bi)
+	}
+	for _, l := range bi.Levels {
+		if !l.Match {
+			t.Errorf("level %d mismatch on an intact tree", l.Level)
+		}
+	}
+	if got := bi.Diagnosis(); got != "hash path is intact" {
+		t.Errorf("Diagnosis = %q", got)
+	}
+	if got := inspect(nil, 200).Diagnosis(); !strings.Contains(got, "no root hash") {
+		t.Errorf("Diagnosis without root = %q", got)
+	}
+	if got := inspect([]byte{0x00}, 200).Diagnosis(); !strings.HasPrefix(got, "root hash mismatch") {
+		t.Errorf("Diagnosis with wrong root = %q", got)
+	}
+
+	corruptByte(t, dataPath, 200*4096+17)
+	bi = inspect(rootHash, 200)
+	if bi.Levels[0].Match || !bi.Levels[1].Match || !bi.RootMatch {
+		t.Errorf("expected a level 0 mismatch only: %+v", bi.Levels)
+	}
+	if got := bi.Diagnosis(); got != "data block 200 is corrupted" {
+		t.Errorf("Diagnosis = %q", got)
+	}
+	if !inspect(rootHash, 10).Levels[0].Match {
+		t.Error("block 10 should be unaffected")
+	}
+	corruptByte(t, dataPath, 200*4096+17)
+
+	levelBlock := bi.Levels[1].ChildOffset
+	corruptByte(t, hashPath, int64(bi.Levels[0].Offset))
+	bi = inspect(rootHash, 200)
+	if bi.Levels[1].Match {
+		t.Errorf("expected a level 1 mismatch: %+v", bi.Levels)
+	}
+	if want := "level 0 hash block at offset"; !strings.HasPrefix(bi.Diagnosis(), want) ||
+		bi.Levels[1].ChildOffset != levelBlock {
+		t.Errorf("Diagnosis = %q", bi.Diagnosis())
+	}
+
+	p := DefaultVerityParams()
+	if _, err := InspectBlock(&p, dataPath, hashPath, rootHash, 300); err == nil {
+		t.Error("expected an error for a block past the end of the device")
+	}
+
+	// Truncated devices are errors, not digests compared with stale bytes.
+	corruptByte(t, hashPath, int64(bi.Levels[0].Offset))
+	if err := os.Truncate(dataPath, 299*4096+2048); err != nil {
+		t.Fatal(err)
+	}
+	p = DefaultVerityParams()
+	if _, err := InspectBlock(&p, dataPath, hashPath, rootHash, 299); err == nil {
+		t.Error("expected an error for a truncated data device")
+	}
+	if err := os.Truncate(dataPath, 300*4096); err != nil {
+		t.Fatal(err)
+	}
+	p = DefaultVerityParams()
+	if _, err := InspectBlock(&p, dataPath, hashPath, rootHash, 299); err != nil {
+		t.Fatalf("InspectBlock failed: %v", err)
+	}
+
+	st, err := os.Stat(hashPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Truncate(hashPath, st.Size()-2048); err != nil {
+		t.Fatal(err)
+	}
+	p = DefaultVerityParams()
+	if _, err := InspectBlock(&p, dataPath, hashPath, rootHash, 299); err == nil {
+		t.Error("expected an error for a truncated hash device")
+	}
+}
@@ -0,0 +1,56 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package verity
+
+import "time"
+
+// ioLimiter paces I/O to at most bytesPerSec bytes and iops operations per
+// second. A nil ioLimiter or a zero limit does not wait.
+type ioLimiter struct {
+	bytesPerSec uint64
+	iops        uint64
+	next        time.Time
+}
+
+func newIOLimiter(bytesPerSec, iops uint64) *ioLimiter {
+	if bytesPerSec == 0 && iops == 0 {
+		return nil
+	}
+	return &ioLimiter{bytesPerSec: bytesPerSec, iops: iops}
+}
+
+// wait blocks until an operation of n bytes fits within the limits.
+func (l *ioLimiter) wait(n int) {
+	if l == nil {
+		return
+	}
+	var cost time.Duration
+	if l.bytesPerSec > 0 {
+		cost = time.Duration(float64(n) / float64(l.bytesPerSec) * float64(time.Second))
+	}
+	if l.iops > 0 {
+		cost = max(cost, time.Second/time.Duration(l.iops))
+	}
+
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	start := l.next
+	l.next = start.Add(cost)
+	time.Sleep(start.Sub(now))
+}
@@ -0,0 +1,230 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package verity
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"github.com/containerd/go-dmverity/pkg/utils"
+)
+
+const ManifestVersion = 1
+
+// paramsJSON is the stable JSON form of VerityParams. The salt and UUID are
+// encoded as hex and RFC 4122 strings, and SaltSize is implied by the salt.
+type paramsJSON struct {
+	HashName       string `json:"hash_algorithm"`
+	HashType       uint32 `json:"hash_type"`
+	DataBlockSize  uint32 `json:"data_block_size"`
+	HashBlockSize  uint32 `json:"hash_block_size"`
+	DataBlocks     uint64 `json:"data_blocks"`
+	Salt           string `json:"salt"`
+	HashAreaOffset uint64 `json:"hash_offset"`
+	NoSuperblock   bool   `json:"no_superblock"`
+	UUID           string `json:"uuid,omitempty"`
+}
+
+func (p VerityParams) MarshalJSON() ([]byte, error) {
+	j := paramsJSON{
+		HashName:       p.HashName,
+		HashType:       p.HashType,
+		DataBlockSize:  p.DataBlockSize,
+		HashBlockSize:  p.HashBlockSize,
+		DataBlocks:     p.DataBlocks,
+		HashAreaOffset: p.HashAreaOffset,
+		NoSuperblock:   p.NoSuperblock,
+	}
+	salt := p.Salt
+	if int(p.SaltSize) < len(salt) {
+		salt = salt[:p.SaltSize]
+	}
+	j.Salt = hex.EncodeToString(salt)
+	if p.UUID != ([16]byte{}) {
+		j.UUID = uuid.UUID(p.UUID).String()
+	}
+	return json.Marshal(j)
+}
+
+func (p *VerityParams) UnmarshalJSON(b []byte) error {
+	var j paramsJSON
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&j); err != nil {
+		return fmt.Errorf("verity: params: %w", err)
+	}
+
+	name := strings.ToLower(j.HashName)
+	if _, err := HashSize(name); err != nil {
+		return fmt.Errorf("verity: params: unsupported hash algorithm %q", j.HashName)
+	}
+	if j.HashType > VerityMaxHashType {
+		return fmt.Errorf("verity: params: unsupported hash type %d", j.HashType)
+	}
+	if !utils.IsBlockSizeValid(j.DataBlockSize) || !utils.IsBlockSizeValid(j.HashBlockSize) {
+		return fmt.Errorf("verity: params: invalid block sizes %d/%d", j.DataBlockSize, j.HashBlockSize)
+	}
+	if j.DataBlocks == 0 {
+		return errors.New("verity: params: data blocks must be greater than 0")
+	}
+	salt, err := hex.DecodeString(j.Salt)
+	if err != nil {
+		return fmt.Errorf("verity: params: invalid salt: %w", err)
+	}
+	if len(salt) > MaxSaltSize {
+		return fmt.Errorf("verity: params: salt size %d exceeds maximum of %d bytes", len(salt), MaxSaltSize)
+	}
+
+	*p = VerityParams{
+		HashName:       name,
+		HashType:       j.HashType,
+		DataBlockSize:  j.DataBlockSize,
+		HashBlockSize:  j.HashBlockSize,
+		DataBlocks:     j.DataBlocks,
+		Salt:           salt,
+		SaltSize:       uint16(len(salt)),
+		HashAreaOffset: j.HashAreaOffset,
+		NoSuperblock:   j.NoSuperblock,
+	}
+	if j.UUID != "" {
+		u, err := uuid.Parse(j.UUID)
+		if err != nil {
+			return fmt.Errorf("verity: params: invalid UUID %q: %w", j.UUID, err)
+		}
+		p.UUID = u
+	}
+	return nil
+}
+
+// Manifest records everything needed to verify or open a hash device next
+// to it, which matters most for devices formatted without a superblock.
+// Signature, when present, is an ed25519 signature over the manifest encoded
+// with an empty signature.
+type Manifest struct {
+	Version   int
+	Params    VerityParams
+	RootHash  []byte
+	Signature []byte
+}
+
+type manifestJSON struct {
+	Version   int          `json:"version"`
+	Params    VerityParams `json:"params"`
+	RootHash  string       `json:"root_hash"`
+	Signature []byte       `json:"signature,omitempty"`
+}
+
+func NewManifest(params *VerityParams, rootHash []byte) *Manifest {
+	return &Manifest{
+		Version:  ManifestVersion,
+		Params:   *params,
+		RootHash: append([]byte(nil), rootHash...),
+	}
+}
+
+func (m *Manifest) MarshalJSON() ([]byte, error) {
+	return json.Marshal(manifestJSON{
+		Version:   m.Version,
+		Params:    m.Params,
+		RootHash:  hex.EncodeToString(m.RootHash),
+		Signature: m.Signature,
+	})
+}
+
+func (m *Manifest) UnmarshalJSON(b []byte) error {
+	var j manifestJSON
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&j); err != nil {
+		return fmt.Errorf("verity: manifest: %w", err)
+	}
+	if j.Version != ManifestVersion {
+		return fmt.Errorf("verity: manifest: unsupported version %d", j.Version)
+	}
+	root, err := hex.DecodeString(j.RootHash)
+	if err != nil {
+		return fmt.Errorf("verity: manifest: invalid root hash: %w", err)
+	}
+	if size, _ := HashSize(j.Params.HashName); len(root) != size {
+		return fmt.Errorf("verity: manifest: root hash is %d bytes, %s digests are %d",
+			len(root), j.Params.HashName, size)
+	}
+	if len(j.Signature) != 0 && len(j.Signature) != ed25519.SignatureSize {
+		return fmt.Errorf("verity: manifest: invalid signature size %d", len(j.Signature))
+	}
+
+	*m = Manifest{Version: j.Version, Params: j.Params, RootHash: root, Signature: j.Signature}
+	return nil
+}
+
+func (m *Manifest) signedBytes() ([]byte, error) {
+	unsigned := *m
+	unsigned.Signature = nil
+	return json.Marshal(&unsigned)
+}
+
+func (m *Manifest) Sign(key ed25519.PrivateKey) error {
+	msg, err := m.signedBytes()
+	if err != nil {
+		return err
+	}
+	m.Signature = ed25519.Sign(key, msg)
+	return nil
+}
+
+// Verify checks the manifest signature against key. Unsigned manifests fail.
+func (m *Manifest) Verify(key ed25519.PublicKey) error {
+	if len(m.Signature) == 0 {
+		return errors.New("verity: manifest is not signed")
+	}
+	msg, err := m.signedBytes()
+	if err != nil {
+		return err
+	}
+	if !ed25519.Verify(key, msg, m.Signature) {
+		return errors.New("verity: manifest signature verification failed")
+	}
+	return nil
+}
+
+func (m *Manifest) WriteFile(path string) error {
+	b, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(b, '\n'), 0o644)
+}
+
+func ReadManifestFile(path string) (*Manifest, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	m := &Manifest{}
+	if err := json.Unmarshal(b, m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
@@ -0,0 +1,144 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package verity
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestVerityParamsJSON(t *testing.T) {
+	want := VerityParams{
+		HashName:       "sha512",
+		DataBlockSize:  4096,
+		HashBlockSize:  1024,
+		DataBlocks:     100,
+		HashType:       0,
+		Salt:           []byte{0xde, 0xad, 0xbe, 0xef},
+		SaltSize:       4,
+		HashAreaOffset: 8192,
+		NoSuperblock:   true,
+		UUID:           [16]byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16},
+	}
+	b, err := json.Marshal(want)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	if !strings.Contains(string(b), `"salt":"deadbeef"`) {
+		t.Errorf("unexpected encoding: %s", b)
+	}
+
+	var got VerityParams
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+
+	invalid := []string{
+		`{"hash_algorithm":"no-such-hash","data_block_size":4096,"hash_block_size":4096,"data_blocks":1,"salt":""}`,
+		`{"hash_algorithm":"sha256","data_block_size":1000,"hash_block_size":4096,"data_blocks":1,"salt":""}`,
+		`{"hash_algorithm":"sha256","data_block_size":4096,"hash_block_size":4096,"data_blocks":0,"salt":""}`,
+		`{"hash_algorithm":"sha256","data_block_size":4096,"hash_block_size":4096,"data_blocks":1,"salt":"zz"}`,
+		`{"hash_algorithm":"sha256","data_block_size":4096,"hash_block_size":4096,"data_blocks":1,"salt":"","extra":1}`,
+	}
+	for _, s := range invalid {
+		if err := json.Unmarshal([]byte(s), &got); err == nil {
+			t.Errorf("Unmarshal(%s): expected error", s)
+		}
+	}
+}
+
+func TestManifestSignVerify(t *testing.T) {
+	dataPath, _ := createTestDataFile(t, 4096, 8)
+	defer os.Remove(dataPath)
+	hashPath := createTestHashFile(t, 0)
+	defer os.Remove(hashPath)
+
+	params := DefaultVerityParams()
+	params.DataBlockSize = 4096
+	params.HashBlockSize = 4096
+	params.DataBlocks = 8
+	params.NoSuperblock = true
+	rootHash, err := VerityCreate(&params, dataPath, hashPath)
+	if err != nil {
+		t.Fatalf("VerityCreate failed: %v", err)
+	}
+
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := NewManifest(&params, rootHash)
+	if err := m.Verify(pub); err == nil {
+		t.Error("expected error verifying an unsigned manifest")
+	}
+	if err := m.Sign(priv); err != nil {
+		t.Fatalf("Sign failed: %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "verity.json")
+	if err := m.WriteFile(path); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	got, err := ReadManifestFile(path)
+	if err != nil {
+		t.Fatalf("ReadManifestFile failed: %v", err)
+	}
+	if err := got.Verify(pub); err != nil {
+		t.Errorf("Verify failed: %v", err)
+	}
+	if !bytes.Equal(got.RootHash, rootHash) {
+		t.Errorf("root hash = %x, want %x", got.RootHash, rootHash)
+	}
+	if err := VerityVerify(&got.Params, dataPath, hashPath, got.RootHash); err != nil {
+		t.Errorf("VerityVerify with manifest params failed: %v", err)
+	}
+
+	got.Params.DataBlocks = 7
+	if err := got.Verify(pub); err == nil {
+		t.Error("expected error verifying a modified manifest")
+	}
+	otherPub, _, _ := ed25519.GenerateKey(nil)
+	if err := m.Verify(otherPub); err == nil {
+		t.Error("expected error verifying with the wrong key")
+	}
+}
+
+func TestReadManifestFileErrors(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"version":   `{"version":2,"params":{"hash_algorithm":"sha256","data_block_size":4096,"hash_block_size":4096,"data_blocks":1,"salt":""},"root_hash":""}`,
+		"root size": `{"version":1,"params":{"hash_algorithm":"sha256","data_block_size":4096,"hash_block_size":4096,"data_blocks":1,"salt":""},"root_hash":"00ff"}`,
+		"not json":  `version: 1`,
+	} {
+		path := filepath.Join(dir, strings.ReplaceAll(name, " ", "-")+".json")
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := ReadManifestFile(path); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
@@ -17,14 +17,15 @@
 package verity
 
 import (
-	"crypto"
-	_ "crypto/sha1"
-	_ "crypto/sha256"
-	_ "crypto/sha512"
+	"bytes"
+	"errors"
 	"fmt"
+	"hash"
 	"io"
 	"math"
 	"os"
+
+	"golang.org/x/sys/unix"
 )
 
 type VerityHash struct {
@@ -38,7 +39,12 @@ type VerityHash struct {
 	dataDevice     string
 	hashDevice     string
 	rootHash       []byte
-	hashFunc       crypto.Hash
+	hashFunc       hashFunction
+	// Use O_DIRECT for the data and hash devices when creating or verifying
+	directIO bool
+	// Pacing and saved progress of verification, both optional
+	limiter    *ioLimiter
+	checkpoint *checkpointer
 }
 
 type hashTreeLevel struct {
@@ -55,16 +61,10 @@ func NewVerityHash(
 	hashAreaOffset uint64,
 	dataDevice, hashDevice string,
 	rootHash []byte,
-) *VerityHash {
-	hashMap := map[string]crypto.Hash{
-		"sha256": crypto.SHA256,
-		"sha512": crypto.SHA512,
-		"sha1":   crypto.SHA1,
-	}
-
-	hashFunc := crypto.SHA256
-	if h, ok := hashMap[hashName]; ok && h.Available() {
-		hashFunc = h
+) (*VerityHash, error) {
+	hashFunc, err := lookupHash(hashName)
+	if err != nil {
+		return nil, err
 	}
 
 	vh := &VerityHash{
@@ -83,7 +83,7 @@ func NewVerityHash(
 	if rootHash != nil {
 		copy(vh.rootHash, rootHash)
 	}
-	return vh
+	return vh, nil
 }
 
 func (vh *VerityHash) RootHash() []byte {
@@ -172,7 +172,7 @@ func (vh *VerityHash) verifyHashBlock(data, salt []byte) ([]byte, error) {
 		}
 	}
 
-	return h.Sum(nil), nil
+	return h.Sum(nil), hashErr(h)
 }
 
 func verifyZero(block []byte, offset uint64) error {
@@ -200,11 +200,41 @@ func (vh *VerityHash) getDigestSizeFull(hashSize uint32) uint32 {
 	return n + 1
 }
 
+// ioChunkSize is the size of the reads and writes of createOrVerify.
+const ioChunkSize = 1 << 20
+
+// digestInto hashes one block with h, which is reset first, and appends the
+// digest to out.
+func (vh *VerityHash) digestInto(h hash.Hash, block, out []byte) ([]byte, error) {
+	h.Reset()
+	if vh.hashType == 1 {
+		h.Write(vh.salt)
+		h.Write(block)
+	} else {
+		h.Write(block)
+		h.Write(vh.salt)
+	}
+	out = h.Sum(out)
+	if err := hashErr(h); err != nil {
+		return out, fmt.Errorf("hash calculation failed: %w", err)
+	}
+	return out, nil
+}
+
+// createOrVerify hashes blocks blocks of rd starting at byte offset
+// dataOffset into the level stored at hashOffset of wr, or compares them with
+// it when verify is set. Reads and writes go through ioChunkSize buffers and
+// a single hasher. Blocks equal to zeroBlock reuse its digest, and when
+// zeroBlock is all zeros the holes of a sparse rd are not read at all. The
+// last digest is left in calculatedDigest; with a nil wr only that digest is
+// computed. When verifying into wr, progress is resumed from and saved to
+// vh.checkpoint.
 func (vh *VerityHash) createOrVerify(
-	rd, wr *os.File,
-	dataBlock uint64, dataBlockSize uint32,
-	hashBlock uint64, hashBlockSize uint32,
+	rd io.ReaderAt, wr *os.File,
+	dataOffset uint64, dataBlockSize uint32,
+	hashOffset uint64, hashBlockSize uint32,
 	blocks uint64,
+	zeroBlock []byte,
 	verify bool,
 	calculatedDigest []byte,
 ) error {
@@ -213,113 +243,320 @@ func (vh *VerityHash) createOrVerify(
 		return fmt.Errorf("digest size exceeds maximum")
 	}
 
-	hashPerBlock := uint32(1 << getBitsDown(hashBlockSize/digestSize))
-	digestSizeFull := vh.getDigestSizeFull(digestSize)
-	blocksToWrite := (blocks + uint64(hashPerBlock) - 1) / uint64(hashPerBlock)
+	lv := vh.newLevelBuffer(wr, verify, dataOffset, dataBlockSize, hashOffset, hashBlockSize, blocks)
 
-	seekRd := dataBlock * uint64(dataBlockSize)
-	if seekRd > math.MaxInt64 {
-		return fmt.Errorf("data seek offset overflow: %d > MaxInt64", seekRd)
+	h := vh.hashFunc.New()
+	chunkBlocks := max(1, ioChunkSize/uint64(dataBlockSize))
+	dataBuf := alignedBuffer(int(chunkBlocks * uint64(dataBlockSize)))
+	digest := make([]byte, 0, digestSize)
+	zeroDigest, err := vh.digestInto(h, zeroBlock, nil)
+	if err != nil {
+		return err
 	}
-	if _, err := rd.Seek(int64(seekRd), io.SeekStart); err != nil {
-		return fmt.Errorf("cannot seek data device: %w", err)
+
+	// Holes read as zeros, so they can only be skipped when zeroBlock is.
+	var holes *holeFinder
+	if isZero(zeroBlock) {
+		holes = newHoleFinder(rd)
 	}
 
-	if wr != nil {
-		seekWr := hashBlock * uint64(hashBlockSize)
-		if seekWr > math.MaxInt64 {
-			return fmt.Errorf("hash seek offset overflow: %d > MaxInt64", seekWr)
-		}
-		if _, err := wr.Seek(int64(seekWr), io.SeekStart); err != nil {
-			return fmt.Errorf("cannot seek hash device: %w", err)
+	var done uint64
+	cp := vh.checkpoint
+	if !verify || wr == nil {
+		cp = nil
+	}
+	if cp != nil && cp.state.Block > 0 {
+		done = cp.state.Block
+		lv.flushed = done / lv.hashPerBlock
+		lv.entries = done % lv.hashPerBlock
+		if done > blocks || uint64(len(cp.state.Partial)) != lv.entries*lv.entrySize {
+			return fmt.Errorf("checkpoint does not match level %d of the hash tree", cp.state.Level)
 		}
+		copy(lv.out, cp.state.Partial)
 	}
 
-	leftBlock := make([]byte, hashBlockSize)
-	dataBuffer := make([]byte, dataBlockSize)
-
-	for blocksToWrite > 0 {
-		blocksToWrite--
-		leftBytes := hashBlockSize
+	for done < blocks {
+		seekRd := dataOffset + done*uint64(dataBlockSize)
+		if seekRd > math.MaxInt64 {
+			return fmt.Errorf("data seek offset overflow: %d > MaxInt64", seekRd)
+		}
 
-		for i := uint32(0); i < hashPerBlock; i++ {
-			if blocks == 0 {
-				break
+		if holes != nil {
+			holeBlocks := min((holes.holeEnd(int64(seekRd))-seekRd)/uint64(dataBlockSize), blocks-done)
+			if holeBlocks > 0 {
+				digest = append(digest[:0], zeroDigest...)
+				for range holeBlocks {
+					if err := lv.add(digest); err != nil {
+						return err
+					}
+				}
+				done += holeBlocks
+				continue
 			}
-			blocks--
+		}
 
-			if _, err := io.ReadFull(rd, dataBuffer); err != nil {
-				return fmt.Errorf("cannot read data block: %w", err)
-			}
+		n := min(chunkBlocks, blocks-done)
+		chunk := dataBuf[:n*uint64(dataBlockSize)]
+		vh.limiter.wait(len(chunk))
+		if err := readFullAt(rd, chunk, int64(seekRd)); err != nil {
+			return fmt.Errorf("cannot read data block: %w", err)
+		}
 
-			hash, err := vh.verifyHashBlock(dataBuffer, vh.salt)
-			if err != nil {
-				return fmt.Errorf("hash calculation failed: %w", err)
-			}
-			copy(calculatedDigest, hash)
+		var err error
+		if digest, err = lv.hashBlocks(h, chunk, zeroBlock, zeroDigest, digest); err != nil {
+			return err
+		}
+		done += n
 
-			if wr == nil {
-				break
+		if cp.due() {
+			if err := lv.flushBlocks(lv.entries / lv.hashPerBlock); err != nil {
+				return err
 			}
-
-			if verify {
-				readDigest := make([]byte, digestSize)
-				if _, err := io.ReadFull(wr, readDigest); err != nil {
-					return fmt.Errorf("cannot read digest from hash device: %w", err)
-				}
-				if !bytesEqual(readDigest, calculatedDigest[:digestSize]) {
-					return fmt.Errorf("verification failed at data position %d", seekRd)
-				}
-			} else {
-				if _, err := wr.Write(calculatedDigest[:digestSize]); err != nil {
-					return fmt.Errorf("cannot write digest to hash device: %w", err)
-				}
+			if err := cp.save(done, lv.out[:lv.entries*lv.entrySize]); err != nil {
+				return err
 			}
+		}
+	}
+	copy(calculatedDigest, digest)
 
-			if vh.hashType == 0 {
-				leftBytes -= digestSize
-			} else {
-				padding := digestSizeFull - digestSize
-				if padding > 0 {
-					if verify {
-						padBuf := make([]byte, padding)
-						if _, err := io.ReadFull(wr, padBuf); err != nil {
-							return fmt.Errorf("cannot read padding: %w", err)
-						}
-						if err := verifyZero(padBuf, seekRd); err != nil {
-							return err
-						}
-					} else {
-						if _, err := wr.Write(leftBlock[:padding]); err != nil {
-							return fmt.Errorf("cannot write padding: %w", err)
-						}
-					}
-				}
-				leftBytes -= digestSizeFull
+	if wr == nil {
+		return nil
+	}
+	return lv.flush()
+}
+
+// levelBuffer assembles the hash blocks of one level in memory and writes
+// them, or compares them with the stored ones, ioChunkSize at a time.
+type levelBuffer struct {
+	vh            *VerityHash
+	wr            *os.File
+	verify        bool
+	dataOffset    uint64
+	dataBlockSize uint64
+	hashOffset    uint64
+	hashBlockSize uint64
+	blocks        uint64
+	digestSize    uint64
+	hashPerBlock  uint64
+	entrySize     uint64
+
+	out     []byte
+	stored  []byte
+	entries uint64 // digests in out
+	flushed uint64 // hash blocks already written or compared
+}
+
+// newLevelBuffer returns the buffer for one level stored at hashOffset of
+// wr. With a nil wr nothing is buffered and add does nothing.
+func (vh *VerityHash) newLevelBuffer(
+	wr *os.File, verify bool,
+	dataOffset uint64, dataBlockSize uint32,
+	hashOffset uint64, hashBlockSize uint32,
+	blocks uint64,
+) *levelBuffer {
+	digestSize := uint32(vh.hashFunc.Size())
+	lv := &levelBuffer{
+		vh:            vh,
+		wr:            wr,
+		verify:        verify,
+		dataOffset:    dataOffset,
+		dataBlockSize: uint64(dataBlockSize),
+		hashOffset:    hashOffset,
+		hashBlockSize: uint64(hashBlockSize),
+		blocks:        blocks,
+		digestSize:    uint64(digestSize),
+		hashPerBlock:  uint64(1) << getBitsDown(hashBlockSize/digestSize),
+		entrySize:     uint64(vh.getDigestSizeFull(digestSize)),
+	}
+	if wr != nil {
+		chunkBlocks := max(1, ioChunkSize/uint64(hashBlockSize))
+		lv.out = alignedBuffer(int(chunkBlocks * uint64(hashBlockSize)))
+		if verify {
+			lv.stored = alignedBuffer(len(lv.out))
+		}
+	}
+	return lv
+}
+
+// hashBlocks hashes every data block of chunk with h and adds the digests.
+// Blocks equal to zeroBlock reuse zeroDigest. The last digest is returned in
+// digest.
+func (lv *levelBuffer) hashBlocks(h hash.Hash, chunk, zeroBlock, zeroDigest, digest []byte) ([]byte, error) {
+	for off := uint64(0); off < uint64(len(chunk)); off += lv.dataBlockSize {
+		block := chunk[off : off+lv.dataBlockSize]
+		if bytes.Equal(block, zeroBlock) {
+			digest = append(digest[:0], zeroDigest...)
+		} else {
+			var err error
+			if digest, err = lv.vh.digestInto(h, block, digest[:0]); err != nil {
+				return digest, err
 			}
 		}
+		if err := lv.add(digest); err != nil {
+			return digest, err
+		}
+	}
+	return digest, nil
+}
 
-		if wr != nil && leftBytes > 0 {
-			if verify {
-				spareBuf := make([]byte, leftBytes)
-				if _, err := io.ReadFull(wr, spareBuf); err != nil {
-					return fmt.Errorf("cannot read spare area: %w", err)
-				}
-				if err := verifyZero(spareBuf, seekRd); err != nil {
-					return err
-				}
-			} else {
-				if _, err := wr.Write(leftBlock[:leftBytes]); err != nil {
-					return fmt.Errorf("cannot write spare area: %w", err)
-				}
+func (lv *levelBuffer) add(digest []byte) error {
+	if lv.wr == nil {
+		return nil
+	}
+	blockIdx := lv.entries / lv.hashPerBlock
+	pos := blockIdx*lv.hashBlockSize + (lv.entries%lv.hashPerBlock)*lv.entrySize
+	copy(lv.out[pos:], digest)
+	lv.entries++
+
+	if lv.entries%lv.hashPerBlock == 0 && (blockIdx+1)*lv.hashBlockSize == uint64(len(lv.out)) {
+		return lv.flush()
+	}
+	return nil
+}
+
+func (lv *levelBuffer) flush() error {
+	return lv.flushBlocks((lv.entries + lv.hashPerBlock - 1) / lv.hashPerBlock)
+}
+
+// flushBlocks writes or compares the first numBlocks hash blocks in out and
+// moves the digests after them to the start of out.
+func (lv *levelBuffer) flushBlocks(numBlocks uint64) error {
+	if numBlocks == 0 {
+		return nil
+	}
+	region := lv.out[:numBlocks*lv.hashBlockSize]
+	seekWr := lv.hashOffset + lv.flushed*lv.hashBlockSize
+	if seekWr > math.MaxInt64 {
+		return fmt.Errorf("hash seek offset overflow: %d > MaxInt64", seekWr)
+	}
+
+	if lv.verify {
+		stored := lv.stored[:len(region)]
+		lv.vh.limiter.wait(len(stored))
+		if err := readFullAt(lv.wr, stored, int64(seekWr)); err != nil {
+			return fmt.Errorf("cannot read digest from hash device: %w", err)
+		}
+		if !bytes.Equal(stored, region) {
+			if err := lv.mismatch(stored, region, seekWr); err != nil {
+				return err
 			}
 		}
+	} else if _, err := lv.wr.WriteAt(region, int64(seekWr)); err != nil {
+		return fmt.Errorf("cannot write digest to hash device: %w", err)
 	}
 
+	lv.flushed += numBlocks
+	lv.entries -= min(lv.entries, numBlocks*lv.hashPerBlock)
+	tail := lv.out[len(region) : uint64(len(region))+lv.entries*lv.entrySize]
+	copy(lv.out, tail)
+	clear(lv.out[len(tail) : len(region)+len(tail)])
 	return nil
 }
 
+// mismatch reports the first difference between the stored hash blocks and
+// the computed ones starting at hash device offset seekWr.
+func (lv *levelBuffer) mismatch(stored, computed []byte, seekWr uint64) error {
+	for b := uint64(0); b*lv.hashBlockSize < uint64(len(computed)); b++ {
+		block := lv.flushed + b
+		first := block * lv.hashPerBlock
+		used := min(lv.hashPerBlock, lv.blocks-first)
+		base := b * lv.hashBlockSize
+
+		for e := uint64(0); e < used; e++ {
+			at := base + e*lv.entrySize
+			if !bytes.Equal(stored[at:at+lv.digestSize], computed[at:at+lv.digestSize]) {
+				return fmt.Errorf("verification failed at data position %d", lv.dataOffset+(first+e)*lv.dataBlockSize)
+			}
+			if err := verifyZero(stored[at+lv.digestSize:at+lv.entrySize], seekWr+at+lv.digestSize); err != nil {
+				return err
+			}
+		}
+		spare := base + used*lv.entrySize
+		if err := verifyZero(stored[spare:base+lv.hashBlockSize], seekWr+spare); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// zeroSubtreeBlock returns the hash block whose entries are all the digest
+// of below. Over all-zero data, every full hash block of a level is the
+// zeroSubtreeBlock of the one under it.
+func (vh *VerityHash) zeroSubtreeBlock(below []byte) ([]byte, error) {
+	digest, err := vh.digestInto(vh.hashFunc.New(), below, nil)
+	if err != nil {
+		return nil, err
+	}
+	digestSize := uint32(len(digest))
+	entrySize := vh.getDigestSizeFull(digestSize)
+	hashPerBlock := uint32(1) << getBitsDown(vh.hashBlockSize/digestSize)
+
+	block := make([]byte, vh.hashBlockSize)
+	for i := uint32(0); i < hashPerBlock; i++ {
+		copy(block[i*entrySize:], digest)
+	}
+	return block, nil
+}
+
+// holeFinder locates the holes of a sparse regular file.
+type holeFinder struct {
+	f    *os.File
+	size uint64
+}
+
+// newHoleFinder returns nil unless rd is a regular file.
+func newHoleFinder(rd io.ReaderAt) *holeFinder {
+	f, ok := rd.(*os.File)
+	if !ok {
+		return nil
+	}
+	st, err := f.Stat()
+	if err != nil || !st.Mode().IsRegular() {
+		return nil
+	}
+	return &holeFinder{f: f, size: uint64(st.Size())}
+}
+
+// holeEnd returns the end of the hole at off, or off if there is data at off
+// or the filesystem cannot tell. Offsets past the end of the file are never
+// holes, so short files still fail to read.
+func (hf *holeFinder) holeEnd(off int64) uint64 {
+	if uint64(off) >= hf.size {
+		return uint64(off)
+	}
+	next, err := hf.f.Seek(off, unix.SEEK_DATA)
+	if errors.Is(err, unix.ENXIO) {
+		return hf.size
+	}
+	if err != nil {
+		return uint64(off)
+	}
+	return uint64(next)
+}
+
+// readFullAt fills buf from r at off; unlike ReadAt it treats a full read
+// that ends at EOF as success.
+func readFullAt(r io.ReaderAt, buf []byte, off int64) error {
+	n, err := r.ReadAt(buf, off)
+	if n == len(buf) {
+		return nil
+	}
+	if err == nil || errors.Is(err, io.EOF) {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
 func (vh *VerityHash) CreateOrVerifyHashTree(verify bool) error {
+	err := vh.createOrVerifyHashTree(verify, vh.directIO)
+	if vh.directIO && errors.Is(err, unix.EINVAL) {
+		// The device accepted O_DIRECT but not our offsets or sizes.
+		err = vh.createOrVerifyHashTree(verify, false)
+	}
+	return err
+}
+
+func (vh *VerityHash) createOrVerifyHashTree(verify, direct bool) error {
 	digestSize := uint32(vh.hashFunc.Size())
 	if digestSize > VerityMaxDigestSize {
 		return fmt.Errorf("digest size exceeds maximum")
@@ -332,16 +569,17 @@ func (vh *VerityHash) CreateOrVerifyHashTree(verify bool) error {
 		return fmt.Errorf("failed to calculate hash levels: %w", err)
 	}
 
-	dataFile, err := os.Open(vh.dataDevice)
+	dataFile, err := openForIO(vh.dataDevice, os.O_RDONLY, direct)
 	if err != nil {
 		return fmt.Errorf("cannot open data device %s: %w", vh.dataDevice, err)
 	}
 	defer dataFile.Close()
 
-	hashFile, err := os.OpenFile(vh.hashDevice, os.O_RDWR, 0)
+	hashFlag := os.O_RDWR
 	if verify {
-		hashFile, err = os.Open(vh.hashDevice)
+		hashFlag = os.O_RDONLY
 	}
+	hashFile, err := openForIO(vh.hashDevice, hashFlag, direct)
 	if err != nil {
 		return fmt.Errorf("cannot open hash device %s: %w", vh.hashDevice, err)
 	}
@@ -349,55 +587,20 @@ func (vh *VerityHash) CreateOrVerifyHashTree(verify bool) error {
 
 	calculatedDigest := make([]byte, digestSize)
 
-	for i := 0; i < len(levels); i++ {
-		var rd, wr *os.File
-		var dataBlock, hashBlock uint64
-		var dataBlockSize, hashBlockSize uint32
-		var blocks uint64
-
-		if i == 0 {
-			rd = dataFile
-			wr = hashFile
-			dataBlock = 0
-			dataBlockSize = vh.dataBlockSize
-			hashBlock = levels[i].offset / uint64(vh.hashBlockSize)
-			hashBlockSize = vh.hashBlockSize
-			blocks = dataFileBlocks
-		} else {
-			hashFile2, err := os.Open(vh.hashDevice)
-			if err != nil {
-				return fmt.Errorf("cannot open hash device for reading: %w", err)
-			}
-			rd = hashFile2
-			wr = hashFile
-			dataBlock = levels[i-1].offset / uint64(vh.hashBlockSize)
-			dataBlockSize = vh.hashBlockSize
-			hashBlock = levels[i].offset / uint64(vh.hashBlockSize)
-			hashBlockSize = vh.hashBlockSize
-			blocks = levels[i-1].numBlocks
-
-			err = vh.createOrVerify(rd, wr, dataBlock, dataBlockSize, hashBlock, hashBlockSize, blocks, verify, calculatedDigest)
-			hashFile2.Close()
+	if len(levels) > 0 {
+		if vh.checkpoint.enter(0) {
+			err = vh.createOrVerify(
+				dataFile, hashFile,
+				0, vh.dataBlockSize,
+				levels[0].offset, vh.hashBlockSize,
+				dataFileBlocks, make([]byte, vh.dataBlockSize),
+				verify, calculatedDigest,
+			)
 			if err != nil {
 				return err
 			}
-			continue
-		}
-
-		if err := vh.createOrVerify(rd, wr, dataBlock, dataBlockSize, hashBlock, hashBlockSize, blocks, verify, calculatedDigest); err != nil {
-			return err
 		}
-	}
-
-	if len(levels) > 0 {
-		lastLevel := levels[len(levels)-1]
-		err = vh.createOrVerify(
-			hashFile, nil,
-			lastLevel.offset/uint64(vh.hashBlockSize), vh.hashBlockSize,
-			0, vh.hashBlockSize,
-			lastLevel.numBlocks, verify, calculatedDigest,
-		)
-		if err != nil {
+		if err := vh.upperLevels(hashFile, levels, verify, calculatedDigest); err != nil {
 			return err
 		}
 	} else {
@@ -405,7 +608,8 @@ func (vh *VerityHash) CreateOrVerifyHashTree(verify bool) error {
 			dataFile, nil,
 			0, vh.dataBlockSize,
 			0, vh.hashBlockSize,
-			dataFileBlocks, verify, calculatedDigest,
+			dataFileBlocks, make([]byte, vh.dataBlockSize),
+			verify, calculatedDigest,
 		)
 		if err != nil {
 			return err
@@ -423,6 +627,118 @@ func (vh *VerityHash) CreateOrVerifyHashTree(verify bool) error {
 	return nil
 }
 
+// upperLevels creates or verifies every level above level 0, which must
+// already be on hashFile, and leaves the root hash in calculatedDigest.
+func (vh *VerityHash) upperLevels(hashFile *os.File, levels []hashTreeLevel, verify bool, calculatedDigest []byte) error {
+	zeroBlock, err := vh.zeroSubtreeBlock(make([]byte, vh.dataBlockSize))
+	if err != nil {
+		return err
+	}
+	for i := 1; i < len(levels); i++ {
+		if vh.checkpoint.enter(i) {
+			err := vh.createOrVerify(
+				hashFile, hashFile,
+				levels[i-1].offset, vh.hashBlockSize,
+				levels[i].offset, vh.hashBlockSize,
+				levels[i-1].numBlocks, zeroBlock,
+				verify, calculatedDigest,
+			)
+			if err != nil {
+				return err
+			}
+		}
+		if zeroBlock, err = vh.zeroSubtreeBlock(zeroBlock); err != nil {
+			return err
+		}
+	}
+
+	lastLevel := levels[len(levels)-1]
+	vh.checkpoint.enter(len(levels))
+	return vh.createOrVerify(
+		hashFile, nil,
+		lastLevel.offset, vh.hashBlockSize,
+		0, vh.hashBlockSize,
+		lastLevel.numBlocks, zeroBlock,
+		verify, calculatedDigest,
+	)
+}
+
+// CheckHashTree verifies the hash tree against the root hash using the hash
+// device alone. Level 0 digests cover data blocks, so only their padding and
+// spare area are checked; every block above is checked against its parent.
+// A tree of a single data block has no hash blocks and always passes.
+func (vh *VerityHash) CheckHashTree() error {
+	digestSize := uint32(vh.hashFunc.Size())
+	if digestSize > VerityMaxDigestSize {
+		return fmt.Errorf("digest size exceeds maximum")
+	}
+
+	levels, err := vh.hashLevels(vh.dataBlocks)
+	if err != nil {
+		return fmt.Errorf("failed to calculate hash levels: %w", err)
+	}
+	if len(levels) == 0 {
+		return nil
+	}
+
+	hashFile, err := os.Open(vh.hashDevice)
+	if err != nil {
+		return fmt.Errorf("cannot open hash device %s: %w", vh.hashDevice, err)
+	}
+	defer hashFile.Close()
+
+	if err := vh.checkDataDigestLevel(hashFile, levels[0]); err != nil {
+		return err
+	}
+
+	calculatedDigest := make([]byte, digestSize)
+	if err := vh.upperLevels(hashFile, levels, true, calculatedDigest); err != nil {
+		return err
+	}
+
+	if !bytesEqual(vh.rootHash, calculatedDigest[:digestSize]) {
+		return fmt.Errorf("root hash verification failed")
+	}
+	return nil
+}
+
+// checkDataDigestLevel checks that the padding after every level 0 digest
+// and the unused tail of every level 0 hash block are zero.
+func (vh *VerityHash) checkDataDigestLevel(hashFile *os.File, level hashTreeLevel) error {
+	digestSize := uint64(vh.hashFunc.Size())
+	hashPerBlock := uint64(1) << getBitsDown(vh.hashBlockSize/uint32(digestSize))
+	entrySize := uint64(vh.getDigestSizeFull(uint32(digestSize)))
+
+	block := make([]byte, vh.hashBlockSize)
+	remaining := vh.dataBlocks
+
+	for b := uint64(0); b < level.numBlocks; b++ {
+		offset := level.offset + b*uint64(vh.hashBlockSize)
+		if offset > math.MaxInt64 {
+			return fmt.Errorf("hash seek offset overflow: %d > MaxInt64", offset)
+		}
+		if _, err := hashFile.ReadAt(block, int64(offset)); err != nil {
+			return fmt.Errorf("cannot read hash block at %d: %w", offset, err)
+		}
+
+		n := min(remaining, hashPerBlock)
+		remaining -= n
+
+		if entrySize > digestSize {
+			for i := uint64(0); i < n; i++ {
+				pad := i*entrySize + digestSize
+				if err := verifyZero(block[pad:(i+1)*entrySize], offset+pad); err != nil {
+					return err
+				}
+			}
+		}
+		if err := verifyZero(block[n*entrySize:], offset+n*entrySize); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func bytesEqual(a, b []byte) bool {
 	if len(a) != len(b) {
 		return false
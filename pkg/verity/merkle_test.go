@@ -24,6 +24,8 @@ import (
 	"os/exec"
 	"regexp"
 	"testing"
+
+	"github.com/containerd/go-dmverity/pkg/afalg"
 )
 
 type merkleTestConfig struct {
@@ -42,7 +44,7 @@ var commonMerkleTests = []merkleTestConfig{
 	{"sha512", 4096, 4096, 16, 1, "sha512", false},
 }
 
-func createTestDataFile(t *testing.T, blockSize uint32, numBlocks uint64) (string, []byte) {
+func createTestDataFile(t testing.TB, blockSize uint32, numBlocks uint64) (string, []byte) {
 	t.Helper()
 
 	dataFile, err := os.CreateTemp("", "verity-test-data-*")
@@ -74,7 +76,7 @@ func createTestDataFile(t *testing.T, blockSize uint32, numBlocks uint64) (strin
 	return dataFile.Name(), data
 }
 
-func createTestHashFile(t *testing.T, size int64) string {
+func createTestHashFile(t testing.TB, size int64) string {
 	t.Helper()
 
 	hashFile, err := os.CreateTemp("", "verity-test-hash-*")
@@ -117,8 +119,9 @@ func createParamsFromConfig(tc merkleTestConfig, salt []byte) *VerityParams {
 	}
 }
 
-func createVerityHash(params *VerityParams, dataPath, hashPath string, rootHash []byte) *VerityHash {
-	return NewVerityHash(
+func createVerityHash(t testing.TB, params *VerityParams, dataPath, hashPath string, rootHash []byte) *VerityHash {
+	t.Helper()
+	vh, err := NewVerityHash(
 		params.HashName,
 		params.DataBlockSize, params.HashBlockSize,
 		params.DataBlocks,
@@ -128,6 +131,10 @@ func createVerityHash(params *VerityParams, dataPath, hashPath string, rootHash
 		dataPath, hashPath,
 		rootHash,
 	)
+	if err != nil {
+		t.Fatalf("NewVerityHash failed: %v", err)
+	}
+	return vh
 }
 
 func prepareSaltAndArgs(useSalt bool, saltPrefix string) ([]byte, []string) {
@@ -182,7 +189,7 @@ func TestHashFileContentComparison(t *testing.T) {
 			salt, saltArgs := prepareSaltAndArgs(tt.useSalt, "comparison-test-salt")
 			params := createParamsFromConfig(tt, salt)
 
-			vhGo := createVerityHash(params, dataPath, hashPathGo, nil)
+			vhGo := createVerityHash(t, params, dataPath, hashPathGo, nil)
 			if err := vhGo.CreateOrVerifyHashTree(false); err != nil {
 				t.Fatalf("Go CreateOrVerifyHashTree failed: %v", err)
 			}
@@ -210,13 +217,13 @@ func TestHashFileContentComparison(t *testing.T) {
 					t.Fatalf("failed to write stripped hash file: %v", err)
 				}
 
-				vhVerifyStripped := createVerityHash(params, dataPath, hashPathCStripped, rootHashCBytes)
+				vhVerifyStripped := createVerityHash(t, params, dataPath, hashPathCStripped, rootHashCBytes)
 				if err := vhVerifyStripped.CreateOrVerifyHashTree(true); err != nil {
 					t.Errorf("Go verifying stripped cryptsetup hash FAILED (%v)", err)
 				}
 			}
 
-			vhVerifyGo := createVerityHash(params, dataPath, hashPathGo, rootHashGo)
+			vhVerifyGo := createVerityHash(t, params, dataPath, hashPathGo, rootHashGo)
 			if err := vhVerifyGo.CreateOrVerifyHashTree(true); err != nil {
 				t.Errorf("Go verifying own hash FAILED (%v)", err)
 			}
@@ -243,7 +250,7 @@ func TestCrossCheckWithCryptsetup(t *testing.T) {
 			salt, saltArgs := prepareSaltAndArgs(tt.useSalt, "cross-check-salt")
 			params := createParamsFromConfig(tt, salt)
 
-			vhGo := createVerityHash(params, dataPath, hashPathGo, nil)
+			vhGo := createVerityHash(t, params, dataPath, hashPathGo, nil)
 			if err := vhGo.CreateOrVerifyHashTree(false); err != nil {
 				t.Fatalf("Go CreateOrVerifyHashTree failed: %v", err)
 			}
@@ -256,7 +263,7 @@ func TestCrossCheckWithCryptsetup(t *testing.T) {
 					rootHashGo, rootHashCBytes)
 			}
 
-			vhSelfVerify := createVerityHash(params, dataPath, hashPathGo, rootHashGo)
+			vhSelfVerify := createVerityHash(t, params, dataPath, hashPathGo, rootHashGo)
 			if err := vhSelfVerify.CreateOrVerifyHashTree(true); err != nil {
 				t.Errorf("Go failed to verify its own hash tree: %v", err)
 			}
@@ -301,7 +308,7 @@ func TestManualHashTreeVerification(t *testing.T) {
 		HashAreaOffset: 0,
 	}
 
-	vh := createVerityHash(params, dataPath.Name(), hashPath, nil)
+	vh := createVerityHash(t, params, dataPath.Name(), hashPath, nil)
 	if err := vh.CreateOrVerifyHashTree(false); err != nil {
 		t.Fatalf("CreateOrVerifyHashTree failed: %v", err)
 	}
@@ -324,7 +331,7 @@ func TestManualHashTreeVerification(t *testing.T) {
 		}
 	}
 
-	vhVerify := createVerityHash(params, dataPath.Name(), hashPath, rootHash)
+	vhVerify := createVerityHash(t, params, dataPath.Name(), hashPath, rootHash)
 	if err := vhVerify.CreateOrVerifyHashTree(true); err != nil {
 		t.Errorf("verification failed: %v", err)
 	}
@@ -350,7 +357,7 @@ func TestHashTreeStructure(t *testing.T) {
 		HashAreaOffset: 0,
 	}
 
-	vh := createVerityHash(params, dataPath, hashPath, nil)
+	vh := createVerityHash(t, params, dataPath, hashPath, nil)
 
 	if _, err := vh.hashLevels(numBlocks); err != nil {
 		t.Fatalf("hashLevels failed: %v", err)
@@ -361,7 +368,7 @@ func TestHashTreeStructure(t *testing.T) {
 	}
 	rootHash := vh.RootHash()
 
-	vhVerify := createVerityHash(params, dataPath, hashPath, rootHash)
+	vhVerify := createVerityHash(t, params, dataPath, hashPath, rootHash)
 	if err := vhVerify.CreateOrVerifyHashTree(true); err != nil {
 		t.Errorf("verification failed: %v", err)
 	}
@@ -396,7 +403,7 @@ func TestVerityHashGetHashTreeSize(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			vh := NewVerityHash(
+			vh, err := NewVerityHash(
 				tt.hashAlgo,
 				tt.dataBlockSize, tt.hashBlockSize,
 				tt.dataBlocks,
@@ -405,6 +412,9 @@ func TestVerityHashGetHashTreeSize(t *testing.T) {
 				"", "",
 				nil,
 			)
+			if err != nil {
+				t.Fatalf("NewVerityHash failed: %v", err)
+			}
 
 			calculatedSize, err := vh.GetHashTreeSize()
 			if err != nil {
@@ -428,3 +438,253 @@ func TestVerityHashGetHashTreeSize(t *testing.T) {
 		})
 	}
 }
+
+func TestKernelHashTree(t *testing.T) {
+	kernelHash, err := afalg.NewHash("sha384")
+	if err != nil {
+		t.Skipf("kernel sha384 not available: %v", err)
+	}
+
+	dataPath, _ := createTestDataFile(t, 4096, 300)
+	defer os.Remove(dataPath)
+	kernelPath := createTestHashFile(t, 0)
+	defer os.Remove(kernelPath)
+	goPath := createTestHashFile(t, 0)
+	defer os.Remove(goPath)
+
+	params := DefaultVerityParams()
+	params.HashName = "sha384"
+	params.DataBlockSize = 4096
+	params.HashBlockSize = 4096
+	params.DataBlocks = 300
+	params.NoSuperblock = true
+	params.Salt = []byte{0x01, 0x02}
+	params.SaltSize = 2
+	rootHash, err := VerityCreate(&params, dataPath, goPath)
+	if err != nil {
+		t.Fatalf("VerityCreate failed: %v", err)
+	}
+
+	// The same tree with the kernel's SHA-384.
+	vh := createVerityHash(t, &params, dataPath, kernelPath, nil)
+	vh.hashFunc = kernelHash
+	if err := vh.CreateOrVerifyHashTree(false); err != nil {
+		t.Fatalf("CreateOrVerifyHashTree with a kernel hash failed: %v", err)
+	}
+	if !bytes.Equal(vh.RootHash(), rootHash) {
+		t.Errorf("root hash %x, want %x", vh.RootHash(), rootHash)
+	}
+	kernelTree, err := os.ReadFile(kernelPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	goTree, err := os.ReadFile(goPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(kernelTree, goTree) {
+		t.Error("hash tree built with the kernel hash differs")
+	}
+}
+
+// createSparseFile returns a file of size bytes that is a hole apart from
+// the given writes.
+func createSparseFile(t testing.TB, size int64, writes map[int64][]byte) string {
+	t.Helper()
+	f, err := os.CreateTemp("", "verity-sparse-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := f.Truncate(size); err != nil {
+		t.Fatal(err)
+	}
+	for off, data := range writes {
+		if _, err := f.WriteAt(data, off); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return f.Name()
+}
+
+func TestSparseHashTree(t *testing.T) {
+	tests := []struct {
+		name      string
+		hashName  string
+		hashType  uint32
+		blockSize uint32
+	}{
+		{"sha256 4K", "sha256", 1, 4096},
+		{"sha256 512B", "sha256", 1, 512},
+		{"sha1 512B chromeos", "sha1", 0, 512},
+	}
+
+	const size = 8 << 20
+	random := make([]byte, 4096)
+	if _, err := rand.Read(random); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			sparsePath := createSparseFile(t, size, map[int64][]byte{
+				0:              random,
+				3<<20 + 100:    random[:1000],
+				size - 1:       {0x01},
+				size/2 + 65536: make([]byte, 8192), // written zeros
+			})
+			defer os.Remove(sparsePath)
+			content, err := os.ReadFile(sparsePath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			densePath := createTestHashFile(t, 0)
+			defer os.Remove(densePath)
+			if err := os.WriteFile(densePath, content, 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			params := DefaultVerityParams()
+			params.HashName = tc.hashName
+			params.HashType = tc.hashType
+			params.DataBlockSize = tc.blockSize
+			params.HashBlockSize = tc.blockSize
+			params.DataBlocks = size / uint64(tc.blockSize)
+			params.Salt = []byte{0x5a, 0xa5}
+			params.SaltSize = 2
+			params.NoSuperblock = true
+
+			create := func(dataPath string) ([]byte, []byte) {
+				hashPath := createTestHashFile(t, 0)
+				defer os.Remove(hashPath)
+				p := params
+				rootHash, err := VerityCreate(&p, dataPath, hashPath)
+				if err != nil {
+					t.Fatalf("VerityCreate failed: %v", err)
+				}
+				tree, err := os.ReadFile(hashPath)
+				if err != nil {
+					t.Fatal(err)
+				}
+				return rootHash, tree
+			}
+			sparseRoot, sparseTree := create(sparsePath)
+			denseRoot, denseTree := create(densePath)
+
+			// Level 0 of VerityCreateMulti reads holes instead of skipping them.
+			multiPath := createTestHashFile(t, 0)
+			defer os.Remove(multiPath)
+			p := params
+			roots, err := VerityCreateMulti([]*VerityParams{&p}, sparsePath, []string{multiPath})
+			if err != nil {
+				t.Fatalf("VerityCreateMulti failed: %v", err)
+			}
+			multiTree, err := os.ReadFile(multiPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !bytes.Equal(sparseRoot, denseRoot) || !bytes.Equal(sparseRoot, roots[0]) {
+				t.Fatalf("root hashes differ: sparse %x dense %x multi %x", sparseRoot, denseRoot, roots[0])
+			}
+			if !bytes.Equal(sparseTree, denseTree) || !bytes.Equal(sparseTree, multiTree) {
+				t.Fatal("hash trees differ")
+			}
+
+			p = params
+			if err := VerityVerify(&p, sparsePath, multiPath, sparseRoot); err != nil {
+				t.Fatalf("VerityVerify failed: %v", err)
+			}
+			corruptByte(t, sparsePath, 5<<20)
+			p = params
+			if err := VerityVerify(&p, sparsePath, multiPath, sparseRoot); err == nil {
+				t.Error("expected VerityVerify to detect data written into a hole")
+			}
+		})
+	}
+}
+
+func TestSparseHashTreeShortFile(t *testing.T) {
+	// Blocks past the end of the file are not holes.
+	dataPath := createSparseFile(t, 16*4096, nil)
+	defer os.Remove(dataPath)
+	hashPath := createTestHashFile(t, 0)
+	defer os.Remove(hashPath)
+
+	params := DefaultVerityParams()
+	params.DataBlockSize = 4096
+	params.HashBlockSize = 4096
+	params.DataBlocks = 32
+	params.NoSuperblock = true
+	if _, err := VerityCreate(&params, dataPath, hashPath); err == nil {
+		t.Error("expected VerityCreate to fail on a short data file")
+	}
+}
+
+// benchmarkHashTree builds, or verifies, the tree of 64 MiB of data.
+func benchmarkHashTree(b *testing.B, hashAlgo string, blockSize uint32, verify bool) {
+	numBlocks := uint64(64<<20) / uint64(blockSize)
+
+	dataPath, _ := createTestDataFile(b, blockSize, numBlocks)
+	defer os.Remove(dataPath)
+	hashPath := createTestHashFile(b, 0)
+	defer os.Remove(hashPath)
+
+	params := &VerityParams{
+		HashName: hashAlgo, DataBlockSize: blockSize, HashBlockSize: blockSize,
+		DataBlocks: numBlocks, HashType: 1, Salt: []byte("bench"), SaltSize: 5,
+	}
+	vh := createVerityHash(b, params, dataPath, hashPath, nil)
+	if err := vh.CreateOrVerifyHashTree(false); err != nil {
+		b.Fatalf("CreateOrVerifyHashTree failed: %v", err)
+	}
+	vh = createVerityHash(b, params, dataPath, hashPath, vh.RootHash())
+
+	b.SetBytes(int64(numBlocks) * int64(blockSize))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := vh.CreateOrVerifyHashTree(verify); err != nil {
+			b.Fatalf("CreateOrVerifyHashTree failed: %v", err)
+		}
+	}
+}
+
+func BenchmarkCreateHashTreeSHA256(b *testing.B)     { benchmarkHashTree(b, "sha256", 4096, false) }
+func BenchmarkVerifyHashTreeSHA256(b *testing.B)     { benchmarkHashTree(b, "sha256", 4096, true) }
+func BenchmarkCreateHashTreeSHA256512B(b *testing.B) { benchmarkHashTree(b, "sha256", 512, false) }
+func BenchmarkVerifyHashTreeSHA256512B(b *testing.B) { benchmarkHashTree(b, "sha256", 512, true) }
+func BenchmarkCreateHashTreeSHA1(b *testing.B)       { benchmarkHashTree(b, "sha1", 4096, false) }
+func BenchmarkVerifyHashTreeSHA1(b *testing.B)       { benchmarkHashTree(b, "sha1", 4096, true) }
+
+// BenchmarkCreateHashTreeSparse builds the tree of a 1 GiB file holding
+// 1 MiB of data every 64 MiB, plus some written zeros.
+func BenchmarkCreateHashTreeSparse(b *testing.B) {
+	const size = 1 << 30
+	data := make([]byte, 1<<20)
+	if _, err := rand.Read(data); err != nil {
+		b.Fatal(err)
+	}
+	writes := map[int64][]byte{}
+	for off := int64(0); off < size; off += 64 << 20 {
+		writes[off] = data
+		writes[off+32<<20] = make([]byte, 1<<20)
+	}
+	dataPath := createSparseFile(b, size, writes)
+	defer os.Remove(dataPath)
+	hashPath := createTestHashFile(b, 0)
+	defer os.Remove(hashPath)
+
+	params := &VerityParams{
+		HashName: "sha256", DataBlockSize: 4096, HashBlockSize: 4096,
+		DataBlocks: size / 4096, HashType: 1, Salt: []byte("bench"), SaltSize: 5,
+	}
+	vh := createVerityHash(b, params, dataPath, hashPath, nil)
+
+	b.SetBytes(size)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := vh.CreateOrVerifyHashTree(false); err != nil {
+			b.Fatalf("CreateOrVerifyHashTree failed: %v", err)
+		}
+	}
+}
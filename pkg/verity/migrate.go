@@ -0,0 +1,128 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package verity
+
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+// VerityMigrate builds the tree of newParams for dataDevice on newHashDevice
+// in the same read of the data that checks it against oldRoot and the tree
+// on oldHashDevice, so data that changes during the migration is never
+// given a new root hash. The new root hash is returned only if the old tree
+// verified; otherwise the new hash device is cleared. newHashDevice must
+// differ from the data and old hash devices.
+func VerityMigrate(oldParams, newParams *VerityParams, dataDevice, oldHashDevice, newHashDevice string, oldRoot []byte) ([]byte, error) {
+	if oldParams == nil || newParams == nil {
+		return nil, errors.New("verity: nil params")
+	}
+	if newHashDevice == dataDevice || newHashDevice == oldHashDevice {
+		return nil, errors.New("verity: the new hash device must differ from the data and old hash devices")
+	}
+
+	if err := readSuperblockParams(oldParams, dataDevice, oldHashDevice); err != nil {
+		return nil, err
+	}
+	oldVH, err := NewVerityHash(
+		oldParams.HashName,
+		oldParams.DataBlockSize, oldParams.HashBlockSize,
+		oldParams.DataBlocks,
+		oldParams.HashType,
+		oldParams.Salt,
+		oldParams.HashAreaOffset,
+		dataDevice, oldHashDevice,
+		oldRoot,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateParams(oldParams, oldVH.hashFunc.Size()); err != nil {
+		return nil, err
+	}
+
+	newVH, err := newMultiHash(newParams, dataDevice, newHashDevice)
+	if err != nil {
+		return nil, fmt.Errorf("new tree: %w", err)
+	}
+	newTreeSize, err := newVH.GetHashTreeSize()
+	if err != nil {
+		return nil, err
+	}
+
+	oldFile, err := os.Open(oldHashDevice)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open hash device %s: %w", oldHashDevice, err)
+	}
+	defer oldFile.Close()
+	oldTree, err := oldVH.newLevelZero(oldFile, true)
+	if err != nil {
+		return nil, err
+	}
+	oldTree.name = "old tree"
+
+	if err := writeSuperblockFor(newParams, dataDevice, newHashDevice); err != nil {
+		return nil, err
+	}
+	newFile, err := os.OpenFile(newHashDevice, os.O_RDWR, 0)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open hash device %s: %w", newHashDevice, err)
+	}
+	defer newFile.Close()
+	newTree, err := newVH.newLevelZero(newFile, false)
+	if err != nil {
+		return nil, err
+	}
+	newTree.name = "new tree"
+
+	roots, err := hashLevelZero(dataDevice, []*levelZero{oldTree, newTree})
+	if err == nil && !bytesEqual(roots[0], oldRoot) {
+		err = errors.New("old tree: root hash verification failed")
+	}
+	if err != nil {
+		if clearErr := clearHashDevice(newFile, newParams.HashAreaOffset+newTreeSize); clearErr != nil {
+			return nil, fmt.Errorf("%w; cannot clear new hash device: %v", err, clearErr)
+		}
+		return nil, err
+	}
+
+	if err := newFile.Sync(); err != nil {
+		return nil, fmt.Errorf("cannot sync hash device: %w", err)
+	}
+	return roots[1], nil
+}
+
+// clearHashDevice discards a tree that must not be used: a regular file is
+// truncated and otherwise the first size bytes are zeroed.
+func clearHashDevice(f *os.File, size uint64) error {
+	st, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if st.Mode().IsRegular() {
+		return f.Truncate(0)
+	}
+
+	zeros := make([]byte, ioChunkSize)
+	for off := uint64(0); off < size; off += ioChunkSize {
+		if _, err := f.WriteAt(zeros[:min(ioChunkSize, size-off)], int64(off)); err != nil {
+			return err
+		}
+	}
+	return f.Sync()
+}
@@ -0,0 +1,98 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package verity
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestVerityMigrate(t *testing.T) {
+	dataPath, _ := createTestDataFile(t, 4096, 300)
+	defer os.Remove(dataPath)
+	oldHash := createTestHashFile(t, 0)
+	defer os.Remove(oldHash)
+	newHash := createTestHashFile(t, 0)
+	defer os.Remove(newHash)
+	refHash := createTestHashFile(t, 0)
+	defer os.Remove(refHash)
+
+	oldParams := DefaultVerityParams()
+	oldParams.HashName = "sha1"
+	oldParams.HashType = 0
+	oldParams.DataBlockSize = 4096
+	oldParams.HashBlockSize = 4096
+	oldParams.DataBlocks = 300
+	oldParams.Salt = []byte{0x01, 0x02}
+	oldParams.SaltSize = 2
+	oldParams.NoSuperblock = true
+	p := oldParams
+	oldRoot, err := VerityCreate(&p, dataPath, oldHash)
+	if err != nil {
+		t.Fatalf("VerityCreate failed: %v", err)
+	}
+
+	newParams := DefaultVerityParams()
+	newParams.DataBlockSize = 1024
+	newParams.HashBlockSize = 4096
+	newParams.DataBlocks = 1200
+	newParams.HashAreaOffset = 4096
+	u := uuid.New()
+	copy(newParams.UUID[:], u[:])
+
+	op, np := oldParams, newParams
+	newRoot, err := VerityMigrate(&op, &np, dataPath, oldHash, newHash, oldRoot)
+	if err != nil {
+		t.Fatalf("VerityMigrate failed: %v", err)
+	}
+	rp := newParams
+	want, err := VerityCreate(&rp, dataPath, refHash)
+	if err != nil {
+		t.Fatalf("VerityCreate failed: %v", err)
+	}
+	if !bytes.Equal(newRoot, want) {
+		t.Errorf("new root %x, want %x", newRoot, want)
+	}
+	got, _ := os.ReadFile(newHash)
+	exp, _ := os.ReadFile(refHash)
+	if !bytes.Equal(got, exp) {
+		t.Error("new hash device differs from VerityCreate")
+	}
+
+	// Data that no longer matches the old tree gets no new tree.
+	corruptByte(t, dataPath, 4096*10)
+	op, np = oldParams, newParams
+	if _, err := VerityMigrate(&op, &np, dataPath, oldHash, newHash, oldRoot); err == nil {
+		t.Fatal("expected an error for tampered data")
+	}
+	if st, err := os.Stat(newHash); err != nil || st.Size() != 0 {
+		t.Errorf("new hash device not cleared: %v", err)
+	}
+	corruptByte(t, dataPath, 4096*10)
+
+	op, np = oldParams, newParams
+	if _, err := VerityMigrate(&op, &np, dataPath, oldHash, newHash, bytes.Repeat([]byte{0xaa}, len(oldRoot))); err == nil {
+		t.Error("expected an error for a wrong old root hash")
+	}
+	op, np = oldParams, newParams
+	if _, err := VerityMigrate(&op, &np, dataPath, oldHash, oldHash, oldRoot); err == nil {
+		t.Error("expected an error for a shared hash device")
+	}
+}
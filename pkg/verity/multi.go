@@ -0,0 +1,230 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package verity
+
+import (
+	"errors"
+	"fmt"
+	"hash"
+	"os"
+)
+
+// VerityCreateMulti builds one hash tree per params entry over dataDevice
+// while reading the data only once. The tree of params[i] is written to
+// hashDevices[i], which must be separate from the data and from each other,
+// and its root hash is returned at index i. Trees may differ in every
+// parameter, including the data block size and count. Every parameter set
+// is checked before any hash device is written.
+func VerityCreateMulti(params []*VerityParams, dataDevice string, hashDevices []string) ([][]byte, error) {
+	if len(params) == 0 || len(params) != len(hashDevices) {
+		return nil, errors.New("verity: need one hash device per parameter set")
+	}
+	seen := map[string]bool{dataDevice: true}
+	for _, h := range hashDevices {
+		if seen[h] {
+			return nil, fmt.Errorf("verity: hash device %s is used twice or is the data device", h)
+		}
+		seen[h] = true
+	}
+
+	hashers := make([]*VerityHash, len(params))
+	for i, p := range params {
+		vh, err := newMultiHash(p, dataDevice, hashDevices[i])
+		if err != nil {
+			return nil, fmt.Errorf("tree %d: %w", i, err)
+		}
+		hashers[i] = vh
+	}
+
+	trees := make([]*levelZero, 0, len(params))
+	defer func() {
+		for _, t := range trees {
+			t.hashFile.Close()
+		}
+	}()
+	for i, p := range params {
+		if err := writeSuperblockFor(p, dataDevice, hashDevices[i]); err != nil {
+			return nil, fmt.Errorf("tree %d: %w", i, err)
+		}
+		hashFile, err := os.OpenFile(hashDevices[i], os.O_RDWR, 0)
+		if err != nil {
+			return nil, fmt.Errorf("tree %d: cannot open hash device %s: %w", i, hashDevices[i], err)
+		}
+		t, err := hashers[i].newLevelZero(hashFile, false)
+		if err != nil {
+			hashFile.Close()
+			return nil, fmt.Errorf("tree %d: %w", i, err)
+		}
+		t.name = fmt.Sprintf("tree %d", i)
+		trees = append(trees, t)
+	}
+
+	return hashLevelZero(dataDevice, trees)
+}
+
+// newMultiHash checks p without touching any device and returns its
+// VerityHash.
+func newMultiHash(p *VerityParams, dataDevice, hashDevice string) (*VerityHash, error) {
+	if p == nil {
+		return nil, errors.New("verity: nil params")
+	}
+	vh, err := NewVerityHash(
+		p.HashName,
+		p.DataBlockSize, p.HashBlockSize,
+		p.DataBlocks,
+		p.HashType,
+		p.Salt,
+		p.HashAreaOffset,
+		dataDevice, hashDevice,
+		nil,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateParams(p, vh.hashFunc.Size()); err != nil {
+		return nil, err
+	}
+	if !p.NoSuperblock {
+		if _, err := buildSuperblockFromParams(p); err != nil {
+			return nil, err
+		}
+	}
+	return vh, nil
+}
+
+// hashLevelZero reads dataDevice once, ioChunkSize at a time, feeds every
+// chunk to each tree and returns their root hashes.
+func hashLevelZero(dataDevice string, trees []*levelZero) ([][]byte, error) {
+	var dataSize uint64
+	for _, t := range trees {
+		dataSize = max(dataSize, t.vh.dataBlocks*uint64(t.vh.dataBlockSize))
+	}
+
+	dataFile, err := os.Open(dataDevice)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open data device %s: %w", dataDevice, err)
+	}
+	defer dataFile.Close()
+
+	// Block sizes are powers of two no larger than ioChunkSize, so every
+	// chunk boundary is a block boundary of every tree.
+	buf := alignedBuffer(ioChunkSize)
+	for off := uint64(0); off < dataSize; off += ioChunkSize {
+		chunk := buf[:min(ioChunkSize, dataSize-off)]
+		if err := readFullAt(dataFile, chunk, int64(off)); err != nil {
+			return nil, fmt.Errorf("cannot read data block: %w", err)
+		}
+		for _, t := range trees {
+			if err := t.write(chunk); err != nil {
+				return nil, fmt.Errorf("%s: %w", t.name, err)
+			}
+		}
+	}
+
+	roots := make([][]byte, len(trees))
+	for i, t := range trees {
+		root, err := t.finish()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", t.name, err)
+		}
+		roots[i] = root
+	}
+	return roots, nil
+}
+
+// levelZero hashes the data it is fed, in order, into level 0 of one tree
+// and builds the levels above when finished. name labels its errors.
+type levelZero struct {
+	name     string
+	vh       *VerityHash
+	levels   []hashTreeLevel
+	hashFile *os.File
+	lv       *levelBuffer
+
+	h          hash.Hash
+	zeroBlock  []byte
+	zeroDigest []byte
+	digest     []byte
+	remaining  uint64
+}
+
+func (vh *VerityHash) newLevelZero(hashFile *os.File, verify bool) (*levelZero, error) {
+	levels, err := vh.hashLevels(vh.dataBlocks)
+	if err != nil {
+		return nil, fmt.Errorf("failed to calculate hash levels: %w", err)
+	}
+
+	// A single data block has no hash blocks; its digest is the root hash.
+	var wr *os.File
+	var levelOffset uint64
+	if len(levels) > 0 {
+		wr = hashFile
+		levelOffset = levels[0].offset
+	}
+
+	h := vh.hashFunc.New()
+	zeroBlock := make([]byte, vh.dataBlockSize)
+	zeroDigest, err := vh.digestInto(h, zeroBlock, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &levelZero{
+		vh:         vh,
+		levels:     levels,
+		hashFile:   hashFile,
+		lv:         vh.newLevelBuffer(wr, verify, 0, vh.dataBlockSize, levelOffset, vh.hashBlockSize, vh.dataBlocks),
+		h:          h,
+		zeroBlock:  zeroBlock,
+		zeroDigest: zeroDigest,
+		digest:     make([]byte, 0, h.Size()),
+		remaining:  vh.dataBlocks,
+	}, nil
+}
+
+// write hashes the data blocks in chunk, which starts on a block boundary.
+// Blocks past the end of the tree are ignored.
+func (t *levelZero) write(chunk []byte) error {
+	bs := uint64(t.vh.dataBlockSize)
+	n := min(uint64(len(chunk))/bs, t.remaining)
+	if n == 0 {
+		return nil
+	}
+	var err error
+	t.digest, err = t.lv.hashBlocks(t.h, chunk[:n*bs], t.zeroBlock, t.zeroDigest, t.digest)
+	t.remaining -= n
+	return err
+}
+
+// finish writes or compares the rest of level 0 and the upper levels and
+// returns the root hash.
+func (t *levelZero) finish() ([]byte, error) {
+	if t.remaining > 0 {
+		return nil, fmt.Errorf("data device ended %d blocks early", t.remaining)
+	}
+	root := make([]byte, t.h.Size())
+	if len(t.levels) == 0 {
+		copy(root, t.digest)
+		return root, nil
+	}
+	if err := t.lv.flush(); err != nil {
+		return nil, err
+	}
+	if err := t.vh.upperLevels(t.hashFile, t.levels, t.lv.verify, root); err != nil {
+		return nil, err
+	}
+	return root, nil
+}
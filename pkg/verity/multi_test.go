@@ -0,0 +1,109 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package verity
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestVerityCreateMulti(t *testing.T) {
+	dataPath, _ := createTestDataFile(t, 4096, 300)
+	defer os.Remove(dataPath)
+
+	newParams := func(hashName string, hashType, dataBlockSize, hashBlockSize uint32, dataBlocks uint64, salt []byte, noSuperblock bool) *VerityParams {
+		p := DefaultVerityParams()
+		p.HashName = hashName
+		p.HashType = hashType
+		p.DataBlockSize = dataBlockSize
+		p.HashBlockSize = hashBlockSize
+		p.DataBlocks = dataBlocks
+		p.Salt = salt
+		p.SaltSize = uint16(len(salt))
+		p.NoSuperblock = noSuperblock
+		if !noSuperblock {
+			p.HashAreaOffset = uint64(hashBlockSize)
+			u := uuid.New()
+			copy(p.UUID[:], u[:])
+		}
+		return &p
+	}
+
+	params := []*VerityParams{
+		newParams("sha256", 1, 4096, 4096, 300, []byte{0x01, 0x02}, false),
+		newParams("sha1", 0, 512, 512, 2400, []byte{0xaa}, true),
+		newParams("sha512", 1, 1024, 4096, 1000, nil, false),
+		newParams("sha256", 1, 4096, 4096, 1, nil, true),
+	}
+
+	var multiHashes, singleHashes []string
+	for range params {
+		h := createTestHashFile(t, 0)
+		defer os.Remove(h)
+		multiHashes = append(multiHashes, h)
+		h = createTestHashFile(t, 0)
+		defer os.Remove(h)
+		singleHashes = append(singleHashes, h)
+	}
+
+	multiParams := make([]*VerityParams, len(params))
+	for i, p := range params {
+		c := *p
+		multiParams[i] = &c
+	}
+	roots, err := VerityCreateMulti(multiParams, dataPath, multiHashes)
+	if err != nil {
+		t.Fatalf("VerityCreateMulti failed: %v", err)
+	}
+
+	for i, p := range params {
+		want, err := VerityCreate(p, dataPath, singleHashes[i])
+		if err != nil {
+			t.Fatalf("VerityCreate %d failed: %v", i, err)
+		}
+		if !bytes.Equal(roots[i], want) {
+			t.Errorf("tree %d: root %x, want %x", i, roots[i], want)
+		}
+		got, _ := os.ReadFile(multiHashes[i])
+		exp, _ := os.ReadFile(singleHashes[i])
+		if !bytes.Equal(got, exp) {
+			t.Errorf("tree %d: hash device differs from VerityCreate (%d vs %d bytes)", i, len(got), len(exp))
+		}
+	}
+
+	if _, err := VerityCreateMulti(params[:2], dataPath, []string{multiHashes[0], multiHashes[0]}); err == nil {
+		t.Error("expected an error for a shared hash device")
+	}
+	if _, err := VerityCreateMulti(params[:1], dataPath, []string{dataPath}); err == nil {
+		t.Error("expected an error for the data device as hash device")
+	}
+	before, _ := os.ReadFile(multiHashes[0])
+	invalid := newParams("sha256", 1, 4096, 3000, 300, nil, true)
+	if _, err := VerityCreateMulti([]*VerityParams{params[0], invalid}, dataPath, multiHashes[:2]); err == nil {
+		t.Error("expected an error for an invalid hash block size")
+	}
+	if after, _ := os.ReadFile(multiHashes[0]); !bytes.Equal(before, after) {
+		t.Error("invalid parameters of a later tree changed the hash device of an earlier one")
+	}
+	tooMany := newParams("sha256", 1, 4096, 4096, 301, nil, true)
+	if _, err := VerityCreateMulti([]*VerityParams{tooMany}, dataPath, multiHashes[:1]); err == nil {
+		t.Error("expected an error for more data blocks than the device holds")
+	}
+}
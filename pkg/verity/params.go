@@ -16,6 +16,8 @@
 
 package verity
 
+import "time"
+
 const (
 	VeritySignature      = "verity\x00\x00"
 	VeritySuperblockSize = 512
@@ -37,6 +39,21 @@ type VerityParams struct {
 	HashAreaOffset uint64
 	NoSuperblock   bool
 	UUID           [16]byte
+	// Use direct IO to read and write the devices in VerityCreate and
+	// VerityVerify, falling back to buffered IO where it is rejected
+	DirectIO bool
+	// Pace the reads of VerityVerify to these many bytes and operations
+	// per second; zero means unlimited
+	MaxBytesPerSec uint64
+	MaxIOPS        uint64
+	// Save the progress of VerityVerify to this file every
+	// CheckpointInterval (default 10s) and resume from it if it exists.
+	// The file is removed once verification succeeds
+	CheckpointFile     string
+	CheckpointInterval time.Duration
+	// Stage the trees of VerityRebuild in this directory instead of next
+	// to a hash file, or in os.TempDir() for a hash block device
+	ScratchDir string
 }
 
 func DefaultVerityParams() VerityParams {
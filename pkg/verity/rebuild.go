@@ -0,0 +1,141 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package verity
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/containerd/go-dmverity/pkg/utils"
+)
+
+// VerityRebuild recomputes the hash tree of dataDevice and writes it to
+// hashDevice only if its root hash equals rootHash. params must be complete,
+// as filled in by InitParams or taken from a manifest. Unless
+// params.NoSuperblock is set the superblock is rewritten from params, so its
+// UUID and salt are kept.
+func VerityRebuild(params *VerityParams, dataDevice, hashDevice string, rootHash []byte) error {
+	if params == nil {
+		return errors.New("verity: nil params")
+	}
+	if !params.NoSuperblock && params.UUID == ([16]byte{}) {
+		return errors.New("verity: superblock UUID required to rebuild")
+	}
+
+	tmp, err := os.CreateTemp(scratchDir(hashDevice, params.ScratchDir), "."+filepath.Base(hashDevice)+".rebuild-*")
+	if err != nil {
+		return fmt.Errorf("cannot create temporary hash file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	// Build the tree at offset 0 of a scratch file; digests do not depend on
+	// where the tree is stored.
+	vh, err := NewVerityHash(
+		params.HashName,
+		params.DataBlockSize, params.HashBlockSize,
+		params.DataBlocks,
+		params.HashType,
+		params.Salt,
+		0,
+		dataDevice, tmp.Name(),
+		nil,
+	)
+	if err != nil {
+		return err
+	}
+
+	if err := validateParams(params, vh.hashFunc.Size()); err != nil {
+		return err
+	}
+
+	treeSize, err := vh.GetHashTreeSize()
+	if err != nil {
+		return err
+	}
+	if err := tmp.Truncate(int64(treeSize)); err != nil {
+		return fmt.Errorf("cannot size temporary hash file: %w", err)
+	}
+	if err := vh.CreateOrVerifyHashTree(false); err != nil {
+		return err
+	}
+
+	if !bytesEqual(vh.RootHash(), rootHash) {
+		return fmt.Errorf("computed root hash %x does not match %x; hash device left unchanged", vh.RootHash(), rootHash)
+	}
+
+	hashFile, err := os.OpenFile(hashDevice, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return fmt.Errorf("cannot open hash device %s: %w", hashDevice, err)
+	}
+	defer hashFile.Close()
+
+	if !params.NoSuperblock {
+		p := *params
+		sb, err := buildSuperblockFromParams(&p)
+		if err != nil {
+			return err
+		}
+		sbBytes, err := sb.Serialize()
+		if err != nil {
+			return err
+		}
+
+		// The superblock block is rewritten whole so stale bytes after the
+		// superblock are cleared too.
+		sbArea := utils.AlignUp(uint64(VeritySuperblockSize), uint64(params.HashBlockSize))
+		sbOffset := uint64(0)
+		if dataDevice == hashDevice {
+			if params.HashAreaOffset < sbArea {
+				return fmt.Errorf("hash offset %d leaves no room for the superblock", params.HashAreaOffset)
+			}
+			sbOffset = params.HashAreaOffset - sbArea
+		}
+		buf := make([]byte, params.HashAreaOffset-sbOffset)
+		copy(buf, sbBytes)
+		if _, err := hashFile.WriteAt(buf, int64(sbOffset)); err != nil {
+			return fmt.Errorf("cannot write superblock: %w", err)
+		}
+	}
+
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if _, err := io.Copy(io.NewOffsetWriter(hashFile, int64(params.HashAreaOffset)), tmp); err != nil {
+		return fmt.Errorf("cannot write hash tree: %w", err)
+	}
+
+	return hashFile.Sync()
+}
+
+// scratchDir returns the directory for a scratch copy of the tree of
+// hashDevice: dir if set, else next to a hash file, which has room for the
+// tree, else os.TempDir(). The directory of a block device is usually a
+// small devtmpfs.
+func scratchDir(hashDevice, dir string) string {
+	if dir != "" {
+		return dir
+	}
+	st, err := os.Stat(hashDevice)
+	if errors.Is(err, os.ErrNotExist) || (err == nil && st.Mode().IsRegular()) {
+		return filepath.Dir(hashDevice)
+	}
+	return os.TempDir()
+}
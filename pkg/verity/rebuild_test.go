@@ -0,0 +1,111 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package verity
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestVerityRebuild(t *testing.T) {
+	dataPath, _ := createTestDataFile(t, 4096, 300)
+	defer os.Remove(dataPath)
+	hashPath := createTestHashFile(t, 0)
+	defer os.Remove(hashPath)
+
+	params := DefaultVerityParams()
+	params.DataBlockSize = 4096
+	params.HashBlockSize = 4096
+	params.DataBlocks = 300
+	params.HashAreaOffset = 4096
+	params.Salt = []byte{0xaa, 0xbb, 0xcc}
+	params.SaltSize = 3
+	testUUID := uuid.New()
+	copy(params.UUID[:], testUUID[:])
+	rootHash, err := VerityCreate(&params, dataPath, hashPath)
+	if err != nil {
+		t.Fatalf("VerityCreate failed: %v", err)
+	}
+	original, err := os.ReadFile(hashPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Lose the hash device entirely; params stand in for a manifest.
+	if err := os.Truncate(hashPath, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	wrong := append([]byte(nil), rootHash...)
+	wrong[0] ^= 0xff
+	if err := VerityRebuild(&params, dataPath, hashPath, wrong); err == nil || !strings.Contains(err.Error(), "left unchanged") {
+		t.Errorf("expected a root mismatch, got %v", err)
+	}
+	if st, err := os.Stat(hashPath); err != nil || st.Size() != 0 {
+		t.Errorf("hash device changed after a failed rebuild: %v", err)
+	}
+
+	if err := VerityRebuild(&params, dataPath, hashPath, rootHash); err != nil {
+		t.Fatalf("VerityRebuild failed: %v", err)
+	}
+	rebuilt, err := os.ReadFile(hashPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(rebuilt, original) {
+		t.Error("rebuilt hash device differs from the original")
+	}
+
+	corruptByte(t, dataPath, 4096*7)
+	if err := VerityRebuild(&params, dataPath, hashPath, rootHash); err == nil {
+		t.Error("expected an error when the data no longer matches the root hash")
+	}
+
+	noUUID := params
+	noUUID.UUID = [16]byte{}
+	if err := VerityRebuild(&noUUID, dataPath, hashPath, rootHash); err == nil {
+		t.Error("expected an error for a superblock without UUID")
+	}
+}
+
+func TestScratchDir(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "hash.img")
+	if err := os.WriteFile(file, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		hashDevice, dir, want string
+	}{
+		{file, "", dir},
+		{filepath.Join(dir, "new.img"), "", dir},
+		{"/dev/null", "", os.TempDir()},
+		{file, "/scratch", "/scratch"},
+		{"/dev/null", "/scratch", "/scratch"},
+	}
+	for _, tt := range tests {
+		if got := scratchDir(tt.hashDevice, tt.dir); got != tt.want {
+			t.Errorf("scratchDir(%q, %q) = %q, want %q", tt.hashDevice, tt.dir, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,260 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package verity
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"os"
+	"slices"
+
+	"golang.org/x/sys/unix"
+)
+
+// SampleConfidence is the confidence level of SampleResult.MaxCorruptFraction.
+const SampleConfidence = 0.95
+
+// SampleOptions selects the data blocks VeritySample checks: Count blocks,
+// or the Fraction (0, 1] of all blocks when Fraction is set, drawn without
+// replacement by a generator seeded with Seed.
+type SampleOptions struct {
+	Count    uint64
+	Fraction float64
+	Seed     uint64
+}
+
+// SampleResult is the outcome of VeritySample. When no sampled block
+// failed, fewer than MaxCorruptFraction of the data blocks are corrupted
+// with probability Confidence. Both are left zero when a block failed.
+type SampleResult struct {
+	Seed               uint64   `json:"seed"`
+	DataBlocks         uint64   `json:"data_blocks"`
+	Sampled            uint64   `json:"sampled"`
+	HashBlocksRead     uint64   `json:"hash_blocks_read"`
+	FailedBlocks       []uint64 `json:"failed_blocks,omitempty"`
+	Confidence         float64  `json:"confidence"`
+	MaxCorruptFraction float64  `json:"max_corrupt_fraction"`
+}
+
+// VeritySample checks randomly chosen data blocks against the root hash,
+// each through its own path of hash blocks, so only those hash blocks are
+// read. Hash blocks already authenticated by an earlier sample end the walk
+// early. Blocks that fail are listed in the result, not returned as an
+// error. params.MaxBytesPerSec, MaxIOPS and DirectIO apply as in
+// VerityVerify; checkpoints do not.
+func VeritySample(params *VerityParams, dataDevice, hashDevice string, rootHash []byte, opts SampleOptions) (*SampleResult, error) {
+	if params == nil {
+		return nil, errors.New("verity: nil params")
+	}
+	if params.CheckpointFile != "" {
+		return nil, errors.New("verity: checkpoints do not apply to sampled verification")
+	}
+	if err := readSuperblockParams(params, dataDevice, hashDevice); err != nil {
+		return nil, err
+	}
+
+	vh, err := NewVerityHash(
+		params.HashName,
+		params.DataBlockSize, params.HashBlockSize,
+		params.DataBlocks,
+		params.HashType,
+		params.Salt,
+		params.HashAreaOffset,
+		dataDevice, hashDevice,
+		rootHash,
+	)
+	if err != nil {
+		return nil, err
+	}
+	vh.limiter = newIOLimiter(params.MaxBytesPerSec, params.MaxIOPS)
+	if err := validateParams(params, vh.hashFunc.Size()); err != nil {
+		return nil, err
+	}
+	if len(rootHash) != vh.hashFunc.Size() {
+		return nil, fmt.Errorf("root hash is %d bytes, %s needs %d", len(rootHash), params.HashName, vh.hashFunc.Size())
+	}
+
+	count, err := sampleCount(opts, params.DataBlocks)
+	if err != nil {
+		return nil, err
+	}
+	blocks := sampleBlocks(params.DataBlocks, count, opts.Seed)
+
+	res, err := vh.sample(blocks, params.DirectIO)
+	if params.DirectIO && errors.Is(err, unix.EINVAL) {
+		// The device accepted O_DIRECT but not our offsets or sizes.
+		res, err = vh.sample(blocks, false)
+	}
+	if err != nil {
+		return nil, err
+	}
+	res.Seed = opts.Seed
+	res.DataBlocks = params.DataBlocks
+	res.Sampled = count
+	if len(res.FailedBlocks) == 0 {
+		res.Confidence = SampleConfidence
+		res.MaxCorruptFraction = maxCorruptFraction(count, params.DataBlocks, SampleConfidence)
+	}
+	return res, nil
+}
+
+func sampleCount(opts SampleOptions, dataBlocks uint64) (uint64, error) {
+	count := opts.Count
+	if opts.Fraction != 0 {
+		if opts.Fraction < 0 || opts.Fraction > 1 || math.IsNaN(opts.Fraction) {
+			return 0, fmt.Errorf("sample fraction %v is not in (0, 1]", opts.Fraction)
+		}
+		count = uint64(math.Ceil(opts.Fraction * float64(dataBlocks)))
+	}
+	if count == 0 {
+		return 0, errors.New("sample size must be positive")
+	}
+	return min(count, dataBlocks), nil
+}
+
+// sampleBlocks returns count distinct block numbers below n in ascending
+// order, chosen with Floyd's algorithm.
+func sampleBlocks(n, count, seed uint64) []uint64 {
+	if count >= n {
+		blocks := make([]uint64, n)
+		for i := range blocks {
+			blocks[i] = uint64(i)
+		}
+		return blocks
+	}
+
+	rng := rand.New(rand.NewPCG(seed, seed^0x9e3779b97f4a7c15))
+	chosen := make(map[uint64]struct{}, count)
+	blocks := make([]uint64, 0, count)
+	for j := n - count; j < n; j++ {
+		b := rng.Uint64N(j + 1)
+		if _, ok := chosen[b]; ok {
+			b = j
+		}
+		chosen[b] = struct{}{}
+		blocks = append(blocks, b)
+	}
+	slices.Sort(blocks)
+	return blocks
+}
+
+// maxCorruptFraction returns the largest fraction of corrupted blocks that
+// a clean sample of count out of n blocks fails to reveal with probability
+// at least 1-confidence. Blocks are sampled without replacement, but the
+// formula for sampling with replacement is used as a conservative bound.
+func maxCorruptFraction(count, n uint64, confidence float64) float64 {
+	if count >= n {
+		return 0
+	}
+	return 1 - math.Pow(1-confidence, 1/float64(count))
+}
+
+// pathBlock is the hash block of one level on the current sample's path.
+type pathBlock struct {
+	offset        uint64
+	data          []byte
+	loaded        bool
+	authenticated bool
+}
+
+func (vh *VerityHash) sample(blocks []uint64, direct bool) (*SampleResult, error) {
+	levels, err := vh.hashLevels(vh.dataBlocks)
+	if err != nil {
+		return nil, fmt.Errorf("failed to calculate hash levels: %w", err)
+	}
+
+	dataFile, err := openForIO(vh.dataDevice, os.O_RDONLY, direct)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open data device %s: %w", vh.dataDevice, err)
+	}
+	defer dataFile.Close()
+	hashFile, err := openForIO(vh.hashDevice, os.O_RDONLY, direct)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open hash device %s: %w", vh.hashDevice, err)
+	}
+	defer hashFile.Close()
+
+	digestSize := uint64(vh.hashFunc.Size())
+	hashPerBlock := uint64(1) << getBitsDown(vh.hashBlockSize/uint32(digestSize))
+	entrySize := uint64(vh.getDigestSizeFull(uint32(digestSize)))
+
+	path := make([]pathBlock, len(levels))
+	for i := range path {
+		path[i].data = alignedBuffer(int(vh.hashBlockSize))
+	}
+	dataBlock := alignedBuffer(int(vh.dataBlockSize))
+	h := vh.hashFunc.New()
+	var digest []byte
+	res := &SampleResult{}
+
+	for _, b := range blocks {
+		vh.limiter.wait(len(dataBlock))
+		if err := readFullAt(dataFile, dataBlock, int64(b*uint64(vh.dataBlockSize))); err != nil {
+			return nil, fmt.Errorf("cannot read data block %d: %w", b, err)
+		}
+		if digest, err = vh.digestInto(h, dataBlock, digest[:0]); err != nil {
+			return nil, err
+		}
+
+		ok, authenticated := true, false
+		idx := b
+		top := 0
+		for i, level := range levels {
+			pb := &path[i]
+			offset := level.offset + (idx/hashPerBlock)*uint64(vh.hashBlockSize)
+			if !pb.loaded || pb.offset != offset {
+				vh.limiter.wait(len(pb.data))
+				if err := readFullAt(hashFile, pb.data, int64(offset)); err != nil {
+					return nil, fmt.Errorf("cannot read level %d hash block: %w", i, err)
+				}
+				pb.offset, pb.loaded, pb.authenticated = offset, true, false
+				res.HashBlocksRead++
+			}
+
+			entry := (idx % hashPerBlock) * entrySize
+			top = i
+			if !bytes.Equal(pb.data[entry:entry+digestSize], digest) {
+				ok = false
+				break
+			}
+			if pb.authenticated {
+				authenticated = true
+				break
+			}
+			if digest, err = vh.digestInto(h, pb.data, digest[:0]); err != nil {
+				return nil, err
+			}
+			idx /= hashPerBlock
+		}
+
+		if ok && !authenticated {
+			ok = bytes.Equal(digest, vh.rootHash)
+			top = len(levels) - 1
+		}
+		if !ok {
+			res.FailedBlocks = append(res.FailedBlocks, b)
+			continue
+		}
+		for i := 0; i <= top && i < len(path); i++ {
+			path[i].authenticated = true
+		}
+	}
+	return res, nil
+}
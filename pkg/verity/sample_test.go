@@ -0,0 +1,123 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package verity
+
+import (
+	"math"
+	"os"
+	"reflect"
+	"slices"
+	"testing"
+)
+
+func TestVeritySample(t *testing.T) {
+	const dataBlocks = 8192
+	dataPath, data := createTestDataFile(t, 512, dataBlocks)
+	defer os.Remove(dataPath)
+	hashPath := createTestHashFile(t, 0)
+	defer os.Remove(hashPath)
+
+	params := DefaultVerityParams()
+	params.DataBlockSize = 512
+	params.HashBlockSize = 512
+	params.DataBlocks = dataBlocks
+	params.NoSuperblock = true
+	rootHash, err := VerityCreate(&params, dataPath, hashPath)
+	if err != nil {
+		t.Fatalf("VerityCreate failed: %v", err)
+	}
+	treeSize, err := GetHashTreeSize(&params)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := VeritySample(&params, dataPath, hashPath, rootHash, SampleOptions{Count: 100, Seed: 1})
+	if err != nil {
+		t.Fatalf("VeritySample failed: %v", err)
+	}
+	if res.Sampled != 100 || res.DataBlocks != dataBlocks || len(res.FailedBlocks) != 0 {
+		t.Fatalf("unexpected result: %+v", res)
+	}
+	if res.HashBlocksRead == 0 || res.HashBlocksRead >= treeSize/512 {
+		t.Errorf("expected a fraction of the %d hash blocks to be read, got %d", treeSize/512, res.HashBlocksRead)
+	}
+	if res.MaxCorruptFraction <= 0 || res.MaxCorruptFraction >= 0.05 {
+		t.Errorf("unexpected corruption bound %v", res.MaxCorruptFraction)
+	}
+
+	// Every block is sampled with a fraction of 1, so a single corrupted
+	// block is found and nothing else fails.
+	data[512*4321] ^= 0xff
+	if err := os.WriteFile(dataPath, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	res, err = VeritySample(&params, dataPath, hashPath, rootHash, SampleOptions{Fraction: 1})
+	if err != nil {
+		t.Fatalf("VeritySample failed: %v", err)
+	}
+	if !reflect.DeepEqual(res.FailedBlocks, []uint64{4321}) || res.Confidence != 0 || res.MaxCorruptFraction != 0 {
+		t.Errorf("expected only block 4321 to fail, got %+v", res)
+	}
+
+	wrongRoot := make([]byte, len(rootHash))
+	res, err = VeritySample(&params, dataPath, hashPath, wrongRoot, SampleOptions{Count: 10, Seed: 2})
+	if err != nil {
+		t.Fatalf("VeritySample failed: %v", err)
+	}
+	if len(res.FailedBlocks) != 10 {
+		t.Errorf("expected every sample to fail against a wrong root, got %v", res.FailedBlocks)
+	}
+	if res.MaxCorruptFraction != 0 {
+		t.Errorf("expected no corruption bound for a failed sample, got %v", res.MaxCorruptFraction)
+	}
+
+	invalid := []SampleOptions{{}, {Fraction: 1.5}, {Fraction: -0.1}}
+	for _, opts := range invalid {
+		if _, err := VeritySample(&params, dataPath, hashPath, rootHash, opts); err == nil {
+			t.Errorf("VeritySample(%+v): expected error", opts)
+		}
+	}
+}
+
+func TestSampleBlocks(t *testing.T) {
+	a := sampleBlocks(1000, 100, 42)
+	if len(a) != 100 || !slices.IsSorted(a) || len(slices.Compact(slices.Clone(a))) != 100 {
+		t.Fatalf("expected 100 distinct sorted blocks, got %v", a)
+	}
+	if a[len(a)-1] >= 1000 {
+		t.Errorf("block %d out of range", a[len(a)-1])
+	}
+	if b := sampleBlocks(1000, 100, 42); !reflect.DeepEqual(a, b) {
+		t.Error("the same seed chose different blocks")
+	}
+	if b := sampleBlocks(1000, 100, 43); reflect.DeepEqual(a, b) {
+		t.Error("different seeds chose the same blocks")
+	}
+	if all := sampleBlocks(5, 10, 1); !reflect.DeepEqual(all, []uint64{0, 1, 2, 3, 4}) {
+		t.Errorf("expected every block, got %v", all)
+	}
+}
+
+func TestMaxCorruptFraction(t *testing.T) {
+	// The rule of three: about 3/n at 95% confidence.
+	if got := maxCorruptFraction(300, 1<<30, 0.95); math.Abs(got-0.01) > 0.0005 {
+		t.Errorf("expected about 1%%, got %v", got)
+	}
+	if got := maxCorruptFraction(10, 10, 0.95); got != 0 {
+		t.Errorf("expected 0 for a full sample, got %v", got)
+	}
+}
@@ -0,0 +1,251 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package verity
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/containerd/go-dmverity/pkg/dm"
+	"github.com/containerd/go-dmverity/pkg/utils"
+)
+
+const (
+	scrubChunkSize = 1 << 20
+	// scrubRetrySize is the unit a failed chunk is re-read in to narrow
+	// down the bad sectors.
+	scrubRetrySize = 4096
+)
+
+// ScrubOptions selects the part of the device VerityScrub reads. Offset and
+// Length are in bytes and must be multiples of 512; direct I/O usually also
+// needs them aligned to the device's data block size.
+type ScrubOptions struct {
+	Offset   uint64
+	Length   uint64 // 0 reads to the end of the device
+	Workers  int    // 0 uses one worker per CPU
+	DirectIO bool
+}
+
+// ScrubRange is a run of sectors that could not be read.
+type ScrubRange struct {
+	StartSector uint64 `json:"start_sector"`
+	Sectors     uint64 `json:"sectors"`
+	Error       string `json:"error"`
+}
+
+// ScrubResult describes a VerityScrub run. Status is the target status
+// read after scrubbing.
+type ScrubResult struct {
+	Name      string       `json:"name"`
+	Path      string       `json:"path"`
+	Offset    uint64       `json:"offset"`
+	Length    uint64       `json:"length"`
+	BadRanges []ScrubRange `json:"bad_ranges"`
+	Status    string       `json:"status"`
+	Corrupted bool         `json:"corrupted"`
+}
+
+// VerityScrub reads the active verity device name through the mapper so the
+// kernel checks every block it returns, records the sectors that fail with
+// EIO and then reports whether the target has flagged corruption. Other
+// read errors abort the scrub.
+func VerityScrub(name string, opts ScrubOptions) (*ScrubResult, error) {
+	c, err := dm.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer c.Close()
+
+	st, err := c.DeviceStatus(name)
+	if err != nil {
+		return nil, err
+	}
+	if !st.ActivePresent {
+		return nil, fmt.Errorf("device %s is not active", name)
+	}
+
+	res := &ScrubResult{Name: name, Path: "/dev/mapper/" + name, Offset: opts.Offset}
+	size, err := utils.GetBlockOrFileSize(res.Path)
+	if err != nil {
+		return nil, err
+	}
+	if res.Length, err = scrubLength(opts, uint64(size)); err != nil {
+		return nil, err
+	}
+
+	res.BadRanges, err = scrubDevice(res.Path, res.Offset, res.Length, opts.Workers, opts.DirectIO)
+	if opts.DirectIO && errors.Is(err, unix.EINVAL) {
+		// The device accepted O_DIRECT but not our offsets or sizes.
+		res.BadRanges, err = scrubDevice(res.Path, res.Offset, res.Length, opts.Workers, false)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	status, err := c.TableStatus(name, false)
+	if err != nil {
+		return nil, err
+	}
+	res.Status = strings.TrimSpace(status)
+	if fields := strings.Fields(res.Status); len(fields) > 0 && fields[0] == "C" {
+		res.Corrupted = true
+	}
+	return res, nil
+}
+
+func scrubLength(opts ScrubOptions, size uint64) (uint64, error) {
+	if opts.Offset%diskSectorSize != 0 || opts.Length%diskSectorSize != 0 {
+		return 0, fmt.Errorf("scrub offset %d and length %d must be multiples of %d", opts.Offset, opts.Length, diskSectorSize)
+	}
+	if opts.Offset >= size {
+		return 0, fmt.Errorf("scrub offset %d is beyond the device size %d", opts.Offset, size)
+	}
+	length := opts.Length
+	if length == 0 {
+		length = size - opts.Offset
+	}
+	if length > size-opts.Offset {
+		return 0, fmt.Errorf("scrub range %d+%d exceeds the device size %d", opts.Offset, length, size)
+	}
+	return length, nil
+}
+
+func scrubDevice(path string, offset, length uint64, workers int, direct bool) ([]ScrubRange, error) {
+	f, err := openForIO(path, os.O_RDONLY, direct)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open %s: %w", path, err)
+	}
+	defer f.Close()
+	return scrubRange(f, offset, length, workers)
+}
+
+// scrubRange reads [offset, offset+length) of r in chunks with the given
+// number of workers and returns the merged sector ranges that failed with
+// EIO, in order.
+func scrubRange(r io.ReaderAt, offset, length uint64, workers int) ([]ScrubRange, error) {
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+
+	chunks := make(chan uint64)
+	stop := make(chan struct{})
+	var (
+		mu       sync.Mutex
+		bad      []ScrubRange
+		firstErr error
+		once     sync.Once
+		wg       sync.WaitGroup
+	)
+	fail := func(err error) {
+		once.Do(func() {
+			firstErr = err
+			close(stop)
+		})
+	}
+
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			buf := alignedBuffer(scrubChunkSize)
+			for off := range chunks {
+				n := min(uint64(scrubChunkSize), offset+length-off)
+				ranges, err := scrubChunk(r, buf[:n], off)
+				if err != nil {
+					fail(err)
+					return
+				}
+				if len(ranges) > 0 {
+					mu.Lock()
+					bad = append(bad, ranges...)
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+
+feed:
+	for off := offset; off < offset+length; off += scrubChunkSize {
+		select {
+		case chunks <- off:
+		case <-stop:
+			break feed
+		}
+	}
+	close(chunks)
+	wg.Wait()
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	return mergeScrubRanges(bad), nil
+}
+
+// scrubChunk reads buf at off and, if that fails with EIO, re-reads it in
+// scrubRetrySize pieces to find the bad ones.
+func scrubChunk(r io.ReaderAt, buf []byte, off uint64) ([]ScrubRange, error) {
+	err := readFullAt(r, buf, int64(off))
+	if err == nil {
+		return nil, nil
+	}
+	if !errors.Is(err, unix.EIO) {
+		return nil, fmt.Errorf("read at %d: %w", off, err)
+	}
+
+	var bad []ScrubRange
+	for pos := 0; pos < len(buf); pos += scrubRetrySize {
+		piece := buf[pos:min(pos+scrubRetrySize, len(buf))]
+		err := readFullAt(r, piece, int64(off)+int64(pos))
+		if err == nil {
+			continue
+		}
+		if !errors.Is(err, unix.EIO) {
+			return nil, fmt.Errorf("read at %d: %w", off+uint64(pos), err)
+		}
+		bad = append(bad, ScrubRange{
+			StartSector: (off + uint64(pos)) / diskSectorSize,
+			Sectors:     uint64(len(piece)) / diskSectorSize,
+			Error:       unix.EIO.Error(),
+		})
+	}
+	return bad, nil
+}
+
+func mergeScrubRanges(ranges []ScrubRange) []ScrubRange {
+	slices.SortFunc(ranges, func(a, b ScrubRange) int {
+		return cmp.Compare(a.StartSector, b.StartSector)
+	})
+	// Never nil, so a clean scrub reports an empty list in JSON.
+	out := []ScrubRange{}
+	for _, r := range ranges {
+		if n := len(out); n > 0 && out[n-1].StartSector+out[n-1].Sectors == r.StartSector && out[n-1].Error == r.Error {
+			out[n-1].Sectors += r.Sectors
+			continue
+		}
+		out = append(out, r)
+	}
+	return out
+}
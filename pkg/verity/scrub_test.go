@@ -0,0 +1,93 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package verity
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+// badReader fails reads that touch any of the bad 4 KiB blocks.
+type badReader struct {
+	data []byte
+	bad  map[int64]error
+}
+
+func (r *badReader) ReadAt(p []byte, off int64) (int, error) {
+	for b := off / 4096; b*4096 < off+int64(len(p)); b++ {
+		if err, ok := r.bad[b]; ok {
+			return 0, err
+		}
+	}
+	return bytes.NewReader(r.data).ReadAt(p, off)
+}
+
+func TestScrubRange(t *testing.T) {
+	r := &badReader{
+		data: make([]byte, 3<<20),
+		bad:  map[int64]error{3: unix.EIO, 4: unix.EIO, 300: unix.EIO},
+	}
+
+	got, err := scrubRange(r, 0, uint64(len(r.data)), 4)
+	if err != nil {
+		t.Fatalf("scrubRange failed: %v", err)
+	}
+	want := []ScrubRange{
+		{StartSector: 24, Sectors: 16, Error: unix.EIO.Error()},
+		{StartSector: 2400, Sectors: 8, Error: unix.EIO.Error()},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+
+	// Ranges outside [offset, offset+length) are not read.
+	got, err = scrubRange(r, 8192, 4096, 1)
+	if err != nil || got == nil || len(got) != 0 {
+		t.Errorf("expected a clean partial scrub, got %#v, %v", got, err)
+	}
+
+	r.bad[600] = unix.EACCES
+	if _, err := scrubRange(r, 0, uint64(len(r.data)), 4); !errors.Is(err, unix.EACCES) {
+		t.Errorf("expected EACCES to abort the scrub, got %v", err)
+	}
+}
+
+func TestScrubLength(t *testing.T) {
+	tests := []struct {
+		opts    ScrubOptions
+		want    uint64
+		wantErr bool
+	}{
+		{ScrubOptions{}, 1 << 20, false},
+		{ScrubOptions{Offset: 4096}, 1<<20 - 4096, false},
+		{ScrubOptions{Offset: 4096, Length: 8192}, 8192, false},
+		{ScrubOptions{Offset: 100}, 0, true},
+		{ScrubOptions{Length: 100}, 0, true},
+		{ScrubOptions{Offset: 1 << 20}, 0, true},
+		{ScrubOptions{Offset: 4096, Length: 1 << 20}, 0, true},
+	}
+	for _, tc := range tests {
+		got, err := scrubLength(tc.opts, 1<<20)
+		if (err != nil) != tc.wantErr || got != tc.want {
+			t.Errorf("scrubLength(%+v) = %d, %v", tc.opts, got, err)
+		}
+	}
+}
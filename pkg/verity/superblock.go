@@ -18,7 +18,6 @@ package verity
 
 import (
 	"bytes"
-	"crypto"
 	"encoding/binary"
 	"errors"
 	"fmt"
@@ -210,8 +209,8 @@ func buildSuperblockFromParams(p *VerityParams) (*VeritySuperblock, error) {
 	if algo == "" {
 		return nil, errors.New("verity: hash algorithm required")
 	}
-	if !isHashAlgorithmSupported(algo) {
-		return nil, fmt.Errorf("verity: hash algorithm %s not supported", algo)
+	if _, err := lookupHash(algo); err != nil {
+		return nil, err
 	}
 
 	sb := DefaultVeritySuperblock()
@@ -267,8 +266,8 @@ func adoptParamsFromSuperblock(p *VerityParams, sb *VeritySuperblock, sbOffset u
 		return fmt.Errorf("verity: algorithm mismatch: param %s superblock %s", p.HashName, algo)
 	}
 
-	if !isHashAlgorithmSupported(p.HashName) {
-		return fmt.Errorf("verity: hash algorithm %s not supported", p.HashName)
+	if _, err := lookupHash(p.HashName); err != nil {
+		return err
 	}
 
 	if p.DataBlockSize == 0 {
@@ -313,17 +312,3 @@ func adoptParamsFromSuperblock(p *VerityParams, sb *VeritySuperblock, sbOffset u
 	}
 	return nil
 }
-
-func isHashAlgorithmSupported(name string) bool {
-	h := map[string]crypto.Hash{
-		"sha1":   crypto.SHA1,
-		"sha256": crypto.SHA256,
-		"sha512": crypto.SHA512,
-	}
-	algo := strings.ToLower(strings.TrimSpace(name))
-	hash, ok := h[algo]
-	if !ok {
-		return false
-	}
-	return hash.Available()
-}
@@ -402,7 +402,7 @@ func TestBuildSuperblockFromParams(t *testing.T) {
 		{
 			name: "unsupported hash algorithm",
 			params: &VerityParams{
-				HashName: "md5", DataBlockSize: 4096, HashBlockSize: 4096,
+				HashName: "no-such-hash", DataBlockSize: 4096, HashBlockSize: 4096,
 				DataBlocks: 100, HashType: 1, Salt: make([]byte, 32), SaltSize: 32, UUID: uuid.New(),
 			},
 			wantErr: true,
@@ -0,0 +1,386 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package verity
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/containerd/go-dmverity/pkg/dm"
+	"github.com/containerd/go-dmverity/pkg/gpt"
+	"github.com/containerd/go-dmverity/pkg/utils"
+)
+
+// DeviceFormat selects how devices are referenced in a generated table.
+type DeviceFormat int
+
+const (
+	DeviceFormatPath DeviceFormat = iota
+	DeviceFormatMajorMinor
+	DeviceFormatPartUUID
+)
+
+func ParseDeviceFormat(s string) (DeviceFormat, error) {
+	switch s {
+	case "path":
+		return DeviceFormatPath, nil
+	case "major-minor", "devno":
+		return DeviceFormatMajorMinor, nil
+	case "partuuid":
+		return DeviceFormatPartUUID, nil
+	}
+	return 0, fmt.Errorf("unknown device format %q (expected path, major-minor or partuuid)", s)
+}
+
+type TableOptions struct {
+	// UUID is the device-mapper UUID; empty leaves it unset.
+	UUID string
+	// Minor is the requested minor number; empty lets the kernel choose.
+	Minor        string
+	Flags        []string
+	DeviceFormat DeviceFormat
+}
+
+// Table is a single-target verity table ready to be rendered for dmsetup or
+// the kernel command line.
+type Table struct {
+	Name   string
+	UUID   string
+	Minor  string
+	Length uint64
+	Params string
+
+	args dm.OpenArgs
+}
+
+// VerityTable builds the table VerityOpen would load, without touching
+// device-mapper. The superblock is read via InitParams.
+func VerityTable(params *VerityParams, name, dataDevice, hashDevice string, rootHash []byte, opts TableOptions) (*Table, error) {
+	if err := InitParams(params, dataDevice, hashDevice); err != nil {
+		return nil, fmt.Errorf("InitParams failed: %w", err)
+	}
+	if err := ValidateRootHashSize(rootHash, params.HashName); err != nil {
+		return nil, err
+	}
+	if strings.ContainsAny(name+opts.UUID+opts.Minor, ",; \t\n\"") {
+		return nil, errors.New("name, uuid and minor must not contain separators, spaces or quotes")
+	}
+
+	dataRef, err := formatDevice(dataDevice, opts.DeviceFormat)
+	if err != nil {
+		return nil, fmt.Errorf("data device: %w", err)
+	}
+	hashRef, err := formatDevice(hashDevice, opts.DeviceFormat)
+	if err != nil {
+		return nil, fmt.Errorf("hash device: %w", err)
+	}
+
+	args := dm.OpenArgs{
+		Version:        params.HashType,
+		DataDevice:     dataRef,
+		HashDevice:     hashRef,
+		DataBlockSize:  params.DataBlockSize,
+		HashBlockSize:  params.HashBlockSize,
+		DataBlocks:     params.DataBlocks,
+		HashName:       params.HashName,
+		RootDigest:     rootHash,
+		Salt:           params.Salt,
+		HashStartBytes: params.HashAreaOffset,
+		Flags:          opts.Flags,
+	}
+	targetParams, err := dm.BuildTargetParams(args)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Table{
+		Name:   name,
+		UUID:   opts.UUID,
+		Minor:  opts.Minor,
+		Length: params.DataBlocks * uint64(params.DataBlockSize/diskSectorSize),
+		Params: targetParams,
+		args:   args,
+	}, nil
+}
+
+func formatDevice(path string, format DeviceFormat) (string, error) {
+	switch format {
+	case DeviceFormatMajorMinor:
+		return utils.DeviceNumber(path)
+	case DeviceFormatPartUUID:
+		if strings.HasPrefix(path, "PARTUUID=") {
+			return path, nil
+		}
+		u, err := gpt.DevicePartUUID(path)
+		if err != nil {
+			return "", err
+		}
+		return "PARTUUID=" + u.String(), nil
+	}
+	return path, nil
+}
+
+// String returns the table line as accepted by "dmsetup create --table".
+func (t *Table) String() string {
+	return fmt.Sprintf("0 %d verity %s", t.Length, t.Params)
+}
+
+// DMModCreate returns the dm-mod.create= kernel parameter for the table.
+func (t *Table) DMModCreate() string {
+	return fmt.Sprintf("dm-mod.create=\"%s,%s,%s,ro,%s\"", t.Name, t.UUID, t.Minor, t.String())
+}
+
+// ChromeOS returns the table in the Chrome OS dm= kernel parameter syntax.
+// Chrome OS only understands the original (format 0) layout with 4096 byte
+// blocks and no optional arguments.
+func (t *Table) ChromeOS() (string, error) {
+	a := t.args
+	if a.Version != 0 {
+		return "", fmt.Errorf("chrome os tables require hash format 0, have %d", a.Version)
+	}
+	if a.DataBlockSize != 4096 || a.HashBlockSize != 4096 {
+		return "", errors.New("chrome os tables require 4096 byte data and hash blocks")
+	}
+	if len(a.Flags) > 0 {
+		return "", errors.New("chrome os tables do not support optional arguments")
+	}
+
+	uuid := t.UUID
+	if uuid == "" {
+		uuid = "none"
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "dm=\"1 %s %s ro 1,0 %d verity payload=%s hashtree=%s hashstart=%d alg=%s root_hexdigest=%s",
+		t.Name, uuid, t.Length, a.DataDevice, a.HashDevice, a.HashStartBytes/diskSectorSize,
+		a.HashName, hex.EncodeToString(a.RootDigest))
+	if len(a.Salt) > 0 {
+		fmt.Fprintf(&b, " salt=%s", hex.EncodeToString(a.Salt))
+	}
+	b.WriteString("\"")
+	return b.String(), nil
+}
+
+// KernelTable is a verity device described by a Chrome OS or Android dm=
+// kernel parameter.
+type KernelTable struct {
+	Name   string
+	UUID   string
+	Params VerityParams
+	Args   dm.OpenArgs
+}
+
+// Chrome OS error_behavior= values mapped to dm-verity optional arguments.
+var chromeOSErrorBehavior = map[string]string{
+	"eio":    "",
+	"0":      "",
+	"notify": "",
+	"3":      "",
+	"panic":  "panic_on_corruption",
+	"1":      "panic_on_corruption",
+	"none":   "ignore_corruption",
+	"2":      "ignore_corruption",
+}
+
+// ParseKernelTable parses a dm= kernel parameter describing one read-only
+// verity device. s may be a whole kernel command line, the dm= parameter or
+// just its value. Both the Chrome OS key=value target arguments and the
+// positional dm-verity arguments used by Android are accepted. Device
+// references such as PARTUUID= are returned unresolved.
+func ParseKernelTable(s string) (*KernelTable, error) {
+	fields := strings.Fields(kernelDMParam(s))
+	if len(fields) > 0 {
+		if n, err := strconv.Atoi(fields[0]); err == nil {
+			if n != 1 {
+				return nil, fmt.Errorf("dm=: only one device is supported, got %d", n)
+			}
+			fields = fields[1:]
+		}
+	}
+	if len(fields) < 3 {
+		return nil, errors.New("dm=: expected <name> <uuid> <ro> <targets>")
+	}
+	kt := &KernelTable{Name: fields[0], UUID: fields[1]}
+	if kt.UUID == "none" {
+		kt.UUID = ""
+	}
+
+	rest := strings.Join(fields[2:], " ")
+	mode, targets, found := strings.Cut(rest, ",")
+	if !found {
+		return nil, errors.New("dm=: missing target table")
+	}
+	mode = strings.TrimSpace(mode)
+	// Newer syntax: "ro <num targets>,<table>"; older: "ro,<table>".
+	if m, count, ok := strings.Cut(mode, " "); ok {
+		if strings.TrimSpace(count) != "1" {
+			return nil, fmt.Errorf("dm=: only one target is supported, got %q", count)
+		}
+		mode = m
+	}
+	if mode != "ro" {
+		return nil, fmt.Errorf("dm=: verity devices must be read-only, got %q", mode)
+	}
+	if strings.Contains(targets, ",") {
+		return nil, errors.New("dm=: only one target is supported")
+	}
+
+	tf := strings.Fields(targets)
+	if len(tf) < 4 {
+		return nil, errors.New("dm=: expected <start> <length> verity <args>")
+	}
+	if tf[0] != "0" {
+		return nil, fmt.Errorf("dm=: target must start at sector 0, got %s", tf[0])
+	}
+	length, err := strconv.ParseUint(tf[1], 10, 64)
+	if err != nil || length == 0 {
+		return nil, fmt.Errorf("dm=: invalid target length %q", tf[1])
+	}
+	if tf[2] != "verity" {
+		return nil, fmt.Errorf("dm=: unsupported target type %q", tf[2])
+	}
+
+	if strings.Contains(tf[3], "=") {
+		kt.Args, err = parseChromeOSArgs(tf[3:], length)
+	} else {
+		kt.Args, err = dm.ParseTargetParams(strings.Join(tf[3:], " "))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("dm=: %w", err)
+	}
+
+	a := kt.Args
+	if _, err := HashSize(a.HashName); err != nil {
+		return nil, fmt.Errorf("dm=: unsupported hash algorithm %q", a.HashName)
+	}
+	if err := ValidateRootHashSize(a.RootDigest, a.HashName); err != nil {
+		return nil, fmt.Errorf("dm=: %w", err)
+	}
+	if !utils.IsBlockSizeValid(a.DataBlockSize) || !utils.IsBlockSizeValid(a.HashBlockSize) {
+		return nil, fmt.Errorf("dm=: invalid block sizes %d/%d", a.DataBlockSize, a.HashBlockSize)
+	}
+	if a.DataBlocks*uint64(a.DataBlockSize/diskSectorSize) != length {
+		return nil, fmt.Errorf("dm=: target length %d does not match %d data blocks", length, a.DataBlocks)
+	}
+	if len(a.Salt) > MaxSaltSize {
+		return nil, fmt.Errorf("dm=: salt size %d exceeds maximum of %d bytes", len(a.Salt), MaxSaltSize)
+	}
+
+	kt.Params = VerityParams{
+		HashName:       a.HashName,
+		DataBlockSize:  a.DataBlockSize,
+		HashBlockSize:  a.HashBlockSize,
+		DataBlocks:     a.DataBlocks,
+		HashType:       a.Version,
+		Salt:           a.Salt,
+		SaltSize:       uint16(len(a.Salt)),
+		HashAreaOffset: a.HashStartBytes,
+		NoSuperblock:   true,
+	}
+	return kt, nil
+}
+
+// kernelDMParam returns the value of the dm= parameter in s, or s itself
+// when it holds no dm= parameter.
+func kernelDMParam(s string) string {
+	s = strings.TrimSpace(s)
+	for _, prefix := range []string{`dm="`, `dm=`} {
+		i := strings.Index(s, prefix)
+		if i < 0 || (i > 0 && s[i-1] != ' ' && s[i-1] != '\t') {
+			continue
+		}
+		v := s[i+len(prefix):]
+		if prefix == `dm="` {
+			v, _, _ = strings.Cut(v, `"`)
+		}
+		return v
+	}
+	return strings.Trim(s, `"`)
+}
+
+// parseChromeOSArgs converts the Chrome OS key=value verity arguments. They
+// always describe a format 0 tree with 4096 byte blocks.
+func parseChromeOSArgs(args []string, length uint64) (dm.OpenArgs, error) {
+	a := dm.OpenArgs{
+		Version:       0,
+		DataBlockSize: 4096,
+		HashBlockSize: 4096,
+		DataBlocks:    length / (4096 / diskSectorSize),
+	}
+	hashStartSet := false
+	for _, arg := range args {
+		key, value, ok := strings.Cut(arg, "=")
+		if !ok {
+			return a, fmt.Errorf("malformed argument %q", arg)
+		}
+		switch key {
+		case "payload":
+			a.DataDevice = value
+		case "hashtree":
+			a.HashDevice = value
+		case "hashstart":
+			sectors, err := strconv.ParseUint(value, 10, 64)
+			if err != nil {
+				return a, fmt.Errorf("invalid hashstart %q", value)
+			}
+			a.HashStartBytes = sectors * diskSectorSize
+			hashStartSet = true
+		case "alg":
+			a.HashName = strings.ToLower(value)
+		case "root_hexdigest":
+			root, err := hex.DecodeString(value)
+			if err != nil {
+				return a, fmt.Errorf("invalid root_hexdigest %q", value)
+			}
+			a.RootDigest = root
+		case "salt":
+			salt, err := hex.DecodeString(value)
+			if err != nil {
+				return a, fmt.Errorf("invalid salt %q", value)
+			}
+			a.Salt = salt
+		case "error_behavior":
+			flag, known := chromeOSErrorBehavior[value]
+			if !known {
+				return a, fmt.Errorf("unsupported error_behavior %q", value)
+			}
+			if flag != "" {
+				a.Flags = append(a.Flags, flag)
+			}
+		default:
+			return a, fmt.Errorf("unsupported argument %q", key)
+		}
+	}
+
+	switch {
+	case a.DataDevice == "" || a.HashDevice == "":
+		return a, errors.New("payload= and hashtree= are required")
+	case a.HashName == "":
+		return a, errors.New("alg= is required")
+	case len(a.RootDigest) == 0:
+		return a, errors.New("root_hexdigest= is required")
+	case !hashStartSet:
+		return a, errors.New("hashstart= is required")
+	case length%(4096/diskSectorSize) != 0:
+		return a, fmt.Errorf("length %d is not a multiple of the 4096 byte block size", length)
+	case a.HashStartBytes%uint64(a.HashBlockSize) != 0:
+		return a, fmt.Errorf("hashstart %d is not aligned to the hash block size", a.HashStartBytes/diskSectorSize)
+	}
+	return a, nil
+}
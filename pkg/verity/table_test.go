@@ -0,0 +1,200 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package verity
+
+import (
+	"encoding/hex"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/containerd/go-dmverity/pkg/dm"
+)
+
+func TestVerityTable(t *testing.T) {
+	dataPath, _ := createTestDataFile(t, 4096, 16)
+	defer os.Remove(dataPath)
+	hashPath := createTestHashFile(t, 0)
+	defer os.Remove(hashPath)
+
+	salt := []byte{0x00, 0xff}
+	params := &VerityParams{
+		HashName:      "sha256",
+		DataBlockSize: 4096,
+		HashBlockSize: 4096,
+		DataBlocks:    16,
+		HashType:      0,
+		Salt:          salt,
+		SaltSize:      uint16(len(salt)),
+		NoSuperblock:  true,
+	}
+	rootHash, err := VerityCreate(params, dataPath, hashPath)
+	if err != nil {
+		t.Fatalf("VerityCreate failed: %v", err)
+	}
+	rootHex := hex.EncodeToString(rootHash)
+
+	tbl, err := VerityTable(params, "vroot", dataPath, hashPath, rootHash, TableOptions{UUID: "abc", Minor: "3"})
+	if err != nil {
+		t.Fatalf("VerityTable failed: %v", err)
+	}
+
+	wantLine := fmt.Sprintf("0 128 verity 0 %s %s 4096 4096 16 0 sha256 %s 00ff", dataPath, hashPath, rootHex)
+	if got := tbl.String(); got != wantLine {
+		t.Errorf("String() = %q, want %q", got, wantLine)
+	}
+
+	wantDMMod := fmt.Sprintf("dm-mod.create=\"vroot,abc,3,ro,%s\"", wantLine)
+	if got := tbl.DMModCreate(); got != wantDMMod {
+		t.Errorf("DMModCreate() = %q, want %q", got, wantDMMod)
+	}
+
+	chromeOS, err := tbl.ChromeOS()
+	if err != nil {
+		t.Fatalf("ChromeOS failed: %v", err)
+	}
+	wantChromeOS := fmt.Sprintf("dm=\"1 vroot abc ro 1,0 128 verity payload=%s hashtree=%s hashstart=0 alg=sha256 root_hexdigest=%s salt=00ff\"",
+		dataPath, hashPath, rootHex)
+	if chromeOS != wantChromeOS {
+		t.Errorf("ChromeOS() = %q, want %q", chromeOS, wantChromeOS)
+	}
+}
+
+func TestVerityTableErrors(t *testing.T) {
+	dataPath, _ := createTestDataFile(t, 4096, 16)
+	defer os.Remove(dataPath)
+	hashPath := createTestHashFile(t, 0)
+	defer os.Remove(hashPath)
+
+	params := DefaultVerityParams()
+	params.DataBlockSize = 4096
+	params.HashBlockSize = 4096
+	params.DataBlocks = 16
+	params.NoSuperblock = true
+	rootHash, err := VerityCreate(&params, dataPath, hashPath)
+	if err != nil {
+		t.Fatalf("VerityCreate failed: %v", err)
+	}
+
+	tbl, err := VerityTable(&params, "vroot", dataPath, hashPath, rootHash, TableOptions{})
+	if err != nil {
+		t.Fatalf("VerityTable failed: %v", err)
+	}
+	if _, err := tbl.ChromeOS(); err == nil {
+		t.Error("ChromeOS() should reject hash format 1")
+	}
+
+	if _, err := VerityTable(&params, "vroot", dataPath, hashPath, rootHash, TableOptions{DeviceFormat: DeviceFormatMajorMinor}); err == nil {
+		t.Error("major:minor format should reject regular files")
+	}
+	if _, err := VerityTable(&params, "vroot", dataPath, hashPath, rootHash, TableOptions{DeviceFormat: DeviceFormatPartUUID}); err == nil {
+		t.Error("PARTUUID format should reject regular files")
+	}
+	if _, err := VerityTable(&params, "v,root", dataPath, hashPath, rootHash, TableOptions{}); err == nil {
+		t.Error("names containing separators should be rejected")
+	}
+	if _, err := VerityTable(&params, "vroot", dataPath, hashPath, rootHash[:4], TableOptions{}); err == nil {
+		t.Error("short root hash should be rejected")
+	}
+}
+
+func TestParseKernelTable(t *testing.T) {
+	root := "ef" + strings.Repeat("00", 19)
+	tests := []struct {
+		name     string
+		cmdline  string
+		wantName string
+		wantData string
+		wantHash string
+		wantArgs func(a dm.OpenArgs) bool
+	}{
+		{
+			name: "chrome os",
+			cmdline: `cros_secure console= dm="1 vroot none ro 1,0 2048 verity payload=PARTUUID=%U/PARTNROFF=1 ` +
+				`hashtree=PARTUUID=%U/PARTNROFF=1 hashstart=2048 alg=sha1 root_hexdigest=` + root + ` salt=0a0b error_behavior=panic" noinitrd`,
+			wantName: "vroot",
+			wantData: "PARTUUID=%U/PARTNROFF=1",
+			wantHash: "PARTUUID=%U/PARTNROFF=1",
+			wantArgs: func(a dm.OpenArgs) bool {
+				return a.Version == 0 && a.DataBlocks == 256 && a.HashStartBytes == 2048*512 &&
+					a.HashName == "sha1" && hex.EncodeToString(a.Salt) == "0a0b" &&
+					reflect.DeepEqual(a.Flags, []string{"panic_on_corruption"})
+			},
+		},
+		{
+			name:     "old chrome os without device count",
+			cmdline:  `vroot none ro,0 2048 verity payload=/dev/sda3 hashtree=/dev/sda3 hashstart=2048 alg=sha1 root_hexdigest=` + root,
+			wantName: "vroot",
+			wantData: "/dev/sda3",
+			wantHash: "/dev/sda3",
+			wantArgs: func(a dm.OpenArgs) bool { return len(a.Salt) == 0 && a.HashBlockSize == 4096 },
+		},
+		{
+			name:     "android positional",
+			cmdline:  `dm="1 system none ro 1,0 2048 verity 1 PARTUUID=aaaa PARTUUID=aaaa 4096 4096 256 257 sha1 ` + root + ` 00ff"`,
+			wantName: "system",
+			wantData: "PARTUUID=aaaa",
+			wantHash: "PARTUUID=aaaa",
+			wantArgs: func(a dm.OpenArgs) bool { return a.Version == 1 && a.HashStartBytes == 257*4096 },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kt, err := ParseKernelTable(tt.cmdline)
+			if err != nil {
+				t.Fatalf("ParseKernelTable failed: %v", err)
+			}
+			if kt.Name != tt.wantName || kt.Args.DataDevice != tt.wantData || kt.Args.HashDevice != tt.wantHash {
+				t.Errorf("unexpected table: %+v", kt)
+			}
+			if !tt.wantArgs(kt.Args) {
+				t.Errorf("unexpected args: %+v", kt.Args)
+			}
+			p := kt.Params
+			if !p.NoSuperblock || p.HashAreaOffset != kt.Args.HashStartBytes || p.DataBlocks != kt.Args.DataBlocks ||
+				p.HashType != kt.Args.Version || int(p.SaltSize) != len(kt.Args.Salt) {
+				t.Errorf("params do not match args: %+v", p)
+			}
+		})
+	}
+}
+
+func TestParseKernelTableErrors(t *testing.T) {
+	root := "ef" + strings.Repeat("00", 19)
+	args := "payload=/dev/sda3 hashtree=/dev/sda3 hashstart=2048 alg=sha1 root_hexdigest=" + root
+	tests := map[string]string{
+		"two devices":      "2 vroot none ro 1,0 2048 verity " + args,
+		"read-write":       "1 vroot none rw 1,0 2048 verity " + args,
+		"two targets":      "1 vroot none ro 2,0 2048 verity " + args + ",2048 8 zero",
+		"not verity":       "1 vroot none ro 1,0 2048 linear /dev/sda3 0",
+		"missing hashtree": "1 vroot none ro 1,0 2048 verity payload=/dev/sda3 hashstart=2048 alg=sha1 root_hexdigest=" + root,
+		"unknown key":      "1 vroot none ro 1,0 2048 verity " + args + " frob=1",
+		"short root":       "1 vroot none ro 1,0 2048 verity payload=/dev/sda3 hashtree=/dev/sda3 hashstart=2048 alg=sha1 root_hexdigest=ef",
+		"length mismatch":  "1 vroot none ro 1,0 2048 verity 1 /dev/sda3 /dev/sda4 4096 4096 255 0 sha1 " + root + " -",
+	}
+
+	for name, s := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := ParseKernelTable(s); err == nil {
+				t.Error("expected error, got nil")
+			}
+		})
+	}
+}
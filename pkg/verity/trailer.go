@@ -0,0 +1,216 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package verity
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+
+	"github.com/containerd/go-dmverity/pkg/utils"
+)
+
+const (
+	TrailerMagic   = "vrtytail"
+	TrailerSize    = 512
+	trailerVersion = 1
+)
+
+var ErrNoTrailer = errors.New("verity: no verity trailer found")
+
+// Trailer is stored in the last TrailerSize bytes of a file formatted with
+// VerityCreateAppend. It records where the data ends and where the
+// superblock and hash tree start, so a single file and the root hash are
+// enough to open it.
+type Trailer struct {
+	DataSize   uint64
+	HashOffset uint64
+	HashSize   uint64
+}
+
+type trailerOnDisk struct {
+	Magic      [8]byte
+	Version    uint32
+	Flags      uint32
+	DataSize   uint64
+	HashOffset uint64
+	HashSize   uint64
+	Checksum   uint32
+}
+
+func (t *Trailer) MarshalBinary() ([]byte, error) {
+	d := trailerOnDisk{
+		Version:    trailerVersion,
+		DataSize:   t.DataSize,
+		HashOffset: t.HashOffset,
+		HashSize:   t.HashSize,
+	}
+	copy(d.Magic[:], TrailerMagic)
+
+	var buf bytes.Buffer
+	if err := binary.Write(&buf, binary.LittleEndian, &d); err != nil {
+		return nil, err
+	}
+	b := buf.Bytes()
+	binary.LittleEndian.PutUint32(b[len(b)-4:], crc32.ChecksumIEEE(b[:len(b)-4]))
+
+	out := make([]byte, TrailerSize)
+	copy(out, b)
+	return out, nil
+}
+
+func (t *Trailer) UnmarshalBinary(b []byte) error {
+	n := binary.Size(trailerOnDisk{})
+	if len(b) < n {
+		return ErrNoTrailer
+	}
+	var d trailerOnDisk
+	if err := binary.Read(bytes.NewReader(b[:n]), binary.LittleEndian, &d); err != nil {
+		return err
+	}
+	if string(d.Magic[:]) != TrailerMagic {
+		return ErrNoTrailer
+	}
+	if d.Version != trailerVersion {
+		return fmt.Errorf("verity: unsupported trailer version %d", d.Version)
+	}
+	if crc32.ChecksumIEEE(b[:n-4]) != d.Checksum {
+		return errors.New("verity: trailer checksum mismatch")
+	}
+	if d.HashOffset < d.DataSize {
+		return fmt.Errorf("verity: trailer hash offset %d overlaps data size %d", d.HashOffset, d.DataSize)
+	}
+
+	*t = Trailer{DataSize: d.DataSize, HashOffset: d.HashOffset, HashSize: d.HashSize}
+	return nil
+}
+
+// ReadTrailer reads the trailer from the end of r, which is size bytes long.
+func ReadTrailer(r io.ReaderAt, size int64) (*Trailer, error) {
+	if size < TrailerSize {
+		return nil, ErrNoTrailer
+	}
+	buf := make([]byte, TrailerSize)
+	if _, err := r.ReadAt(buf, size-TrailerSize); err != nil {
+		return nil, fmt.Errorf("verity: read trailer: %w", err)
+	}
+
+	t := &Trailer{}
+	if err := t.UnmarshalBinary(buf); err != nil {
+		return nil, err
+	}
+	if t.HashOffset+t.HashSize > uint64(size-TrailerSize) {
+		return nil, fmt.Errorf("verity: trailer describes %d bytes of hash data at %d beyond the end of the file",
+			t.HashSize, t.HashOffset)
+	}
+	return t, nil
+}
+
+// ReadTrailerFile reads the trailer of a file or block device.
+func ReadTrailerFile(path string) (*Trailer, error) {
+	size, err := utils.GetBlockOrFileSize(path)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadTrailer(f, size)
+}
+
+// VerityCreateAppend formats path in place: the data is zero padded to the
+// data block size, the superblock and hash tree are written right after it
+// (aligned to the hash block size) and a Trailer is written at the end of
+// the file. params.HashAreaOffset is updated to the start of the hash tree.
+func VerityCreateAppend(params *VerityParams, path string) ([]byte, *Trailer, error) {
+	if params == nil {
+		return nil, nil, errors.New("verity: nil params")
+	}
+	if params.NoSuperblock {
+		return nil, nil, errors.New("verity: appended hash trees require a superblock")
+	}
+	if !utils.IsBlockSizeValid(params.DataBlockSize) || !utils.IsBlockSizeValid(params.HashBlockSize) {
+		return nil, nil, fmt.Errorf("invalid block sizes %d/%d", params.DataBlockSize, params.HashBlockSize)
+	}
+
+	if _, err := ReadTrailerFile(path); err == nil {
+		return nil, nil, fmt.Errorf("%s already carries a verity trailer", path)
+	} else if !errors.Is(err, ErrNoTrailer) {
+		return nil, nil, err
+	}
+
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+
+	st, err := f.Stat()
+	if err != nil {
+		return nil, nil, err
+	}
+	if !st.Mode().IsRegular() {
+		return nil, nil, fmt.Errorf("%s is not a regular file", path)
+	}
+
+	dataSize := utils.AlignUp(uint64(st.Size()), uint64(params.DataBlockSize))
+	if dataSize == 0 {
+		return nil, nil, fmt.Errorf("%s is empty", path)
+	}
+	params.DataBlocks = dataSize / uint64(params.DataBlockSize)
+	sbOffset := utils.AlignUp(dataSize, uint64(params.HashBlockSize))
+	params.HashAreaOffset = sbOffset
+
+	treeSize, err := GetHashTreeSize(params)
+	if err != nil {
+		return nil, nil, err
+	}
+	treeStart := sbOffset + utils.AlignUp(uint64(VeritySuperblockSize), uint64(params.HashBlockSize))
+	t := &Trailer{
+		DataSize:   dataSize,
+		HashOffset: sbOffset,
+		HashSize:   treeStart - sbOffset + treeSize,
+	}
+
+	// Extend the file so the padding and the whole hash area read as zeros.
+	if err := f.Truncate(int64(sbOffset + t.HashSize)); err != nil {
+		return nil, nil, fmt.Errorf("extend %s: %w", path, err)
+	}
+
+	rootHash, err := VerityCreate(params, path, path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	raw, err := t.MarshalBinary()
+	if err != nil {
+		return nil, nil, err
+	}
+	if _, err := f.WriteAt(raw, int64(sbOffset+t.HashSize)); err != nil {
+		return nil, nil, fmt.Errorf("write trailer: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		return nil, nil, err
+	}
+	return rootHash, t, nil
+}
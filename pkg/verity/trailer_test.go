@@ -0,0 +1,101 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package verity
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestTrailerRoundTrip(t *testing.T) {
+	want := Trailer{DataSize: 65536, HashOffset: 65536, HashSize: 8192}
+	raw, err := want.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary failed: %v", err)
+	}
+	if len(raw) != TrailerSize {
+		t.Fatalf("trailer is %d bytes, want %d", len(raw), TrailerSize)
+	}
+
+	var got Trailer
+	if err := got.UnmarshalBinary(raw); err != nil {
+		t.Fatalf("UnmarshalBinary failed: %v", err)
+	}
+	if got != want {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+
+	raw[20] ^= 0xff
+	if err := got.UnmarshalBinary(raw); err == nil || errors.Is(err, ErrNoTrailer) {
+		t.Errorf("expected checksum error, got %v", err)
+	}
+	if err := got.UnmarshalBinary(make([]byte, TrailerSize)); !errors.Is(err, ErrNoTrailer) {
+		t.Errorf("expected ErrNoTrailer, got %v", err)
+	}
+}
+
+func TestVerityCreateAppend(t *testing.T) {
+	// 15.5 blocks of data: the last block is zero padded.
+	path, _ := createTestDataFile(t, 512, 124)
+	defer os.Remove(path)
+
+	params := DefaultVerityParams()
+	params.HashName = "sha256"
+	params.DataBlockSize = 4096
+	params.HashBlockSize = 4096
+	testUUID := uuid.New()
+	copy(params.UUID[:], testUUID[:])
+	rootHash, trailer, err := VerityCreateAppend(&params, path)
+	if err != nil {
+		t.Fatalf("VerityCreateAppend failed: %v", err)
+	}
+	if params.DataBlocks != 16 || trailer.DataSize != 16*4096 || trailer.HashOffset != 16*4096 {
+		t.Errorf("unexpected layout: %d data blocks, trailer %+v", params.DataBlocks, trailer)
+	}
+
+	got, err := ReadTrailerFile(path)
+	if err != nil {
+		t.Fatalf("ReadTrailerFile failed: %v", err)
+	}
+	if *got != *trailer {
+		t.Errorf("ReadTrailerFile = %+v, want %+v", got, trailer)
+	}
+
+	verifyParams := DefaultVerityParams()
+	verifyParams.HashAreaOffset = got.HashOffset
+	if err := VerityVerify(&verifyParams, path, path, rootHash); err != nil {
+		t.Errorf("VerityVerify failed: %v", err)
+	}
+
+	if _, _, err := VerityCreateAppend(&params, path); err == nil {
+		t.Error("expected error when appending to a file that already has a trailer")
+	}
+}
+
+func TestVerityCreateAppendNoSuperblock(t *testing.T) {
+	path, _ := createTestDataFile(t, 4096, 4)
+	defer os.Remove(path)
+
+	params := DefaultVerityParams()
+	params.NoSuperblock = true
+	if _, _, err := VerityCreateAppend(&params, path); err == nil {
+		t.Error("expected error without a superblock")
+	}
+}
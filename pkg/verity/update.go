@@ -0,0 +1,237 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package verity
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+)
+
+// UpdateOptions lists the data blocks VerityUpdate rehashes: Blocks, plus
+// every block that differs from the copy of the old data at OldData.
+type UpdateOptions struct {
+	Blocks  []uint64
+	OldData string
+}
+
+// UpdateResult is the outcome of VerityUpdate.
+type UpdateResult struct {
+	RootHash          HexBytes `json:"root_hash"`
+	ChangedBlocks     uint64   `json:"changed_blocks"`
+	HashBlocksWritten uint64   `json:"hash_blocks_written"`
+}
+
+// VerityUpdate rehashes the changed data blocks of dataDevice and the hash
+// blocks on their paths to the root, rewrites those hash blocks of
+// hashDevice in place and returns the new root hash. params must be
+// complete, as for VerityRebuild. The existing tree is first checked
+// against oldRoot, so as long as every changed block is listed the result
+// is the same as rebuilding the whole tree. The hash device is not updated
+// atomically; an interrupted update is repaired by rebuild-hash.
+func VerityUpdate(params *VerityParams, dataDevice, hashDevice string, oldRoot []byte, opts UpdateOptions) (*UpdateResult, error) {
+	if params == nil {
+		return nil, errors.New("verity: nil params")
+	}
+
+	vh, err := NewVerityHash(
+		params.HashName,
+		params.DataBlockSize, params.HashBlockSize,
+		params.DataBlocks,
+		params.HashType,
+		params.Salt,
+		params.HashAreaOffset,
+		dataDevice, hashDevice,
+		oldRoot,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateParams(params, vh.hashFunc.Size()); err != nil {
+		return nil, err
+	}
+	if len(oldRoot) != vh.hashFunc.Size() {
+		return nil, fmt.Errorf("root hash is %d bytes, %s needs %d", len(oldRoot), params.HashName, vh.hashFunc.Size())
+	}
+
+	blocks := slices.Clone(opts.Blocks)
+	for _, b := range blocks {
+		if b >= params.DataBlocks {
+			return nil, fmt.Errorf("block %d out of range: device has %d data blocks", b, params.DataBlocks)
+		}
+	}
+	if opts.OldData != "" {
+		changed, err := vh.changedBlocks(opts.OldData)
+		if err != nil {
+			return nil, err
+		}
+		blocks = append(blocks, changed...)
+	}
+	slices.Sort(blocks)
+	blocks = slices.Compact(blocks)
+
+	if err := vh.CheckHashTree(); err != nil {
+		return nil, fmt.Errorf("existing hash tree: %w; hash device left unchanged", err)
+	}
+
+	res := &UpdateResult{RootHash: bytes.Clone(oldRoot), ChangedBlocks: uint64(len(blocks))}
+	if len(blocks) == 0 {
+		return res, nil
+	}
+	if res.HashBlocksWritten, err = vh.updateBlocks(blocks); err != nil {
+		return nil, err
+	}
+	res.RootHash = bytes.Clone(vh.rootHash)
+	return res, nil
+}
+
+// changedBlocks returns the data blocks of vh.dataDevice that differ from
+// those of oldData.
+func (vh *VerityHash) changedBlocks(oldData string) ([]uint64, error) {
+	oldFile, err := os.Open(oldData)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open old data %s: %w", oldData, err)
+	}
+	defer oldFile.Close()
+	dataFile, err := os.Open(vh.dataDevice)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open data device %s: %w", vh.dataDevice, err)
+	}
+	defer dataFile.Close()
+
+	bs := uint64(vh.dataBlockSize)
+	chunkBlocks := max(1, ioChunkSize/bs)
+	oldBuf := make([]byte, chunkBlocks*bs)
+	newBuf := make([]byte, chunkBlocks*bs)
+
+	var changed []uint64
+	for done := uint64(0); done < vh.dataBlocks; {
+		n := min(chunkBlocks, vh.dataBlocks-done)
+		size := n * bs
+		if err := readFullAt(oldFile, oldBuf[:size], int64(done*bs)); err != nil {
+			return nil, fmt.Errorf("cannot read old data block: %w", err)
+		}
+		if err := readFullAt(dataFile, newBuf[:size], int64(done*bs)); err != nil {
+			return nil, fmt.Errorf("cannot read data block: %w", err)
+		}
+		for b := uint64(0); b < n; b++ {
+			if !bytes.Equal(oldBuf[b*bs:(b+1)*bs], newBuf[b*bs:(b+1)*bs]) {
+				changed = append(changed, done+b)
+			}
+		}
+		done += n
+	}
+	return changed, nil
+}
+
+// updateBlocks rewrites the digests of the sorted data blocks and of every
+// hash block above them, level by level, and leaves the new root hash in
+// vh.rootHash. It returns the number of hash blocks written.
+func (vh *VerityHash) updateBlocks(blocks []uint64) (uint64, error) {
+	levels, err := vh.hashLevels(vh.dataBlocks)
+	if err != nil {
+		return 0, fmt.Errorf("failed to calculate hash levels: %w", err)
+	}
+
+	dataFile, err := os.Open(vh.dataDevice)
+	if err != nil {
+		return 0, fmt.Errorf("cannot open data device %s: %w", vh.dataDevice, err)
+	}
+	defer dataFile.Close()
+	hashFile, err := os.OpenFile(vh.hashDevice, os.O_RDWR, 0)
+	if err != nil {
+		return 0, fmt.Errorf("cannot open hash device %s: %w", vh.hashDevice, err)
+	}
+	defer hashFile.Close()
+
+	digestSize := uint64(vh.hashFunc.Size())
+	hashPerBlock := uint64(1) << getBitsDown(vh.hashBlockSize/uint32(digestSize))
+	entrySize := uint64(vh.getDigestSizeFull(uint32(digestSize)))
+	hbs := uint64(vh.hashBlockSize)
+
+	h := vh.hashFunc.New()
+	child := make([]byte, max(vh.dataBlockSize, vh.hashBlockSize))
+	hashBlock := make([]byte, hbs)
+	digest := make([]byte, 0, digestSize)
+
+	if len(levels) == 0 {
+		child = child[:vh.dataBlockSize]
+		if err := readFullAt(dataFile, child, 0); err != nil {
+			return 0, fmt.Errorf("cannot read data block: %w", err)
+		}
+		var err error
+		vh.rootHash, err = vh.digestInto(h, child, nil)
+		return 0, err
+	}
+
+	var written uint64
+	dirty := blocks
+	for i, level := range levels {
+		src, srcOffset, srcSize := dataFile, uint64(0), uint64(vh.dataBlockSize)
+		if i > 0 {
+			src, srcOffset, srcSize = hashFile, levels[i-1].offset, hbs
+		}
+		child = child[:srcSize]
+
+		var parents []uint64
+		for j := 0; j < len(dirty); {
+			parent := dirty[j] / hashPerBlock
+			offset := level.offset + parent*hbs
+			if err := readFullAt(hashFile, hashBlock, int64(offset)); err != nil {
+				return written, fmt.Errorf("cannot read level %d hash block: %w", i, err)
+			}
+			for ; j < len(dirty) && dirty[j]/hashPerBlock == parent; j++ {
+				idx := dirty[j]
+				if err := readFullAt(src, child, int64(srcOffset+idx*srcSize)); err != nil {
+					return written, fmt.Errorf("cannot read block %d below level %d: %w", idx, i, err)
+				}
+				var err error
+				if digest, err = vh.digestInto(h, child, digest[:0]); err != nil {
+					return written, err
+				}
+				copy(hashBlock[(idx%hashPerBlock)*entrySize:], digest)
+			}
+			if _, err := hashFile.WriteAt(hashBlock, int64(offset)); err != nil {
+				return written, fmt.Errorf("cannot write digest to hash device: %w", err)
+			}
+			written++
+			parents = append(parents, parent)
+		}
+		dirty = parents
+	}
+
+	// The root is computed as upperLevels does for a full build.
+	top := levels[len(levels)-1]
+	root := make([]byte, digestSize)
+	err = vh.createOrVerify(
+		hashFile, nil,
+		top.offset, vh.hashBlockSize,
+		0, vh.hashBlockSize,
+		top.numBlocks, make([]byte, vh.hashBlockSize),
+		false, root,
+	)
+	if err != nil {
+		return written, err
+	}
+	if err := hashFile.Sync(); err != nil {
+		return written, err
+	}
+	vh.rootHash = root
+	return written, nil
+}
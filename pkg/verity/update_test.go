@@ -0,0 +1,145 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package verity
+
+import (
+	"bytes"
+	"os"
+	"testing"
+)
+
+func TestVerityUpdate(t *testing.T) {
+	tests := []struct {
+		name          string
+		dataBlockSize uint32
+		hashBlockSize uint32
+		dataBlocks    uint64
+		hashType      uint32
+		noSuperblock  bool
+		changed       []uint64
+	}{
+		{"superblock", 4096, 4096, 300, 1, false, []uint64{0, 7, 128, 129, 299}},
+		{"512B blocks", 512, 512, 8192, 1, true, []uint64{1, 2, 3, 4000, 8191}},
+		{"format 0", 4096, 1024, 100, 0, true, []uint64{50}},
+		{"single block", 4096, 4096, 1, 1, true, []uint64{0}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			dataPath, data := createTestDataFile(t, tc.dataBlockSize, tc.dataBlocks)
+			defer os.Remove(dataPath)
+			oldData := append([]byte(nil), data...)
+
+			create := func() (string, []byte) {
+				hashPath := createTestHashFile(t, 0)
+				params := DefaultVerityParams()
+				params.DataBlockSize = tc.dataBlockSize
+				params.HashBlockSize = tc.hashBlockSize
+				params.DataBlocks = tc.dataBlocks
+				params.HashType = tc.hashType
+				params.NoSuperblock = tc.noSuperblock
+				if !tc.noSuperblock {
+					params.HashAreaOffset = uint64(tc.hashBlockSize)
+				}
+				params.Salt = []byte{0x01, 0x02, 0x03}
+				params.SaltSize = 3
+				params.UUID = [16]byte{0x12, 0x34, 0x56, 0x78}
+				rootHash, err := VerityCreate(&params, dataPath, hashPath)
+				if err != nil {
+					t.Fatalf("VerityCreate failed: %v", err)
+				}
+				return hashPath, rootHash
+			}
+
+			hashPath, oldRoot := create()
+			defer os.Remove(hashPath)
+			params := DefaultVerityParams()
+			params.NoSuperblock = tc.noSuperblock
+			if tc.noSuperblock {
+				params.DataBlockSize = tc.dataBlockSize
+				params.HashBlockSize = tc.hashBlockSize
+				params.DataBlocks = tc.dataBlocks
+				params.HashType = tc.hashType
+				params.Salt = []byte{0x01, 0x02, 0x03}
+				params.SaltSize = 3
+			} else if err := InitParams(&params, dataPath, hashPath); err != nil {
+				t.Fatalf("InitParams failed: %v", err)
+			}
+			oldHash, err := os.ReadFile(hashPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, b := range tc.changed {
+				data[uint64(tc.dataBlockSize)*b] ^= 0xff
+			}
+			if err := os.WriteFile(dataPath, data, 0o644); err != nil {
+				t.Fatal(err)
+			}
+			wantHash, wantRoot := create()
+			defer os.Remove(wantHash)
+			want, err := os.ReadFile(wantHash)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			check := func(res *UpdateResult, err error) {
+				t.Helper()
+				if err != nil {
+					t.Fatalf("VerityUpdate failed: %v", err)
+				}
+				if !bytes.Equal(res.RootHash, wantRoot) {
+					t.Errorf("root hash %x, want %x from a full build", res.RootHash, wantRoot)
+				}
+				if res.ChangedBlocks != uint64(len(tc.changed)) {
+					t.Errorf("changed blocks %d, want %d", res.ChangedBlocks, len(tc.changed))
+				}
+				got, err := os.ReadFile(hashPath)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(got, want) {
+					t.Error("updated hash device differs from a full build")
+				}
+			}
+
+			// Listed blocks, in any order and with duplicates.
+			blocks := append([]uint64{tc.changed[len(tc.changed)-1]}, tc.changed...)
+			check(VerityUpdate(&params, dataPath, hashPath, oldRoot, UpdateOptions{Blocks: blocks}))
+
+			// The old tree no longer matches the old root.
+			if _, err := VerityUpdate(&params, dataPath, hashPath, oldRoot, UpdateOptions{Blocks: tc.changed}); err == nil && tc.dataBlocks > 1 {
+				t.Error("expected the old root to be rejected after the update")
+			}
+
+			// Blocks found by comparing with the old data.
+			if err := os.WriteFile(hashPath, oldHash, 0o644); err != nil {
+				t.Fatal(err)
+			}
+			oldPath := createTestHashFile(t, 0)
+			defer os.Remove(oldPath)
+			if err := os.WriteFile(oldPath, oldData, 0o644); err != nil {
+				t.Fatal(err)
+			}
+			check(VerityUpdate(&params, dataPath, hashPath, oldRoot, UpdateOptions{OldData: oldPath}))
+
+			if _, err := VerityUpdate(&params, dataPath, hashPath, wantRoot, UpdateOptions{Blocks: []uint64{tc.dataBlocks}}); err == nil {
+				t.Error("expected an out of range block to be rejected")
+			}
+		})
+	}
+}
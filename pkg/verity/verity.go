@@ -18,7 +18,6 @@ package verity
 
 import (
 	"bytes"
-	"crypto"
 	"errors"
 	"fmt"
 	"log"
@@ -89,29 +88,11 @@ func VerityVerify(params *VerityParams, dataDevice, hashDevice string, rootHash
 		return errors.New("verity: nil params")
 	}
 
-	if !params.NoSuperblock {
-		hashFile, err := os.Open(hashDevice)
-		if err != nil {
-			return fmt.Errorf("cannot open hash device: %w", err)
-		}
-		defer hashFile.Close()
-
-		sbOffset := uint64(0)
-		if dataDevice == hashDevice && params.HashAreaOffset > 0 {
-			sbOffset = params.HashAreaOffset
-		}
-
-		sb, err := ReadSuperblock(hashFile, sbOffset)
-		if err != nil {
-			return err
-		}
-
-		if err := adoptParamsFromSuperblock(params, sb, sbOffset); err != nil {
-			return err
-		}
+	if err := readSuperblockParams(params, dataDevice, hashDevice); err != nil {
+		return err
 	}
 
-	vh := NewVerityHash(
+	vh, err := NewVerityHash(
 		params.HashName,
 		params.DataBlockSize, params.HashBlockSize,
 		params.DataBlocks,
@@ -121,47 +102,65 @@ func VerityVerify(params *VerityParams, dataDevice, hashDevice string, rootHash
 		dataDevice, hashDevice,
 		rootHash,
 	)
+	if err != nil {
+		return err
+	}
+	vh.directIO = params.DirectIO
+	vh.limiter = newIOLimiter(params.MaxBytesPerSec, params.MaxIOPS)
 
 	if err := validateParams(params, vh.hashFunc.Size()); err != nil {
 		return err
 	}
 
-	return vh.CreateOrVerifyHashTree(true)
+	if params.CheckpointFile != "" {
+		if vh.checkpoint, err = loadCheckpoint(params, dataDevice, hashDevice, rootHash); err != nil {
+			return err
+		}
+	}
+
+	if err := vh.CreateOrVerifyHashTree(true); err != nil {
+		return err
+	}
+	return vh.checkpoint.remove()
 }
 
-func VerityCreate(params *VerityParams, dataDevice, hashDevice string) ([]byte, error) {
-	if params == nil {
-		return nil, errors.New("verity: nil params")
+// readSuperblockParams fills params from the superblock of hashDevice unless
+// params.NoSuperblock is set. When data and hash share a device, the
+// superblock is at params.HashAreaOffset.
+func readSuperblockParams(params *VerityParams, dataDevice, hashDevice string) error {
+	if params.NoSuperblock {
+		return nil
 	}
 
-	var sbOffset uint64
-	if !params.NoSuperblock {
-		sb, err := buildSuperblockFromParams(params)
-		if err != nil {
-			return nil, err
-		}
+	hashFile, err := os.Open(hashDevice)
+	if err != nil {
+		return fmt.Errorf("cannot open hash device: %w", err)
+	}
+	defer hashFile.Close()
 
-		openFlags := os.O_RDWR | os.O_CREATE
-		if dataDevice == hashDevice {
-			sbOffset = params.HashAreaOffset
-			params.HashAreaOffset = sbOffset + utils.AlignUp(uint64(VeritySuperblockSize), uint64(params.HashBlockSize))
-		} else {
-			openFlags |= os.O_TRUNC
-			sbOffset = 0
-		}
+	sbOffset := uint64(0)
+	if dataDevice == hashDevice && params.HashAreaOffset > 0 {
+		sbOffset = params.HashAreaOffset
+	}
 
-		hashFile, err := os.OpenFile(hashDevice, openFlags, 0644)
-		if err != nil {
-			return nil, fmt.Errorf("cannot open or create hash device: %w", err)
-		}
-		defer hashFile.Close()
+	sb, err := ReadSuperblock(hashFile, sbOffset)
+	if err != nil {
+		return err
+	}
 
-		if err := sb.WriteSuperblock(hashFile, sbOffset); err != nil {
-			return nil, err
-		}
+	return adoptParamsFromSuperblock(params, sb, sbOffset)
+}
+
+func VerityCreate(params *VerityParams, dataDevice, hashDevice string) ([]byte, error) {
+	if params == nil {
+		return nil, errors.New("verity: nil params")
+	}
+
+	if err := writeSuperblockFor(params, dataDevice, hashDevice); err != nil {
+		return nil, err
 	}
 
-	vh := NewVerityHash(
+	vh, err := NewVerityHash(
 		params.HashName,
 		params.DataBlockSize, params.HashBlockSize,
 		params.DataBlocks,
@@ -171,6 +170,10 @@ func VerityCreate(params *VerityParams, dataDevice, hashDevice string) ([]byte,
 		dataDevice, hashDevice,
 		nil,
 	)
+	if err != nil {
+		return nil, err
+	}
+	vh.directIO = params.DirectIO
 
 	if err := validateParams(params, vh.hashFunc.Size()); err != nil {
 		return nil, err
@@ -183,20 +186,46 @@ func VerityCreate(params *VerityParams, dataDevice, hashDevice string) ([]byte,
 	return vh.RootHash(), nil
 }
 
+// writeSuperblockFor writes the superblock of params to hashDevice unless
+// params.NoSuperblock is set. A separate hash device is truncated first; on
+// a shared device the superblock goes at params.HashAreaOffset, which is
+// moved past it.
+func writeSuperblockFor(params *VerityParams, dataDevice, hashDevice string) error {
+	if params.NoSuperblock {
+		return nil
+	}
+
+	sb, err := buildSuperblockFromParams(params)
+	if err != nil {
+		return err
+	}
+
+	var sbOffset uint64
+	openFlags := os.O_RDWR | os.O_CREATE
+	if dataDevice == hashDevice {
+		sbOffset = params.HashAreaOffset
+		params.HashAreaOffset = sbOffset + utils.AlignUp(uint64(VeritySuperblockSize), uint64(params.HashBlockSize))
+	} else {
+		openFlags |= os.O_TRUNC
+	}
+
+	hashFile, err := os.OpenFile(hashDevice, openFlags, 0644)
+	if err != nil {
+		return fmt.Errorf("cannot open or create hash device: %w", err)
+	}
+	defer hashFile.Close()
+
+	return sb.WriteSuperblock(hashFile, sbOffset)
+}
+
 func VerifyBlock(params *VerityParams, hashName string, data, salt, expectedHash []byte) error {
+	hashFunc, err := lookupHash(hashName)
+	if err != nil {
+		return err
+	}
 	vh := &VerityHash{
 		hashType: params.HashType,
-		hashFunc: func() crypto.Hash {
-			hashMap := map[string]crypto.Hash{
-				"sha256": crypto.SHA256,
-				"sha512": crypto.SHA512,
-				"sha1":   crypto.SHA1,
-			}
-			if h, ok := hashMap[hashName]; ok && h.Available() {
-				return h
-			}
-			return crypto.SHA256
-		}(),
+		hashFunc: hashFunc,
 	}
 
 	calculatedHash, err := vh.verifyHashBlock(data, salt)
@@ -257,57 +286,27 @@ func InitParams(params *VerityParams, dataLoop, hashLoop string) error {
 }
 
 func DumpDevice(hashPath string) (string, error) {
-	hashFile, err := os.Open(hashPath)
-	if err != nil {
-		return "", fmt.Errorf("cannot open hash device: %w", err)
-	}
-	defer hashFile.Close()
+	return DumpDeviceAt(hashPath, 0)
+}
 
-	params := &VerityParams{}
-	superblock, err := ReadSuperblock(hashFile, 0)
+// DumpDeviceAt is like DumpDevice for a superblock stored at sbOffset, as in
+// files formatted with VerityCreateAppend.
+func DumpDeviceAt(hashPath string, sbOffset uint64) (string, error) {
+	info, err := DumpDeviceInfoAt(hashPath, sbOffset)
 	if err != nil {
-		return "", fmt.Errorf("failed to read superblock: %w", err)
-	}
-
-	if err := adoptParamsFromSuperblock(params, superblock, 0); err != nil {
-		return "", fmt.Errorf("failed to adopt params from superblock: %w", err)
+		return "", err
 	}
+	return info.String(), nil
+}
 
-	uuidStr, err := superblock.UUIDString()
+// DumpParams formats params the way DumpDevice formats a superblock, for
+// hash devices described by a Manifest.
+func DumpParams(hashPath string, params *VerityParams) (string, error) {
+	info, err := ParamsInfo(hashPath, params)
 	if err != nil {
-		return "", fmt.Errorf("failed to get UUID string: %w", err)
-	}
-
-	digestSize := utils.SelectHashSize(params.HashName)
-	if digestSize <= 0 {
-		return "", fmt.Errorf("unsupported hash algorithm: %s", params.HashName)
-	}
-
-	hashPerBlock := params.HashBlockSize / uint32(digestSize)
-	hashBlocks := (params.DataBlocks + uint64(hashPerBlock) - 1) / uint64(hashPerBlock)
-
-	deviceSizeBytes := params.HashAreaOffset + hashBlocks*uint64(params.HashBlockSize)
-
-	var sb strings.Builder
-	sb.WriteString(fmt.Sprintf("\nVERITY header information for %s\n", hashPath))
-	sb.WriteString(fmt.Sprintf("UUID:            \t%s\n", uuidStr))
-	sb.WriteString(fmt.Sprintf("Hash type:       \t%d\n", params.HashType))
-	sb.WriteString(fmt.Sprintf("Data blocks:     \t%d\n", params.DataBlocks))
-	sb.WriteString(fmt.Sprintf("Data block size: \t%d\n", params.DataBlockSize))
-	sb.WriteString(fmt.Sprintf("Hash blocks:     \t%d\n", hashBlocks))
-	sb.WriteString(fmt.Sprintf("Hash block size: \t%d\n", params.HashBlockSize))
-	sb.WriteString(fmt.Sprintf("Hash algorithm:  \t%s\n", params.HashName))
-
-	sb.WriteString("Salt:            \t")
-	if params.SaltSize > 0 {
-		sb.WriteString(fmt.Sprintf("%x\n", params.Salt[:params.SaltSize]))
-	} else {
-		sb.WriteString("-\n")
+		return "", err
 	}
-
-	sb.WriteString(fmt.Sprintf("Hash device size: \t%d [bytes]\n", deviceSizeBytes))
-
-	return sb.String(), nil
+	return info.String(), nil
 }
 
 func GetHashTreeSize(params *VerityParams) (uint64, error) {
@@ -319,7 +318,7 @@ func GetHashTreeSize(params *VerityParams) (uint64, error) {
 		return 0, errors.New("data blocks must be greater than 0")
 	}
 
-	vh := NewVerityHash(
+	vh, err := NewVerityHash(
 		params.HashName,
 		params.DataBlockSize, params.HashBlockSize,
 		params.DataBlocks,
@@ -329,6 +328,9 @@ func GetHashTreeSize(params *VerityParams) (uint64, error) {
 		"", "",
 		nil,
 	)
+	if err != nil {
+		return 0, err
+	}
 
 	return vh.GetHashTreeSize()
 }
@@ -350,7 +352,7 @@ func VerityOpen(params *VerityParams, name, dataDevice, hashDevice string, rootH
 		return "", fmt.Errorf("InitParams failed: %w", err)
 	}
 
-	if err := utils.ValidateRootHashSize(rootHash, params.HashName); err != nil {
+	if err := ValidateRootHashSize(rootHash, params.HashName); err != nil {
 		return "", err
 	}
 
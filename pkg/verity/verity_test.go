@@ -40,17 +40,25 @@ func TestGetHashSize(t *testing.T) {
 		{"sha1", "sha1", 20},
 		{"sha256", "sha256", 32},
 		{"sha512", "sha512", 64},
+		{"sha224", "sha224", 28},
+		{"sha384", "sha384", 48},
+		{"sha3-256", "sha3-256", 32},
+		{"blake2b-256", "blake2b-256", 32},
+		{"blake2b-160", "blake2b-160", 20},
 		{"SHA256 uppercase", "SHA256", 32},
 		{"sha256 with spaces", "  sha256  ", 32},
-		{"unsupported", "md5", -1},
+		{"unsupported", "no-such-hash", -1},
 		{"empty", "", -1},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result := utils.SelectHashSize(tt.hashName)
+			result, err := HashSize(tt.hashName)
+			if err != nil {
+				result = -1
+			}
 			if result != tt.expected {
-				t.Errorf("SelectHashSize(%q) = %d, want %d", tt.hashName, result, tt.expected)
+				t.Errorf("HashSize(%q) = %d, want %d", tt.hashName, result, tt.expected)
 			}
 		})
 	}
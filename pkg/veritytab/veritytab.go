@@ -0,0 +1,362 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package veritytab
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"github.com/containerd/go-dmverity/pkg/dm"
+	"github.com/containerd/go-dmverity/pkg/gpt"
+	"github.com/containerd/go-dmverity/pkg/utils"
+	"github.com/containerd/go-dmverity/pkg/verity"
+)
+
+const (
+	DefaultPath    = "/etc/veritytab"
+	ProcCmdline    = "/proc/cmdline"
+	PartUUIDDir    = "/dev/disk/by-partuuid/"
+	maxLineColumns = 5
+)
+
+// Entry describes one verity device to activate.
+type Entry struct {
+	Name          string
+	DataDevice    string
+	HashDevice    string
+	RootHash      []byte
+	Params        verity.VerityParams
+	Flags         []string
+	SignatureFile string
+	NoAuto        bool
+	NoFail        bool
+}
+
+// dm-verity optional arguments keyed by their veritytab option name.
+var corruptionFlags = map[string]string{
+	"ignore-corruption":     "ignore_corruption",
+	"restart-on-corruption": "restart_on_corruption",
+	"panic-on-corruption":   "panic_on_corruption",
+	"ignore-zero-blocks":    "ignore_zero_blocks",
+	"check-at-most-once":    "check_at_most_once",
+}
+
+func ParseFile(path string) ([]Entry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Parse(f)
+}
+
+// Parse reads veritytab(5) lines of the form
+// "name data-device hash-device roothash [options]".
+func Parse(r io.Reader) ([]Entry, error) {
+	var entries []Entry
+	seen := map[string]bool{}
+
+	sc := bufio.NewScanner(r)
+	lineNo := 0
+	for sc.Scan() {
+		lineNo++
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) < 4 || len(fields) > maxLineColumns {
+			return nil, fmt.Errorf("veritytab line %d: expected 4 or 5 fields, got %d", lineNo, len(fields))
+		}
+
+		options := ""
+		if len(fields) == maxLineColumns {
+			options = fields[4]
+		}
+		e, err := newEntry(fields[0], fields[1], fields[2], fields[3], options)
+		if err != nil {
+			return nil, fmt.Errorf("veritytab line %d: %w", lineNo, err)
+		}
+		if seen[e.Name] {
+			return nil, fmt.Errorf("veritytab line %d: duplicate device name %q", lineNo, e.Name)
+		}
+		seen[e.Name] = true
+		entries = append(entries, *e)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("read veritytab: %w", err)
+	}
+	return entries, nil
+}
+
+// ParseCmdline extracts the root and usr devices described by the systemd
+// roothash=, usrhash= and systemd.verity_* kernel command line parameters.
+// Like systemd, devices that are not given are the partitions whose UUIDs
+// are the first and last 128 bits of the root hash.
+func ParseCmdline(cmdline string) ([]Entry, error) {
+	type target struct {
+		hash, data, hashDev, options string
+	}
+	targets := map[string]*target{"root": {}, "usr": {}}
+	enabled := true
+
+	for _, word := range splitCmdline(cmdline) {
+		key, value, _ := strings.Cut(word, "=")
+		switch key {
+		case "systemd.verity":
+			b, err := parseBool(value)
+			if err != nil {
+				return nil, fmt.Errorf("systemd.verity: %w", err)
+			}
+			enabled = b
+		case "roothash":
+			targets["root"].hash = value
+		case "usrhash":
+			targets["usr"].hash = value
+		case "systemd.verity_root_data":
+			targets["root"].data = value
+		case "systemd.verity_root_hash":
+			targets["root"].hashDev = value
+		case "systemd.verity_root_options":
+			targets["root"].options = value
+		case "systemd.verity_usr_data":
+			targets["usr"].data = value
+		case "systemd.verity_usr_hash":
+			targets["usr"].hashDev = value
+		case "systemd.verity_usr_options":
+			targets["usr"].options = value
+		}
+	}
+	if !enabled {
+		return nil, nil
+	}
+
+	var entries []Entry
+	for _, name := range []string{"root", "usr"} {
+		tgt := targets[name]
+		if tgt.hash == "" {
+			continue
+		}
+		if tgt.data == "" || tgt.hashDev == "" {
+			root, err := utils.ParseRootHash(tgt.hash)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", name, err)
+			}
+			dataUUID, hashUUID, err := gpt.PartitionUUIDsFromRootHash(root)
+			if err != nil {
+				return nil, fmt.Errorf("%s: without systemd.verity_%s_data= and systemd.verity_%s_hash=: %w", name, name, name, err)
+			}
+			if tgt.data == "" {
+				tgt.data = PartUUIDDir + dataUUID.String()
+			}
+			if tgt.hashDev == "" {
+				tgt.hashDev = PartUUIDDir + hashUUID.String()
+			}
+		}
+		e, err := newEntry(name, tgt.data, tgt.hashDev, tgt.hash, tgt.options)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		entries = append(entries, *e)
+	}
+	return entries, nil
+}
+
+func ReadProcCmdline() ([]Entry, error) {
+	b, err := os.ReadFile(ProcCmdline)
+	if err != nil {
+		return nil, err
+	}
+	return ParseCmdline(string(b))
+}
+
+func newEntry(name, data, hash, rootHex, options string) (*Entry, error) {
+	if name == "" || strings.Contains(name, "/") || len(name) >= dm.DMNameLen {
+		return nil, fmt.Errorf("invalid device name %q", name)
+	}
+	root, err := utils.ParseRootHash(rootHex)
+	if err != nil {
+		return nil, err
+	}
+
+	e := &Entry{
+		Name:       name,
+		DataDevice: data,
+		HashDevice: hash,
+		RootHash:   root,
+	}
+	if err := e.applyOptions(options); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+func (e *Entry) applyOptions(options string) error {
+	superblock := true
+	hashSet := false
+	p := verity.DefaultVerityParams()
+	var dataBlockSize, hashBlockSize uint64
+
+	if options != "" && options != "-" {
+		for _, opt := range strings.Split(options, ",") {
+			key, value, hasValue := strings.Cut(strings.TrimSpace(opt), "=")
+			var err error
+			switch key {
+			case "":
+				continue
+			case "superblock":
+				superblock, err = parseBool(value)
+			case "format":
+				var v uint64
+				v, err = strconv.ParseUint(value, 10, 32)
+				p.HashType = uint32(v)
+			case "data-block-size":
+				dataBlockSize, err = strconv.ParseUint(value, 10, 32)
+			case "hash-block-size":
+				hashBlockSize, err = strconv.ParseUint(value, 10, 32)
+			case "data-blocks":
+				p.DataBlocks, err = strconv.ParseUint(value, 10, 64)
+			case "hash-offset":
+				p.HashAreaOffset, err = strconv.ParseUint(value, 10, 64)
+			case "hash":
+				p.HashName = strings.ToLower(value)
+				hashSet = true
+			case "salt":
+				p.Salt, p.SaltSize, err = utils.ApplySalt(value, verity.MaxSaltSize)
+			case "uuid":
+				var u uuid.UUID
+				u, err = uuid.Parse(value)
+				p.UUID = u
+			case "root-hash-signature":
+				e.SignatureFile = value
+			case "noauto":
+				e.NoAuto = true
+			case "nofail":
+				e.NoFail = true
+			case "_netdev":
+			default:
+				flag, ok := corruptionFlags[key]
+				if !ok || hasValue {
+					if strings.HasPrefix(key, "x-") {
+						continue
+					}
+					return fmt.Errorf("unsupported option %q", opt)
+				}
+				e.Flags = append(e.Flags, flag)
+			}
+			if err != nil {
+				return fmt.Errorf("option %q: %w", opt, err)
+			}
+			if requiresValue(key) && !hasValue {
+				return fmt.Errorf("option %q requires a value", key)
+			}
+		}
+	}
+
+	for _, size := range []uint64{dataBlockSize, hashBlockSize} {
+		if size != 0 && !utils.IsBlockSizeValid(uint32(size)) {
+			return fmt.Errorf("invalid block size %d", size)
+		}
+	}
+	p.DataBlockSize = uint32(dataBlockSize)
+	p.HashBlockSize = uint32(hashBlockSize)
+	p.NoSuperblock = !superblock
+
+	if superblock {
+		// Parameters come from the on-disk superblock unless overridden.
+		if !hashSet {
+			p.HashName = ""
+		}
+	} else {
+		if p.DataBlockSize == 0 {
+			p.DataBlockSize = 4096
+		}
+		if p.HashBlockSize == 0 {
+			p.HashBlockSize = 4096
+		}
+		if err := utils.ValidateHashOffset(p.HashAreaOffset, p.HashBlockSize, true); err != nil {
+			return err
+		}
+	}
+
+	if len(e.Flags) > 0 {
+		exclusive := 0
+		for _, f := range e.Flags {
+			if strings.HasSuffix(f, "_corruption") {
+				exclusive++
+			}
+		}
+		if exclusive > 1 {
+			return errors.New("only one of ignore-corruption, restart-on-corruption and panic-on-corruption may be set")
+		}
+	}
+
+	e.Params = p
+	return nil
+}
+
+func requiresValue(key string) bool {
+	switch key {
+	case "superblock", "format", "data-block-size", "hash-block-size", "data-blocks",
+		"hash-offset", "hash", "salt", "uuid", "root-hash-signature":
+		return true
+	}
+	return false
+}
+
+func parseBool(s string) (bool, error) {
+	switch strings.ToLower(s) {
+	case "", "1", "yes", "y", "true", "t", "on":
+		return true, nil
+	case "0", "no", "n", "false", "f", "off":
+		return false, nil
+	}
+	return false, fmt.Errorf("invalid boolean %q", s)
+}
+
+// splitCmdline splits a kernel command line on whitespace while keeping
+// double-quoted values together.
+func splitCmdline(s string) []string {
+	var words []string
+	var cur strings.Builder
+	inQuote := false
+	for _, r := range s {
+		switch {
+		case r == '"':
+			inQuote = !inQuote
+		case !inQuote && (r == ' ' || r == '\t' || r == '\n'):
+			if cur.Len() > 0 {
+				words = append(words, cur.String())
+				cur.Reset()
+			}
+		default:
+			cur.WriteRune(r)
+		}
+	}
+	if cur.Len() > 0 {
+		words = append(words, cur.String())
+	}
+	return words
+}
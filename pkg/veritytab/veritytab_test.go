@@ -0,0 +1,154 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package veritytab
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testRoot = "4392712ba01368efdf14b05c76f9e4df0d53664630b5d48632ed17a137f39076"
+
+func TestParse(t *testing.T) {
+	tab := `# comment
+root  /dev/sda2 /dev/sda3 ` + testRoot + `
+
+data  PARTUUID=0f6e-1 PARTUUID=0f6e-2 ` + testRoot + ` superblock=no,hash=sha1,format=0,data-block-size=512,hash-block-size=512,salt=0102,hash-offset=1024,restart-on-corruption,ignore-zero-blocks,nofail
+`
+	entries, err := Parse(strings.NewReader(tab))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("got %d entries, want 2", len(entries))
+	}
+
+	root := entries[0]
+	if root.Name != "root" || root.DataDevice != "/dev/sda2" || root.HashDevice != "/dev/sda3" {
+		t.Errorf("unexpected root entry: %+v", root)
+	}
+	if root.Params.NoSuperblock || root.Params.HashName != "" || root.Params.DataBlockSize != 0 {
+		t.Errorf("superblock entry should leave parameters to the superblock: %+v", root.Params)
+	}
+	if len(root.RootHash) != 32 {
+		t.Errorf("root hash length = %d", len(root.RootHash))
+	}
+
+	data := entries[1]
+	p := data.Params
+	if !p.NoSuperblock || p.HashName != "sha1" || p.HashType != 0 || p.DataBlockSize != 512 ||
+		p.HashBlockSize != 512 || p.HashAreaOffset != 1024 || p.SaltSize != 2 {
+		t.Errorf("unexpected params: %+v", p)
+	}
+	if !reflect.DeepEqual(data.Flags, []string{"restart_on_corruption", "ignore_zero_blocks"}) {
+		t.Errorf("flags = %v", data.Flags)
+	}
+	if !data.NoFail || data.NoAuto {
+		t.Errorf("nofail/noauto = %v/%v", data.NoFail, data.NoAuto)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		tab  string
+	}{
+		{"too few fields", "root /dev/sda2 /dev/sda3\n"},
+		{"bad root hash", "root /dev/sda2 /dev/sda3 xyz\n"},
+		{"unknown option", "root /dev/sda2 /dev/sda3 " + testRoot + " frobnicate\n"},
+		{"bad block size", "root /dev/sda2 /dev/sda3 " + testRoot + " superblock=no,data-block-size=1000\n"},
+		{"conflicting corruption modes", "root /dev/sda2 /dev/sda3 " + testRoot + " ignore-corruption,panic-on-corruption\n"},
+		{"missing value", "root /dev/sda2 /dev/sda3 " + testRoot + " hash\n"},
+		{"duplicate name", "a /dev/sda2 /dev/sda3 " + testRoot + "\na /dev/sdb2 /dev/sdb3 " + testRoot + "\n"},
+		{"slash in name", "a/b /dev/sda2 /dev/sda3 " + testRoot + "\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Parse(strings.NewReader(tt.tab)); err == nil {
+				t.Error("expected error, got nil")
+			}
+		})
+	}
+}
+
+func TestParseCmdline(t *testing.T) {
+	cmdline := `BOOT_IMAGE=/vmlinuz quiet roothash=` + testRoot +
+		` systemd.verity_root_data=PARTUUID=aaaa systemd.verity_root_hash=PARTUUID=bbbb` +
+		` systemd.verity_root_options="panic-on-corruption,check-at-most-once"` +
+		` usrhash=` + testRoot + ` systemd.verity_usr_data=/dev/vda3 systemd.verity_usr_hash=/dev/vda4`
+
+	entries, err := ParseCmdline(cmdline)
+	if err != nil {
+		t.Fatalf("ParseCmdline failed: %v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("got %d entries, want 2", len(entries))
+	}
+	if entries[0].Name != "root" || entries[0].DataDevice != "PARTUUID=aaaa" || entries[0].HashDevice != "PARTUUID=bbbb" {
+		t.Errorf("unexpected root entry: %+v", entries[0])
+	}
+	if !reflect.DeepEqual(entries[0].Flags, []string{"panic_on_corruption", "check_at_most_once"}) {
+		t.Errorf("root flags = %v", entries[0].Flags)
+	}
+	if entries[1].Name != "usr" || entries[1].DataDevice != "/dev/vda3" {
+		t.Errorf("unexpected usr entry: %+v", entries[1])
+	}
+}
+
+func TestParseCmdlineDisabled(t *testing.T) {
+	entries, err := ParseCmdline("systemd.verity=no roothash=" + testRoot)
+	if err != nil {
+		t.Fatalf("ParseCmdline failed: %v", err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("expected no entries with systemd.verity=no, got %d", len(entries))
+	}
+}
+
+func TestParseCmdlineDerivedDevices(t *testing.T) {
+	entries, err := ParseCmdline("quiet roothash=" + testRoot + " usrhash=" + testRoot +
+		" systemd.verity_usr_hash=/dev/vda4")
+	if err != nil {
+		t.Fatalf("ParseCmdline failed: %v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("got %d entries, want 2", len(entries))
+	}
+	root := entries[0]
+	if root.DataDevice != "/dev/disk/by-partuuid/4392712b-a013-68ef-df14-b05c76f9e4df" ||
+		root.HashDevice != "/dev/disk/by-partuuid/0d536646-30b5-d486-32ed-17a137f39076" {
+		t.Errorf("unexpected root devices: %s %s", root.DataDevice, root.HashDevice)
+	}
+	if usr := entries[1]; usr.DataDevice != root.DataDevice || usr.HashDevice != "/dev/vda4" {
+		t.Errorf("unexpected usr devices: %s %s", usr.DataDevice, usr.HashDevice)
+	}
+
+	// A 160 bit root hash cannot name two partitions.
+	if _, err := ParseCmdline("roothash=" + testRoot[:40]); err == nil {
+		t.Error("expected an error for a root hash too short to derive devices")
+	}
+}
+
+func TestSplitCmdline(t *testing.T) {
+	got := splitCmdline(`a=1  b="x y" c`)
+	want := []string{"a=1", "b=x y", "c"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("splitCmdline = %q, want %q", got, want)
+	}
+}